@@ -2,16 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/jcmturner/gokrb5/v8/spnego"
 	"github.com/joho/godotenv"
+	"go-http-pgsql-krb5/internal/config"
 	"go-http-pgsql-krb5/internal/handlers"
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/dnscache"
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+	"go-http-pgsql-krb5/pkg/redact"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -24,56 +36,240 @@ func main() {
 		return
 	}
 
-	krb5confPath := os.Getenv("KRB5_CONFIG_PATH")
-	if krb5confPath == "" {
-		krb5confPath = "/etc/krb5.conf"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config: %v", err)
 	}
-	keytabPath := os.Getenv("KRB5_KEYTAB_PATH")
-	if keytabPath == "" {
-		keytabPath = "/etc/apache2/keytab"
+	handlers.Configure(cfg)
+	redact.SetParams(cfg.Log.RedactParams)
+
+	// SPN вашего сервиса: должны совпадать с записями в keytab; первый — основной
+	spns := cfg.Krb5.SPNList()
+
+	// Часовой пояс для time.Time в ответах из БД (пусто — как отдаёт сервер)
+	if err := pgx.SetResultTimezone(cfg.DB.ResultTimezone); err != nil {
+		log.Fatalf("result timezone: %v", err)
 	}
-	// SPN вашего сервиса: должен совпадать с записью в keytab
 
-	spn := os.Getenv("KRB5_SPN")
+	pgx.SetStartupRetry(cfg.DB.StartupRetries, cfg.DB.StartupRetryBackoff)
+	pgx.SetStatementTimeout(cfg.DB.StatementTimeout)
+	pgx.SetConnectTimeout(cfg.DB.ConnectTimeout)
+	pgx.SetMaxConnLifetime(cfg.DB.MaxConnLifetime)
+	pgx.SetTLSConfig(&tls.Config{MinVersion: tlsVersion(cfg.DB.TLSMinVersion)}, cfg.DB.TLSServerName)
+	pgx.SetQueryObserver(func(op string, d time.Duration, _ error) { metrics.ObservePostgres(op, d) })
+	pgx.SetPoolObserver(func(principal string, open bool) {
+		if open {
+			metrics.SessionOpened(principal)
+		} else {
+			metrics.SessionClosed(principal)
+		}
+	})
 
-	kt, err := keytab.Load(keytabPath)
+	// Прикладные channel bindings (base64) для AP_REQ к Postgres и IPA
+	cb, err := krb.ParseChannelBinding(cfg.Krb5.ChannelBinding)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	krb.SetChannelBinding(cb)
+	krb.SetCanonicalizeDNS(cfg.Krb5.CanonicalizeDNS)
+	krb.SetCCacheGraceRetry(cfg.Krb5.CCacheRetries, cfg.Krb5.CCacheRetryBackoff)
+
+	// Хосты IPA и Postgres должны попадать в нужный realm, иначе билеты
+	// запрашиваются не у того KDC — предупреждаем, но старт не прерываем
+	checkRealmMappings(cfg)
+
+	kt, err := keytab.Load(cfg.Krb5.KeytabPath)
 	if err != nil {
 		log.Fatalf("load keytab: %v", err)
 	}
-	//krbCfg, err := config.Load(krb5confPath)
-	//if err != nil {
-	//	log.Fatalf("load krb5.conf: %v", err)
-	//}
-
-	// Настройки сервиса: отключаем PAC-decode как быстрый фикс
-	//s := service.NewSettings(
-	//	kt,
-	//	service.SName(spn),
-	//	service.DecodePAC(false), // ключевая строка: не пытаться читать PAC
-	//	// service.Logger(log.New(os.Stdout, "[krb] ", log.LstdFlags)), // включите при отладке
-	//)
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /user_show", handlers.IpaUserHandler)
-	mux.HandleFunc("GET /test_db", handlers.TestSelectHandler)
-
-	protected := spnego.SPNEGOKRB5Authenticate(mux, kt,
-		service.SName(spn),
-		service.DecodePAC(false),
+	for _, s := range spns {
+		if err := krb.ValidateKeytabSPN(kt, s); err != nil {
+			log.Fatalf("krb5.spn: %v", err)
+		}
+	}
+
+	var resolver *dnscache.Resolver
+	if cfg.DNS.CacheTTL > 0 {
+		resolver = dnscache.New(cfg.DNS.CacheTTL, cfg.DNS.NegativeCacheTTL)
+	}
+	if err := handlers.ConfigureIPATransport(cfg.IPA.IdleConnTimeout, resolver); err != nil {
+		log.Fatalf("ipa transport: %v", err)
+	}
+	if cfg.IPA.TicketCache {
+		// Билет за минуту до конца срока уже не отдаётся — берётся новый у KDC
+		handlers.SetIPATicketCache(krb.NewMemoryTicketCache(time.Minute))
+	}
+	if cfg.IPA.UserShowCache {
+		handlers.SetUserShowCache(cfg.IPA.UserShowCacheTTL, cfg.IPA.UserShowCacheSize)
+	}
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	handlers.StartIPAIdleReaper(reaperCtx, cfg.IPA.IdleReapInterval)
+	if cfg.DB.UserPoolMaxConns > 0 {
+		// Sweep раз в минуту, до остановки вместе с reaper IPA
+		pools := pgx.NewUserPoolManager(cfg.Krb5.ConfigPath, int32(cfg.DB.UserPoolMaxConns), cfg.DB.UserPoolIdleTTL)
+		pools.Start(reaperCtx, time.Minute)
+		pgx.SetUserPools(pools)
+		defer pools.Close()
+	}
+
+	if cfg.Warmup {
+		warmUp(context.Background(), cfg, kt)
+	}
+
+	proxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("trusted_proxies: %v", err)
+	}
+	middleware.SetTrustedProxies(proxies)
+
+	mux := middleware.NewRouter()
+	// Хэндлерам с делегированием ccache разбирается один раз, в DelegatedCredentials
+	middleware.SetCredentialsReject(handlers.RejectCredentials)
+	mux.Handle("/user_show", middleware.DelegatedCredentials(http.HandlerFunc(handlers.IpaUserHandler)), http.MethodGet)
+	mux.Handle("/user_add", middleware.DelegatedCredentials(http.HandlerFunc(handlers.UserAddHandler)), http.MethodPost)
+	mux.Handle("/user_mod", middleware.DelegatedCredentials(http.HandlerFunc(handlers.UserModHandler)), http.MethodPost)
+	mux.Handle("/user_find", middleware.DelegatedCredentials(http.HandlerFunc(handlers.UserFindHandler)), http.MethodGet)
+	mux.Handle("/user_overview", middleware.DelegatedCredentials(http.HandlerFunc(handlers.UserOverviewHandler)), http.MethodGet)
+	mux.Handle("/group_show", middleware.DelegatedCredentials(http.HandlerFunc(handlers.GroupShowHandler)), http.MethodGet)
+	mux.Handle("/session/status", middleware.DelegatedCredentials(http.HandlerFunc(handlers.SessionStatusHandler)), http.MethodGet)
+	mux.Handle("/test_db", middleware.DelegatedCredentials(http.HandlerFunc(handlers.TestSelectHandler)), http.MethodGet)
+	mux.HandleFunc("/whoami", handlers.WhoAmIHandler, http.MethodGet)
+	// Только ipa.admin_groups (или группы из auth.route_groups) — см. handlers.Authorize
+	mux.Handle("/debug/vars", expvar.Handler(), http.MethodGet)
+
+	var inner http.Handler = mux
+	// Логировать, какой записью keytab (kvno/enctype) принят билет — для контроля ротации ключей
+	if cfg.Krb5.AuditKeytab {
+		inner = middleware.KeytabAudit(inner, kt)
+	}
+	if cfg.DB.Affinity {
+		inner = middleware.DBAffinity(inner)
+	}
+	if cfg.Auth.PrincipalHeader != "" {
+		inner = handlers.PrincipalHeader(inner, cfg.Auth.PrincipalHeader)
+	}
+
+	// Группы IPA, нужные маршруту (auth.route_groups)
+	inner = handlers.Authorize(inner)
+	// Реалмы клиентов: allowed_realms / blocked_realms — до похода в IPA за группами
+	inner = handlers.RealmPolicy(inner)
+	// Не больше auth.max_in_flight запросов одного принципала одновременно —
+	// снаружи Authorize, чтобы считались и походы в IPA за группами
+	inner = handlers.PrincipalLimit(inner, cfg.Auth.MaxInFlight)
+	// Билет может быть на любой из SPN (несколько имён хоста), но только на них
+	inner = middleware.AcceptSPNs(inner, spns)
+	inner = middleware.CapturePrincipal(inner)
+	// Хэндлеры видят клиента через middleware.Identity, а не goidentity напрямую
+	inner = middleware.Identify(inner)
+	// TGT, делегированный клиентом прямо в SPNEGO, — во временный ccache для хэндлеров
+	if cfg.Krb5.AcceptDelegation {
+		inner = middleware.AcceptDelegation(inner, kt, cfg.Krb5.DelegationDir)
+	}
+
+	protected := spnego.SPNEGOKRB5Authenticate(inner, kt,
+		service.SName(spns[0]),
+		// PAC по умолчанию не читается (быстрый фикс для билетов без ключа нужного enctype);
+		// krb5.decode_pac включает группы для handlers.GroupsFromContext
+		service.DecodePAC(cfg.Krb5.DecodePAC),
 	)
+	if cfg.Krb5.KerberosOnly {
+		protected = middleware.KerberosOnly(protected)
+	}
+	// Огромный Negotiate-токен — 431 ещё до base64/ASN.1
+	protected = middleware.LimitNegotiate(protected, cfg.Krb5.MaxTokenBytes)
+
+	// Пробы Kubernetes ходят без билета Kerberos — мимо SPNEGO
+	probes := middleware.NewRouter()
+	probes.HandleFunc("/healthz", handlers.HealthzHandler, http.MethodGet)
+	probes.HandleFunc("/readyz", handlers.ReadyzHandler, http.MethodGet)
+
+	root := http.NewServeMux()
+	root.Handle("/healthz", probes)
+	root.Handle("/readyz", probes)
+	if cfg.Metrics {
+		probes.Handle("/metrics", metrics.Handler(), http.MethodGet)
+		root.Handle("/metrics", probes)
+	}
+	root.Handle("/", protected)
 
 	server := &http.Server{
-		Addr:    ":9080",
-		Handler: protected,
+		Addr:           cfg.ListenAddr,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		// Recover — снаружи SPNEGO, чтобы ловить и панику аутентификации
+		Handler: middleware.ClientIP(middleware.Logging(middleware.Recover(root))),
 	}
+	if cfg.TLS.Enabled() {
+		tlsCfg, err := serverTLSConfig(reaperCtx, cfg.TLS)
+		if err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+		server.TLSConfig = tlsCfg
+	}
+
+	// Слушаем до запуска горутины: занятый порт — ошибка старта, а не тихий простой
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("listen %s: %v", server.Addr, err)
+	}
+
+	logStartupSummary(cfg, server.Addr, cfg.TLS.Enabled(), kt)
 
+	// Ошибка Serve (кроме штатного ErrServerClosed) завершает процесс с ненулевым
+	// кодом, чтобы оркестратор перезапустил под, а не держал неработающий
+	serveErr := make(chan error, 1)
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
-			log.Printf("http server err: %v", err)
-			return
+		var err error
+		if cfg.TLS.Enabled() {
+			// Сертификат отдаёт GetCertificate из TLSConfig
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			err = server.Serve(ln)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
 		}
+		serveErr <- err
 	}()
 
-	<-sigChan
-	server.Shutdown(context.Background())
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Printf("http server err: %v", err)
+			stopReaper()
+			os.Exit(1)
+		}
+	case <-sigChan:
+		if !shutdown(server, cfg) {
+			stopReaper()
+			os.Exit(1)
+		}
+	}
+}
+
+// shutdown останавливает сервер не дольше cfg.ShutdownTimeout. Сначала ждёт
+// текущие запросы db.shutdown_drain, затем отменяет запросы к БД на сервере и
+// дожидается хэндлеров до общего срока. false — соединения закрыты принудительно.
+func shutdown(server *http.Server, cfg *config.Config) bool {
+	log.Printf("shutdown: draining connections (timeout %s)", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	drainCtx, cancelDrain := context.WithTimeout(ctx, cfg.DB.ShutdownDrain)
+	defer cancelDrain()
+
+	err := server.Shutdown(drainCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// Запросы под пользователями не успели — отменяем их на сервере,
+		// чтобы бэкенды не остались работать после выхода процесса
+		n := pgx.CancelActiveQueries(ctx)
+		log.Printf("shutdown: drain timed out, cancelled %d running queries", n)
+		err = server.Shutdown(ctx)
+	}
+	if err != nil {
+		log.Printf("shutdown: timed out, forcing connections closed: %v", err)
+		server.Close()
+		return false
+	}
+	log.Println("shutdown: all connections drained")
+	return true
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+
+	"go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+func checkRealmMappings(cfg *config.Config) {
+	krbCfg, err := krbconfig.Load(cfg.Krb5.ConfigPath)
+	if err != nil {
+		log.Printf("warning: realm mappings not checked: %v", err)
+		return
+	}
+	var ipaHost string
+	if u, err := url.Parse(cfg.IPA.BaseURL); err == nil {
+		ipaHost = u.Hostname()
+	}
+	// db.host — список через запятую (multi-host), проверяем каждый
+	hosts := []string{ipaHost}
+	for _, h := range strings.Split(cfg.DB.Host, ",") {
+		hosts = append(hosts, strings.TrimSpace(h))
+	}
+	for _, err := range krb.CheckDomainRealm(krbCfg, hosts...) {
+		log.Printf("warning: krb5.conf: %v", err)
+	}
+}
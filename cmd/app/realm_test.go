@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-http-pgsql-krb5/internal/config"
+)
+
+func TestCheckRealmMappingsMultiHost(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "krb5.conf")
+	krb5 := "[libdefaults]\n default_realm = EX.COM\n[realms]\n EX.COM = {\n  kdc = kdc.ex.com\n }\n[domain_realm]\n .ex.com = EX.COM\n"
+	if err := os.WriteFile(conf, []byte(krb5), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Defaults()
+	cfg.Krb5.ConfigPath = conf
+	cfg.IPA.BaseURL = "https://ipa.ex.com/ipa"
+	cfg.DB.Host = "db1.ex.com, db2.other.org"
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	checkRealmMappings(cfg)
+
+	// Каждый хост multi-host проверяется отдельно: предупреждение только о db2
+	out := logged.String()
+	if strings.Count(out, "warning:") != 1 || !strings.Contains(out, "host db2.other.org has no domain_realm mapping") {
+		t.Fatalf("log = %q", out)
+	}
+}
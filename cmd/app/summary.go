@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	"go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/pkg/redact"
+)
+
+// logStartupSummary пишет одну строку key=value с фактической конфигурацией,
+// чтобы оператор видел, с чем процесс реально поднялся. Секреты не выводятся.
+func logStartupSummary(cfg *config.Config, addr string, tlsOn bool, kt *keytab.Keytab) {
+	fields := []string{
+		kv("addr", addr),
+		kv("tls", onOff(tlsOn)),
+		kv("spn", strings.Join(cfg.Krb5.SPNList(), ",")),
+		kv("keytab_spns", strings.Join(keytabSPNs(kt), ",")),
+		kv("ipa_url", redact.URL(cfg.IPA.BaseURL)),
+		kv("db_host", cfg.DB.Host),
+		kv("db_port", strconv.Itoa(cfg.DB.Port)),
+		kv("db_name", cfg.DB.Name),
+		kv("db_krbsrvname", cfg.DB.KrbSrvName),
+		kv("credential_flow", cfg.Krb5.CredentialFlow),
+		kv("channel_binding", setUnset(cfg.Krb5.ChannelBinding != "")),
+		kv("check_delegation", onOff(cfg.Krb5.CheckDelegation)),
+		kv("audit_keytab", onOff(cfg.Krb5.AuditKeytab)),
+		kv("accept_delegation", onOff(cfg.Krb5.AcceptDelegation)),
+		kv("nil_identity", cfg.Auth.NilIdentity),
+		kv("max_in_flight", strconv.Itoa(cfg.Auth.MaxInFlight)),
+		kv("warmup", onOff(cfg.Warmup)),
+	}
+	log.Printf("startup: %s", strings.Join(fields, " "))
+}
+
+func kv(k, v string) string {
+	if v == "" || strings.ContainsAny(v, " \"=") {
+		return fmt.Sprintf("%s=%q", k, v)
+	}
+	return k + "=" + v
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func setUnset(b bool) string {
+	if b {
+		return "set"
+	}
+	return "unset"
+}
+
+// keytabSPNs — уникальные принципалы из keytab (без ключей и kvno).
+func keytabSPNs(kt *keytab.Keytab) []string {
+	if kt == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range kt.Entries {
+		p := strings.Join(e.Principal.Components, "/") + "@" + e.Principal.Realm
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
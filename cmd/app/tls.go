@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+
+	"go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/tlsreload"
+)
+
+// serverTLSConfig собирает tls.Config для собственного HTTPS: сертификат
+// перечитывается с диска при обновлении, ALPN объявляет HTTP/2.
+func serverTLSConfig(ctx context.Context, c config.TLSConfig) (*tls.Config, error) {
+	r, err := tlsreload.New(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.ReloadInterval > 0 {
+		go r.Watch(ctx, c.ReloadInterval)
+	}
+	return &tls.Config{
+		MinVersion:     tlsVersion(c.MinVersion),
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// tlsVersion — константа crypto/tls для "1.2"/"1.3" из конфига.
+func tlsVersion(v string) uint16 {
+	if v == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	"go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/handlers"
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+// warmUp прогревает DNS/TLS до первого запроса: резолвит KDC, проверяет запись SPN
+// в keytab, открывает TLS к IPA и к каждому хосту Postgres. Ошибки только логируются —
+// старт сервера от прогрева не зависит. Вызывать после ConfigureIPATransport.
+func warmUp(ctx context.Context, cfg *config.Config, kt *keytab.Keytab) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	step := func(name string, fn func() error) {
+		start := time.Now()
+		if err := fn(); err != nil {
+			log.Printf("warm-up %s: failed: %v", name, err)
+			return
+		}
+		log.Printf("warm-up %s: ok (%s)", name, time.Since(start).Round(time.Millisecond))
+	}
+
+	step("kdc", func() error {
+		krbCfg, err := krbconfig.Load(cfg.Krb5.ConfigPath)
+		if err != nil {
+			return err
+		}
+		_, kdcs, err := krbCfg.GetKDCs(krbCfg.LibDefaults.DefaultRealm, true)
+		if err != nil {
+			return err
+		}
+		for _, kdc := range kdcs {
+			host, _, err := net.SplitHostPort(kdc)
+			if err != nil {
+				host = kdc
+			}
+			if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	step("keytab", func() error {
+		var missing []string
+		for _, s := range cfg.Krb5.SPNList() {
+			if !krb.KeytabHasSPN(kt, s) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("no keytab entry for %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+
+	if cfg.IPA.BaseURL != "" {
+		// Через общий транспорт IPA: TLS-соединение остаётся в пуле для первого запроса
+		step("ipa", func() error {
+			return handlers.WarmUpIPA(ctx, cfg.IPA.BaseURL)
+		})
+	}
+
+	if cfg.DB.Host != "" {
+		// Те же хосты, порт и TLS, что у подключений под пользователем:
+		// SSLRequest и рукопожатие, без аутентификации
+		step("postgres", func() error {
+			return pgx.WarmUp(ctx, pgx.BuildDSN(pgx.DSNOptions{
+				Host:    cfg.DB.Host,
+				Port:    cfg.DB.Port,
+				DBName:  cfg.DB.Name,
+				SSLMode: "require",
+			}))
+		})
+	}
+}
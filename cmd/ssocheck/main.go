@@ -0,0 +1,150 @@
+// ssocheck — офлайн-проверка делегированного ccache без развёртывания сервиса:
+// проходит Kerberos-вход в FreeIPA и/или в Postgres тем же кодом, что и сервер,
+// и печатает принципал, SPN, срок TGT и итог.
+//
+//	ssocheck -ccache FILE:/tmp/krb5cc_1000 -ipa https://ipa.example.com
+//	ssocheck -ccache /tmp/krb5cc_1000 -dsn "host=db.example.com dbname=postgres user=alice"
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/handlers"
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+func main() {
+	ccacheFlag := flag.String("ccache", os.Getenv("KRB5CCNAME"), "ccache to test (FILE:/path or /path; default $KRB5CCNAME)")
+	krb5Conf := flag.String("krb5conf", "/etc/krb5.conf", "path to krb5.conf")
+	ipaURL := flag.String("ipa", "", "FreeIPA base URL, e.g. https://ipa.example.com")
+	caFile := flag.String("ipa-ca", "", "PEM CA bundle for the IPA certificate (default: system roots)")
+	dsn := flag.String("dsn", "", "Postgres DSN (keyword=value), e.g. \"host=db dbname=postgres user=alice\"")
+	timeout := flag.Duration("timeout", 15*time.Second, "overall time limit")
+	flag.Parse()
+
+	if *ccacheFlag == "" || (*ipaURL == "" && *dsn == "") {
+		fmt.Fprintln(os.Stderr, "usage: ssocheck -ccache NAME [-ipa URL] [-dsn DSN]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	// Относительный путь из командной строки — от текущего каталога (в
+	// X_krb5ccname такие не принимаются)
+	name := *ccacheFlag
+	if !strings.Contains(name, ":") {
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+	}
+	ccache, err := middleware.ParseCCacheName(name)
+	if err != nil {
+		fatal("ccache: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cc, err := krb.LoadCCache(ctx, ccache)
+	if err != nil {
+		fatal("ccache: %v", err)
+	}
+	fmt.Printf("ccache:    %s\n", ccache)
+	fmt.Printf("principal: %s@%s\n", cc.GetClientPrincipalName().PrincipalNameString(), cc.GetClientRealm())
+	end, err := pgx.CCacheValid(ccache)
+	if err != nil {
+		fatal("tgt: %v", err)
+	}
+	fmt.Printf("tgt until: %s (%s left)\n", end.Format(time.RFC3339), time.Until(end).Round(time.Second))
+
+	ok := true
+	if *ipaURL != "" {
+		ok = checkIPA(ctx, *ipaURL, *caFile, *krb5Conf, ccache) && ok
+	}
+	if *dsn != "" {
+		ok = checkPostgres(ctx, *dsn, *krb5Conf, ccache) && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// checkIPA логинится в IPA через handlers.IPASession и вызывает whoami.
+func checkIPA(ctx context.Context, baseURL, caFile, krb5Conf, ccache string) bool {
+	cfg := config.Defaults()
+	cfg.IPA.BaseURL = baseURL
+	cfg.IPA.CAFile = caFile
+	handlers.Configure(cfg)
+	if err := handlers.ConfigureIPATransport(cfg.IPA.IdleConnTimeout, nil); err != nil {
+		return report("ipa", "", err)
+	}
+
+	spn := "HTTP/?"
+	if host, err := hostOf(baseURL); err == nil {
+		spn = krb.ServiceSPN("HTTP", host)
+	}
+	sess, err := handlers.NewIPASession(ctx, baseURL, krb5Conf, ccache)
+	if err != nil {
+		return report("ipa", spn, err)
+	}
+	res, err := sess.Call(ctx, "whoami", nil, nil)
+	if err != nil {
+		return report("ipa", spn, err)
+	}
+	fmt.Printf("ipa:       ok, spn %s, whoami %v, session until %s\n", spn, res["arguments"], sess.Expires().Format(time.RFC3339))
+	return true
+}
+
+// checkPostgres подключается под ccache (тот же провайдер GSS, что и в
+// сервисе) и спрашивает у сервера, кем он нас считает.
+func checkPostgres(ctx context.Context, dsn, krb5Conf, ccache string) bool {
+	spn := ""
+	if pc, err := pgconn.ParseConfig(dsn); err == nil {
+		spn = pc.KerberosSpn
+		if spn == "" {
+			srv := pc.KerberosSrvName
+			if srv == "" {
+				srv = pgx.DefaultKrbSrvName
+			}
+			spn = krb.ServiceSPN(srv, pc.Host)
+		}
+	}
+	rows, err := pgx.QueryAsUser(ctx, dsn, ccache, krb5Conf, "select current_user, session_user")
+	if err != nil {
+		return report("postgres", spn, err)
+	}
+	var user any
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		user = rows[0][0]
+	}
+	fmt.Printf("postgres:  ok, spn %s, current_user %v\n", spn, user)
+	return true
+}
+
+func report(target, spn string, err error) bool {
+	fmt.Printf("%-10s FAILED, spn %s: %v\n", target+":", spn, err)
+	return false
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "ssocheck: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Hostname(), nil
+}
@@ -0,0 +1,626 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/redact"
+)
+
+// Config — настройки сервиса. Источники по возрастанию приоритета:
+// значения по умолчанию, YAML-файл из CONFIG_FILE, переменные окружения.
+type Config struct {
+	Krb5 Krb5Config `yaml:"krb5"`
+	IPA  IPAConfig  `yaml:"ipa"`
+	DB   DBConfig   `yaml:"db"`
+	TLS  TLSConfig  `yaml:"tls"`
+	Auth AuthConfig `yaml:"auth"`
+	Log  LogConfig  `yaml:"log"`
+	DNS  DNSConfig  `yaml:"dns"`
+
+	// Адрес HTTP-сервера, host:port (":9080" — все интерфейсы)
+	ListenAddr string `yaml:"listen_addr"`
+	// CIDR прокси, чьим X-Forwarded-For/Forwarded верим при определении адреса клиента
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Предел суммарного размера заголовков запроса (http.Server.MaxHeaderBytes)
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+
+	// Прогрев DNS/TLS к KDC, IPA и Postgres при старте (не влияет на успех старта)
+	Warmup bool `yaml:"warmup"`
+
+	// GET /metrics в формате Prometheus, без SPNEGO
+	Metrics bool `yaml:"metrics"`
+
+	// Общий срок остановки сервера по SIGTERM/SIGINT
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Krb5Config struct {
+	ConfigPath string `yaml:"config_path"`
+	KeytabPath string `yaml:"keytab_path"`
+	// Один SPN или несколько через запятую (KRB5_SPN), плюс список spns
+	SPN             string   `yaml:"spn"`
+	SPNs            []string `yaml:"spns"`
+	CheckDelegation bool     `yaml:"check_delegation"`
+	AuditKeytab     bool     `yaml:"audit_keytab"`
+	ChannelBinding  string   `yaml:"channel_binding"` // base64
+	// Откуда брать билеты к IPA и Postgres. Пока только delegated: gokrb5 не
+	// реализует S4U2Self/S4U2Proxy, и s4u/auto отвергаются при проверке
+	CredentialFlow string `yaml:"credential_flow"`
+	// Приводить хосты SPN к FQDN через DNS (CNAME, затем PTR)
+	CanonicalizeDNS bool `yaml:"canonicalize_dns"`
+	// Разбирать PAC билета (SID групп AD). Нужен ключ keytab того enctype,
+	// которым зашифрован билет
+	DecodePAC bool `yaml:"decode_pac"`
+	// Принимать в SPNEGO только Kerberos: NTLM и прочие механизмы — 401
+	KerberosOnly bool `yaml:"kerberos_only"`
+	// Повторы чтения недописанного ccache (фронтенд ещё пишет делегированные креды)
+	CCacheRetries      int           `yaml:"ccache_retries"`
+	CCacheRetryBackoff time.Duration `yaml:"ccache_retry_backoff"`
+	// Предел заголовка Authorization (Negotiate-токен в base64), сверх — 431
+	// до разбора токена; 0 — без предела
+	MaxTokenBytes int `yaml:"max_token_bytes"`
+	// Принимать TGT, делегированный клиентом в SPNEGO, и отдавать его хэндлерам
+	// временным ccache (вместо X_krb5ccname от фронтенда)
+	AcceptDelegation bool `yaml:"accept_delegation"`
+	// Каталог временных ccache делегированных кредов ("" — системный TMPDIR)
+	DelegationDir string `yaml:"delegation_dir"`
+}
+
+type IPAConfig struct {
+	BaseURL string `yaml:"base_url"`
+	// Реалм пользователей IPA ("" — default_realm из krb5.conf). Принципалы
+	// других реалмов (доверия AD) записи IPA не имеют: их короткое имя может
+	// совпасть с чужим uid, поэтому групп и прав IPA они не получают
+	Realm string `yaml:"realm"`
+	// Члены этих групп IPA видят все атрибуты user_show, остальные — без RestrictedAttributes
+	AdminGroups          []string      `yaml:"admin_groups"`
+	RestrictedAttributes []string      `yaml:"restricted_attributes"`
+	IdleConnTimeout      time.Duration `yaml:"idle_conn_timeout"`
+	IdleReapInterval     time.Duration `yaml:"idle_reap_interval"`
+	// Разрешить http:// (только для разработки): Negotiate-токен уйдёт открытым текстом
+	AllowInsecureHTTP bool `yaml:"allow_insecure_http"`
+	// Срезать realm у uid вида alice@EXAMPLE.COM перед user_show
+	StripRealm bool `yaml:"strip_realm"`
+	// Предел размера ответа IPA в байтах
+	MaxResponseBytes int `yaml:"max_response_bytes"`
+	// Версия API FreeIPA, передаваемая параметром "version" в каждом вызове
+	// (пусто — не передавать). Не выше версии сервера, иначе IPA отвергнет вызов
+	APIVersion string `yaml:"api_version"`
+	// Глубина раскрытия вложенных групп в /group_show?expand=true
+	GroupExpandDepth int `yaml:"group_expand_depth"`
+	// Держать сессию IPA (cookie после login_kerberos) между запросами пользователя
+	SessionCache bool `yaml:"session_cache"`
+	// Кэш сервисных билетов HTTP/<ipa-host> по принципалу: меньше TGS-REQ к KDC
+	TicketCache bool `yaml:"ticket_cache"`
+	// Кэш ответов /user_show по (принципал, uid): TTL и предел числа записей (LRU);
+	// ?nocache=1 идёт мимо кэша
+	UserShowCache     bool          `yaml:"user_show_cache"`
+	UserShowCacheTTL  time.Duration `yaml:"user_show_cache_ttl"`
+	UserShowCacheSize int           `yaml:"user_show_cache_size"`
+	// Отвергать ответы IPA с повторяющимися ключами в JSON-объектах
+	StrictJSON bool `yaml:"strict_json"`
+	// PEM с CA, которым подписан сертификат IPA (обычно /etc/ipa/ca.crt),
+	// вместо системного хранилища
+	CAFile string `yaml:"ca_file"`
+	// Не проверять сертификат IPA. ТОЛЬКО для разработки, как
+	// allow_insecure_http; при старте пишется предупреждение
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+type DBConfig struct {
+	// Хост или несколько через запятую (multi-host DSN, порт общий)
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	Name string `yaml:"name"`
+	// Имя сервиса в SPN Postgres (krbsrvname): <krbsrvname>/<host>@REALM
+	KrbSrvName     string `yaml:"krbsrvname"`
+	ResultTimezone string `yaml:"result_timezone"`
+	EmptyResult    string `yaml:"empty_result"` // array | envelope | no_content
+	// Повторы подключения на 57P03/57P01 (0 — выключено)
+	StartupRetries      int           `yaml:"startup_retries"`
+	StartupRetryBackoff time.Duration `yaml:"startup_retry_backoff"`
+	// Предел подключения под пользователем и жизни соединения в пуле
+	// (не дольше срока делегированного ccache)
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	// statement_timeout для запросов под пользователем (0 — без предела)
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// Сколько при остановке ждать текущие запросы, прежде чем отменить их на сервере
+	ShutdownDrain time.Duration `yaml:"shutdown_drain"`
+	// Все запросы к Postgres в рамках HTTP-запроса — через одно соединение
+	// (тот же сервер multi-host DSN): чтение видит только что сделанную запись
+	Affinity bool `yaml:"affinity"`
+	// Пул соединений на пользователя (принципал + ccache): предел соединений
+	// (0 — соединение на каждый вызов) и сколько простаивающий пул живёт
+	UserPoolMaxConns int           `yaml:"user_pool_max_conns"`
+	UserPoolIdleTTL  time.Duration `yaml:"user_pool_idle_ttl"`
+	// Имя для проверки сертификата Postgres, если отличается от хоста в DSN
+	// (пулер, VIP); пусто — хост из DSN
+	TLSServerName string `yaml:"tls_server_name"`
+	TLSMinVersion string `yaml:"tls_min_version"`
+}
+
+// TLS самого сервиса: при заданных cert_file и key_file сервер слушает HTTPS
+// (с HTTP/2), иначе — открытый HTTP за внешним прокси, как раньше.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// "1.2" или "1.3"
+	MinVersion string `yaml:"min_version"`
+	// Как часто проверять, не обновились ли cert/key на диске
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// SPNList — все SPN сервиса: из spn (через запятую) и spns, без повторов.
+// Первый используется как основной.
+func (k Krb5Config) SPNList() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range append(splitList(k.SPN), k.SPNs...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Enabled — включён ли собственный TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+type AuthConfig struct {
+	// Что делать, если в контексте нет identity: reject (401) | degraded
+	NilIdentity string `yaml:"nil_identity"`
+	// Имя заголовка ответа с каноническим принципалом клиента (пусто — не добавлять)
+	PrincipalHeader string `yaml:"principal_header"`
+	// Маршрут -> группы IPA, членство в любой из которых нужно для доступа.
+	// Маршруты без записи доступны любому аутентифицированному пользователю.
+	RouteGroups map[string][]string `yaml:"route_groups"`
+	// Реалмы клиентов, которые принимаются (пусто — любые, прошедшие SPNEGO)
+	AllowedRealms []string `yaml:"allowed_realms"`
+	// Реалмы, заблокированные политикой (непризнаваемые доверия): ответ
+	// blocked_status (403 или 451) с blocked_message
+	BlockedRealms  []string `yaml:"blocked_realms"`
+	BlockedStatus  int      `yaml:"blocked_status"`
+	BlockedMessage string   `yaml:"blocked_message"`
+	// Одновременных запросов одного принципала, сверх — 429 (0 — без ограничения)
+	MaxInFlight int `yaml:"max_in_flight"`
+}
+
+// Кэш DNS для исходящих соединений к IPA (ttl 0 — выключен). KDC gokrb5
+// дозванивается сам через net.Dial, туда кэш подключить нельзя.
+type DNSConfig struct {
+	CacheTTL         time.Duration `yaml:"cache_ttl"`
+	NegativeCacheTTL time.Duration `yaml:"negative_cache_ttl"`
+}
+
+type LogConfig struct {
+	// Параметры DSN/URL, значения которых маскируются в логах и ошибках
+	RedactParams []string `yaml:"redact_params"`
+}
+
+func defaults() *Config {
+	return &Config{
+		Krb5: Krb5Config{
+			ConfigPath:         "/etc/krb5.conf",
+			KeytabPath:         "/etc/apache2/keytab",
+			CredentialFlow:     "delegated",
+			KerberosOnly:       true,
+			CCacheRetries:      3,
+			CCacheRetryBackoff: 20 * time.Millisecond,
+			MaxTokenBytes:      64 << 10,
+		},
+		IPA: IPAConfig{
+			AdminGroups: []string{"admins"},
+			RestrictedAttributes: []string{
+				"krblastpwdchange", "krbpasswordexpiration", "krbextradata",
+				"krblastadminunlock", "krbloginfailedcount",
+				"krblastfailedauth", "krblastsuccessfulauth",
+			},
+			IdleConnTimeout:   90 * time.Second,
+			IdleReapInterval:  5 * time.Minute,
+			MaxResponseBytes:  10 << 20,
+			GroupExpandDepth:  5,
+			StripRealm:        true,
+			UserShowCacheTTL:  30 * time.Second,
+			UserShowCacheSize: 1000,
+			APIVersion:        "2.229",
+		},
+		DB: DBConfig{
+			Port:                5432,
+			EmptyResult:         "array",
+			KrbSrvName:          "postgres",
+			TLSMinVersion:       "1.2",
+			StartupRetryBackoff: 500 * time.Millisecond,
+			StatementTimeout:    10 * time.Second,
+			ConnectTimeout:      5 * time.Second,
+			MaxConnLifetime:     30 * time.Second,
+			ShutdownDrain:       10 * time.Second,
+			UserPoolIdleTTL:     5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			NilIdentity:    "reject",
+			BlockedStatus:  451,
+			BlockedMessage: "principals from this realm are not accepted by policy",
+		},
+		TLS: TLSConfig{
+			MinVersion:     "1.2",
+			ReloadInterval: time.Minute,
+		},
+		DNS: DNSConfig{
+			NegativeCacheTTL: 5 * time.Second,
+		},
+		ListenAddr:      ":9080",
+		MaxHeaderBytes:  128 << 10,
+		ShutdownTimeout: 15 * time.Second,
+		Log: LogConfig{
+			RedactParams: append([]string(nil), redact.DefaultParams...),
+		},
+	}
+}
+
+// Defaults — конфигурация по умолчанию без файла, окружения и проверки
+// (для утилит вроде cmd/ssocheck, которым не нужен keytab сервиса).
+func Defaults() *Config {
+	return defaults()
+}
+
+// Load собирает конфигурацию: умолчания -> файл CONFIG_FILE (если задан) -> env.
+// Все найденные ошибки возвращаются разом.
+func Load() (*Config, error) {
+	cfg := defaults()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true) // опечатка в ключе — ошибка, а не молчаливый дефолт
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv перекрывает значения из файла непустыми переменными окружения.
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v := os.Getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = splitList(v)
+		}
+	}
+	integer := func(name string, dst *int) {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("KRB5_CONFIG_PATH", &c.Krb5.ConfigPath)
+	str("KRB5_KEYTAB_PATH", &c.Krb5.KeytabPath)
+	str("KRB5_SPN", &c.Krb5.SPN)
+	boolean("KRB5_CHECK_DELEGATION", &c.Krb5.CheckDelegation)
+	boolean("KRB5_AUDIT_KEYTAB", &c.Krb5.AuditKeytab)
+	str("KRB5_CHANNEL_BINDING", &c.Krb5.ChannelBinding)
+	str("KRB5_CREDENTIAL_FLOW", &c.Krb5.CredentialFlow)
+	boolean("KRB5_CANONICALIZE_DNS", &c.Krb5.CanonicalizeDNS)
+	boolean("KRB5_DECODE_PAC", &c.Krb5.DecodePAC)
+	boolean("KRB5_KERBEROS_ONLY", &c.Krb5.KerberosOnly)
+	integer("KRB5_CCACHE_RETRIES", &c.Krb5.CCacheRetries)
+	duration("KRB5_CCACHE_RETRY_BACKOFF", &c.Krb5.CCacheRetryBackoff)
+	integer("KRB5_MAX_TOKEN_BYTES", &c.Krb5.MaxTokenBytes)
+	boolean("KRB5_ACCEPT_DELEGATION", &c.Krb5.AcceptDelegation)
+	str("KRB5_DELEGATION_DIR", &c.Krb5.DelegationDir)
+
+	str("FREEIPA_BASE_URL", &c.IPA.BaseURL)
+	str("IPA_REALM", &c.IPA.Realm)
+	list("IPA_ADMIN_GROUPS", &c.IPA.AdminGroups)
+	list("IPA_RESTRICTED_ATTRIBUTES", &c.IPA.RestrictedAttributes)
+	duration("IPA_IDLE_CONN_TIMEOUT", &c.IPA.IdleConnTimeout)
+	duration("IPA_IDLE_REAP_INTERVAL", &c.IPA.IdleReapInterval)
+	boolean("IPA_ALLOW_INSECURE_HTTP", &c.IPA.AllowInsecureHTTP)
+	integer("IPA_MAX_RESPONSE_BYTES", &c.IPA.MaxResponseBytes)
+	integer("IPA_GROUP_EXPAND_DEPTH", &c.IPA.GroupExpandDepth)
+	str("IPA_API_VERSION", &c.IPA.APIVersion)
+	boolean("IPA_SESSION_CACHE", &c.IPA.SessionCache)
+	boolean("IPA_TICKET_CACHE", &c.IPA.TicketCache)
+	boolean("IPA_USER_SHOW_CACHE", &c.IPA.UserShowCache)
+	duration("IPA_USER_SHOW_CACHE_TTL", &c.IPA.UserShowCacheTTL)
+	integer("IPA_USER_SHOW_CACHE_SIZE", &c.IPA.UserShowCacheSize)
+	boolean("IPA_STRICT_JSON", &c.IPA.StrictJSON)
+	str("IPA_CA_FILE", &c.IPA.CAFile)
+	boolean("IPA_INSECURE_SKIP_VERIFY", &c.IPA.InsecureSkipVerify)
+	boolean("IPA_STRIP_REALM", &c.IPA.StripRealm)
+
+	str("PG_HOST", &c.DB.Host)
+	integer("PG_PORT", &c.DB.Port)
+	str("PG_DB", &c.DB.Name)
+	str("PG_RESULT_TIMEZONE", &c.DB.ResultTimezone)
+	str("DB_EMPTY_RESULT", &c.DB.EmptyResult)
+	integer("PG_STARTUP_RETRIES", &c.DB.StartupRetries)
+	duration("PG_STARTUP_RETRY_BACKOFF", &c.DB.StartupRetryBackoff)
+	duration("PG_SHUTDOWN_DRAIN", &c.DB.ShutdownDrain)
+	boolean("PG_AFFINITY", &c.DB.Affinity)
+	integer("PG_USER_POOL_MAX_CONNS", &c.DB.UserPoolMaxConns)
+	duration("PG_USER_POOL_IDLE_TTL", &c.DB.UserPoolIdleTTL)
+	str("PG_KRBSRVNAME", &c.DB.KrbSrvName)
+	duration("PG_STATEMENT_TIMEOUT", &c.DB.StatementTimeout)
+	duration("PG_CONNECT_TIMEOUT", &c.DB.ConnectTimeout)
+	duration("PG_MAX_CONN_LIFETIME", &c.DB.MaxConnLifetime)
+	str("PG_TLS_SERVER_NAME", &c.DB.TLSServerName)
+	str("PG_TLS_MIN_VERSION", &c.DB.TLSMinVersion)
+
+	// CERT_FILE_PATH — прежнее имя TLS_CERT_FILE; заданы оба — побеждает TLS_CERT_FILE
+	if v := os.Getenv("CERT_FILE_PATH"); v != "" {
+		if t := os.Getenv("TLS_CERT_FILE"); t != "" && t != v {
+			log.Printf("config: CERT_FILE_PATH is deprecated and ignored: TLS_CERT_FILE=%s is set", t)
+		} else {
+			log.Printf("config: CERT_FILE_PATH is deprecated, use TLS_CERT_FILE")
+		}
+	}
+	str("CERT_FILE_PATH", &c.TLS.CertFile)
+	str("TLS_CERT_FILE", &c.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	str("TLS_MIN_VERSION", &c.TLS.MinVersion)
+	duration("TLS_RELOAD_INTERVAL", &c.TLS.ReloadInterval)
+
+	str("AUTH_NIL_IDENTITY", &c.Auth.NilIdentity)
+	str("AUTH_PRINCIPAL_HEADER", &c.Auth.PrincipalHeader)
+	list("AUTH_ALLOWED_REALMS", &c.Auth.AllowedRealms)
+	list("AUTH_BLOCKED_REALMS", &c.Auth.BlockedRealms)
+	integer("AUTH_BLOCKED_STATUS", &c.Auth.BlockedStatus)
+	str("AUTH_BLOCKED_MESSAGE", &c.Auth.BlockedMessage)
+	integer("AUTH_MAX_IN_FLIGHT", &c.Auth.MaxInFlight)
+
+	list("LOG_REDACT_PARAMS", &c.Log.RedactParams)
+
+	duration("DNS_CACHE_TTL", &c.DNS.CacheTTL)
+	duration("DNS_NEGATIVE_CACHE_TTL", &c.DNS.NegativeCacheTTL)
+
+	str("LISTEN_ADDR", &c.ListenAddr)
+	list("TRUSTED_PROXIES", &c.TrustedProxies)
+	integer("MAX_HEADER_BYTES", &c.MaxHeaderBytes)
+	boolean("WARMUP_ON_START", &c.Warmup)
+	boolean("METRICS_ENABLED", &c.Metrics)
+	duration("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+
+	return errors.Join(errs...)
+}
+
+// splitList разбирает значение вида "a, b,c" в список без пустых элементов.
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Validate проверяет согласованность значений после слияния источников.
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(name, v string) {
+		if strings.TrimSpace(v) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	required("krb5.spn (KRB5_SPN)", strings.Join(c.Krb5.SPNList(), ","))
+	required("krb5.keytab_path (KRB5_KEYTAB_PATH)", c.Krb5.KeytabPath)
+	required("ipa.base_url (FREEIPA_BASE_URL)", c.IPA.BaseURL)
+	required("db.host (PG_HOST)", c.DB.Host)
+	required("db.name (PG_DB)", c.DB.Name)
+	if c.Krb5.KeytabPath != "" {
+		if f, err := os.Open(c.Krb5.KeytabPath); err != nil {
+			errs = append(errs, fmt.Errorf("krb5.keytab_path: %w", err))
+		} else {
+			f.Close()
+		}
+	}
+	if c.IPA.BaseURL != "" {
+		if u, err := url.Parse(c.IPA.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ipa.base_url: invalid url %q", c.IPA.BaseURL))
+		} else if u.Scheme != "https" && !c.IPA.AllowInsecureHTTP {
+			errs = append(errs, fmt.Errorf("ipa.base_url: %s scheme is not allowed, use https (or ipa.allow_insecure_http for dev)", u.Scheme))
+		}
+	}
+	if c.IPA.IdleConnTimeout < 0 || c.IPA.IdleReapInterval < 0 {
+		errs = append(errs, errors.New("ipa: durations must not be negative"))
+	}
+	if c.IPA.GroupExpandDepth < 0 {
+		errs = append(errs, errors.New("ipa.group_expand_depth: must not be negative"))
+	}
+	if c.IPA.MaxResponseBytes < 0 {
+		errs = append(errs, errors.New("ipa.max_response_bytes: must not be negative"))
+	}
+	if v := c.IPA.APIVersion; v != "" && !isIPAAPIVersion(v) {
+		errs = append(errs, fmt.Errorf("ipa.api_version: %q is not MAJOR.MINOR", v))
+	}
+	if c.IPA.UserShowCache && (c.IPA.UserShowCacheTTL <= 0 || c.IPA.UserShowCacheSize <= 0) {
+		errs = append(errs, errors.New("ipa: user_show_cache_ttl and user_show_cache_size must be positive"))
+	}
+	switch c.TLS.MinVersion {
+	case "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("tls.min_version: unsupported value %q (1.2 or 1.3)", c.TLS.MinVersion))
+	}
+	if c.DB.KrbSrvName == "" || strings.ContainsAny(c.DB.KrbSrvName, "/@") {
+		errs = append(errs, fmt.Errorf("db.krbsrvname: invalid service name %q", c.DB.KrbSrvName))
+	}
+	switch c.DB.TLSMinVersion {
+	case "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("db.tls_min_version: unsupported value %q (1.2 or 1.3)", c.DB.TLSMinVersion))
+	}
+	if c.TLS.KeyFile != "" && c.TLS.CertFile == "" {
+		errs = append(errs, errors.New("tls.key_file is set without tls.cert_file"))
+	}
+	if c.TLS.ReloadInterval < 0 {
+		errs = append(errs, errors.New("tls.reload_interval: must not be negative"))
+	}
+	if c.DNS.CacheTTL < 0 || c.DNS.NegativeCacheTTL < 0 {
+		errs = append(errs, errors.New("dns: cache ttls must not be negative"))
+	}
+	if _, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr: %w", err))
+	} else if _, err := net.LookupPort("tcp", port); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr: %w", err))
+	}
+	for _, p := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(p); err != nil {
+			if _, err := netip.ParseAddr(p); err != nil {
+				errs = append(errs, fmt.Errorf("trusted_proxies: %q is not an address or CIDR", p))
+			}
+		}
+	}
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("max_header_bytes: must be positive"))
+	}
+	if c.Krb5.MaxTokenBytes < 0 {
+		errs = append(errs, errors.New("krb5.max_token_bytes: must not be negative"))
+	} else if c.Krb5.MaxTokenBytes > c.MaxHeaderBytes {
+		errs = append(errs, fmt.Errorf("krb5.max_token_bytes: %d exceeds max_header_bytes %d", c.Krb5.MaxTokenBytes, c.MaxHeaderBytes))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: must be positive"))
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db.port: %d out of range", c.DB.Port))
+	}
+	if c.DB.ConnectTimeout <= 0 || c.DB.MaxConnLifetime <= 0 {
+		errs = append(errs, errors.New("db: connect_timeout and max_conn_lifetime must be positive"))
+	}
+	if c.DB.StatementTimeout < 0 {
+		errs = append(errs, errors.New("db.statement_timeout: must not be negative"))
+	}
+	if c.DB.ShutdownDrain < 0 {
+		errs = append(errs, errors.New("db.shutdown_drain: must not be negative"))
+	}
+	if c.DB.UserPoolMaxConns < 0 || c.DB.UserPoolIdleTTL < 0 {
+		errs = append(errs, errors.New("db: user_pool_max_conns and user_pool_idle_ttl must not be negative"))
+	}
+	if c.Krb5.CCacheRetries < 0 || c.Krb5.CCacheRetryBackoff < 0 {
+		errs = append(errs, errors.New("krb5: ccache retry settings must not be negative"))
+	}
+	if c.Krb5.AcceptDelegation && c.Krb5.DelegationDir != "" {
+		if fi, err := os.Stat(c.Krb5.DelegationDir); err != nil {
+			errs = append(errs, fmt.Errorf("krb5.delegation_dir: %w", err))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("krb5.delegation_dir: %s is not a directory", c.Krb5.DelegationDir))
+		}
+	}
+	if c.DB.StartupRetries < 0 || c.DB.StartupRetryBackoff < 0 {
+		errs = append(errs, errors.New("db: startup retry settings must not be negative"))
+	}
+	switch c.DB.EmptyResult {
+	case "array", "envelope", "no_content":
+	default:
+		errs = append(errs, fmt.Errorf("db.empty_result: unknown value %q", c.DB.EmptyResult))
+	}
+	switch c.Krb5.CredentialFlow {
+	case "delegated":
+	case "s4u", "auto":
+		errs = append(errs, fmt.Errorf("krb5.credential_flow: %q is not supported (no S4U2Self/S4U2Proxy in gokrb5), use delegated", c.Krb5.CredentialFlow))
+	default:
+		errs = append(errs, fmt.Errorf("krb5.credential_flow: unknown value %q", c.Krb5.CredentialFlow))
+	}
+	for route, groups := range c.Auth.RouteGroups {
+		if !strings.HasPrefix(route, "/") {
+			errs = append(errs, fmt.Errorf("auth.route_groups: route %q must start with /", route))
+		}
+		if len(groups) == 0 {
+			errs = append(errs, fmt.Errorf("auth.route_groups: no groups for %s", route))
+		}
+	}
+	switch c.Auth.BlockedStatus {
+	case http.StatusForbidden, http.StatusUnavailableForLegalReasons:
+	default:
+		errs = append(errs, fmt.Errorf("auth.blocked_status: %d is not allowed (403 or 451)", c.Auth.BlockedStatus))
+	}
+	if c.Auth.MaxInFlight < 0 {
+		errs = append(errs, errors.New("auth.max_in_flight: must not be negative"))
+	}
+	switch c.Auth.NilIdentity {
+	case "reject", "degraded":
+	default:
+		errs = append(errs, fmt.Errorf("auth.nil_identity: unknown value %q", c.Auth.NilIdentity))
+	}
+	if c.DB.ResultTimezone != "" {
+		if _, err := time.LoadLocation(c.DB.ResultTimezone); err != nil {
+			errs = append(errs, fmt.Errorf("db.result_timezone: %w", err))
+		}
+	}
+	if _, err := krb.ParseChannelBinding(c.Krb5.ChannelBinding); err != nil {
+		errs = append(errs, fmt.Errorf("krb5.channel_binding: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// isIPAAPIVersion — версия API FreeIPA вида "2.229".
+func isIPAAPIVersion(v string) bool {
+	major, minor, ok := strings.Cut(v, ".")
+	_, errMajor := strconv.ParseUint(major, 10, 16)
+	_, errMinor := strconv.ParseUint(minor, 10, 16)
+	return ok && errMajor == nil && errMinor == nil
+}
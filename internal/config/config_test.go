@@ -0,0 +1,350 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig — умолчания с обязательными полями, проходящие Validate.
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	kt := filepath.Join(t.TempDir(), "keytab")
+	if err := os.WriteFile(kt, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := defaults()
+	c.Krb5.SPN = "HTTP/app.ex.com"
+	c.Krb5.KeytabPath = kt
+	c.IPA.BaseURL = "https://ipa.ex.com"
+	c.DB.Host = "db.ex.com"
+	c.DB.Name = "app"
+	return c
+}
+
+func TestValidateCredentialFlow(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	for flow, want := range map[string]string{
+		"s4u":  "not supported",
+		"auto": "not supported",
+		"kcd":  "unknown value",
+	} {
+		c := validConfig(t)
+		c.Krb5.CredentialFlow = flow
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("credential_flow %q: err = %v, want %q", flow, err, want)
+		}
+	}
+}
+
+func TestValidateDBPort(t *testing.T) {
+	for _, port := range []int{0, -1, 65536} {
+		c := validConfig(t)
+		c.DB.Port = port
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "db.port") {
+			t.Errorf("port %d: err = %v", port, err)
+		}
+	}
+}
+
+func TestValidateEmptyResult(t *testing.T) {
+	for _, mode := range []string{"array", "envelope", "no_content"} {
+		c := validConfig(t)
+		c.DB.EmptyResult = mode
+		if err := c.Validate(); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+	}
+	c := validConfig(t)
+	c.DB.EmptyResult = "null"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "db.empty_result") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestValidateNilIdentity(t *testing.T) {
+	for _, policy := range []string{"reject", "degraded"} {
+		c := validConfig(t)
+		c.Auth.NilIdentity = policy
+		if err := c.Validate(); err != nil {
+			t.Errorf("%s: %v", policy, err)
+		}
+	}
+	c := validConfig(t)
+	c.Auth.NilIdentity = "anonymous"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "auth.nil_identity") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestValidateStartupRetry(t *testing.T) {
+	for _, tc := range []struct {
+		retries int
+		backoff time.Duration
+	}{{-1, time.Second}, {3, -time.Second}} {
+		c := validConfig(t)
+		c.DB.StartupRetries, c.DB.StartupRetryBackoff = tc.retries, tc.backoff
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "startup retry") {
+			t.Errorf("retries %d, backoff %v accepted", tc.retries, tc.backoff)
+		}
+	}
+}
+
+func TestValidateIPAScheme(t *testing.T) {
+	for _, tc := range []struct {
+		url      string
+		insecure bool
+		ok       bool
+	}{
+		{"https://ipa.ex.com/ipa", false, true},
+		{"http://ipa.ex.com/ipa", false, false},
+		{"http://ipa.ex.com/ipa", true, true},
+		{"ftp://ipa.ex.com/ipa", false, false},
+	} {
+		c := validConfig(t)
+		c.IPA.BaseURL, c.IPA.AllowInsecureHTTP = tc.url, tc.insecure
+		err := c.Validate()
+		if tc.ok != (err == nil) || err != nil && !strings.Contains(err.Error(), "ipa.base_url") {
+			t.Errorf("%s insecure=%v: err = %v", tc.url, tc.insecure, err)
+		}
+	}
+}
+
+func TestValidateCCacheRetry(t *testing.T) {
+	c := validConfig(t)
+	c.Krb5.CCacheRetries = -1
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "ccache retry") {
+		t.Fatalf("negative retries: err = %v", err)
+	}
+	c = validConfig(t)
+	c.Krb5.CCacheRetries, c.Krb5.CCacheRetryBackoff = 0, 0
+	if err := c.Validate(); err != nil {
+		t.Fatalf("retries disabled: %v", err)
+	}
+}
+
+func TestValidateDBTLSMinVersion(t *testing.T) {
+	for v, ok := range map[string]bool{"1.2": true, "1.3": true, "1.1": false, "": false} {
+		c := validConfig(t)
+		c.DB.TLSMinVersion = v
+		err := c.Validate()
+		if ok != (err == nil) || err != nil && !strings.Contains(err.Error(), "db.tls_min_version") {
+			t.Errorf("%q: err = %v", v, err)
+		}
+	}
+}
+
+func TestValidateListenAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		":9080":          true,
+		"127.0.0.1:8443": true,
+		"[::1]:https":    true,
+		"9080":           false,
+		":nosuchport":    false,
+		"":               false,
+	} {
+		c := validConfig(t)
+		c.ListenAddr = addr
+		err := c.Validate()
+		if ok != (err == nil) || err != nil && !strings.Contains(err.Error(), "listen_addr") {
+			t.Errorf("%q: err = %v", addr, err)
+		}
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	c := validConfig(t)
+	c.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.7", "::1"}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c.TrustedProxies = []string{"10.0.0.0/8", "proxy.ex.com"}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `trusted_proxies: "proxy.ex.com"`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestValidateDBTimeouts(t *testing.T) {
+	for _, set := range []func(*Config){
+		func(c *Config) { c.DB.ConnectTimeout = 0 },
+		func(c *Config) { c.DB.MaxConnLifetime = -time.Second },
+	} {
+		c := validConfig(t)
+		set(c)
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "connect_timeout and max_conn_lifetime") {
+			t.Errorf("err = %v", err)
+		}
+	}
+}
+
+func TestValidateBlockedStatus(t *testing.T) {
+	for status, ok := range map[int]bool{403: true, 451: true, 401: false, 404: false, 0: false} {
+		c := validConfig(t)
+		c.Auth.BlockedStatus = status
+		err := c.Validate()
+		if ok != (err == nil) || err != nil && !strings.Contains(err.Error(), "auth.blocked_status") {
+			t.Errorf("%d: err = %v", status, err)
+		}
+	}
+}
+
+func TestSPNList(t *testing.T) {
+	k := Krb5Config{SPN: "HTTP/app.ex.com, HTTP/alias.ex.com", SPNs: []string{"HTTP/alias.ex.com", "HTTP/app2.ex.com"}}
+	if got := strings.Join(k.SPNList(), ","); got != "HTTP/app.ex.com,HTTP/alias.ex.com,HTTP/app2.ex.com" {
+		t.Fatalf("SPNList = %s", got)
+	}
+}
+
+// useConfigFile пишет YAML во временный файл и указывает на него CONFIG_FILE;
+// обязательные поля, которых нет в yaml, задаются окружением.
+func useConfigFile(t *testing.T, yaml string) {
+	t.Helper()
+	dir := t.TempDir()
+	kt := filepath.Join(dir, "keytab")
+	if err := os.WriteFile(kt, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("KRB5_KEYTAB_PATH", kt)
+}
+
+const baseYAML = `
+krb5:
+  spn: HTTP/app.ex.com
+ipa:
+  base_url: https://ipa.ex.com
+db:
+  host: db.ex.com
+  name: app
+`
+
+func TestLoadFileOverDefaults(t *testing.T) {
+	useConfigFile(t, baseYAML+`  port: 6432
+  statement_timeout: 3s
+log:
+  redact_params: [token]
+`)
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DB.Host != "db.ex.com" || c.DB.Port != 6432 || c.DB.StatementTimeout.String() != "3s" {
+		t.Fatalf("db = %+v", c.DB)
+	}
+	if len(c.Log.RedactParams) != 1 || c.Log.RedactParams[0] != "token" {
+		t.Fatalf("redact_params = %v, want the file's list instead of the default", c.Log.RedactParams)
+	}
+	// Чего нет в файле — из умолчаний
+	if c.DB.KrbSrvName != "postgres" || c.ListenAddr != ":9080" || !c.Krb5.KerberosOnly {
+		t.Fatalf("defaults lost: krbsrvname=%q listen=%q kerberos_only=%v", c.DB.KrbSrvName, c.ListenAddr, c.Krb5.KerberosOnly)
+	}
+}
+
+func TestLoadEnvOverFile(t *testing.T) {
+	useConfigFile(t, baseYAML)
+	t.Setenv("PG_HOST", "db2.ex.com")
+	t.Setenv("PG_PORT", "5433")
+	t.Setenv("KRB5_KERBEROS_ONLY", "false")
+	t.Setenv("AUTH_ALLOWED_REALMS", "EX.COM, AD.EX.COM")
+	t.Setenv("PG_STATEMENT_TIMEOUT", "1m")
+	t.Setenv("LISTEN_ADDR", "127.0.0.1:8080")
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DB.Host != "db2.ex.com" || c.DB.Port != 5433 || c.DB.Name != "app" {
+		t.Fatalf("db = %+v", c.DB)
+	}
+	if c.Krb5.KerberosOnly {
+		t.Fatal("KRB5_KERBEROS_ONLY=false ignored")
+	}
+	if got := strings.Join(c.Auth.AllowedRealms, "|"); got != "EX.COM|AD.EX.COM" {
+		t.Fatalf("allowed realms = %q", got)
+	}
+	if c.DB.StatementTimeout.String() != "1m0s" {
+		t.Fatalf("statement_timeout = %s", c.DB.StatementTimeout)
+	}
+	if c.ListenAddr != "127.0.0.1:8080" {
+		t.Fatalf("listen_addr = %q", c.ListenAddr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]struct {
+		yaml string
+		env  map[string]string
+		want []string
+	}{
+		"unknown key":  {baseYAML + "  hots: x\n", nil, []string{"hots"}},
+		"bad env":      {baseYAML, map[string]string{"PG_PORT": "x", "METRICS_ENABLED": "maybe"}, []string{"PG_PORT", "METRICS_ENABLED"}},
+		"all invalid":  {"krb5:\n  credential_flow: s4u\n", map[string]string{"MAX_HEADER_BYTES": "0"}, []string{"krb5.spn", "db.host", "credential_flow", "max_header_bytes"}},
+		"missing file": {"", map[string]string{"CONFIG_FILE": "/nonexistent/config.yaml"}, []string{"config file"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			useConfigFile(t, c.yaml)
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load()
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, w := range c.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("err = %v, want %q", err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestCertFilePathAlias(t *testing.T) {
+	useConfigFile(t, baseYAML)
+	t.Setenv("CERT_FILE_PATH", "/etc/ssl/old.pem")
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TLS.CertFile != "/etc/ssl/old.pem" {
+		t.Fatalf("cert_file = %q from CERT_FILE_PATH", c.TLS.CertFile)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "/etc/ssl/new.pem")
+	if c, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.TLS.CertFile != "/etc/ssl/new.pem" {
+		t.Fatalf("cert_file = %q, want TLS_CERT_FILE to win", c.TLS.CertFile)
+	}
+}
+
+func TestInsecureSkipVerifyFromFileAndEnv(t *testing.T) {
+	useConfigFile(t, strings.Replace(baseYAML, "ipa:\n", "ipa:\n  insecure_skip_verify: true\n", 1))
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IPA.InsecureSkipVerify {
+		t.Fatal("ipa.insecure_skip_verify from file ignored")
+	}
+	t.Setenv("IPA_INSECURE_SKIP_VERIFY", "false")
+	if c, err = Load(); err != nil || c.IPA.InsecureSkipVerify {
+		t.Fatalf("IPA_INSECURE_SKIP_VERIFY=false: %v, %v", c.IPA.InsecureSkipVerify, err)
+	}
+}
+
+func TestExampleConfigParses(t *testing.T) {
+	c := defaults()
+	if err := c.loadFile("../../deploy/config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// callerIsPrivileged — состоит ли вызывающий в одной из ipa.admin_groups.
+// Группы берутся из memberof_group его собственной записи в IPA.
+func callerIsPrivileged(ctx context.Context, sess *IPASession, caller string) (bool, error) {
+	if caller == "" || len(appCfg.IPA.AdminGroups) == 0 {
+		return false, nil
+	}
+	self, err := sess.Call(ctx, "user_show", []any{caller}, nil)
+	if err != nil {
+		return false, err
+	}
+	return hasAnyGroup(self, appCfg.IPA.AdminGroups), nil
+}
+
+func hasAnyGroup(entry map[string]any, groups []string) bool {
+	member, _ := entry["memberof_group"].([]any)
+	for _, g := range member {
+		name, _ := g.(string)
+		for _, want := range groups {
+			if strings.EqualFold(name, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterAttributes возвращает копию записи без атрибутов из restricted (без учёта регистра).
+func filterAttributes(entry map[string]any, restricted []string) map[string]any {
+	deny := make(map[string]struct{}, len(restricted))
+	for _, a := range restricted {
+		deny[strings.ToLower(a)] = struct{}{}
+	}
+	out := make(map[string]any, len(entry))
+	for k, v := range entry {
+		if _, ok := deny[strings.ToLower(k)]; !ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// ipaAttrPattern — имя атрибута LDAP, как его принимает ?attrs=.
+var ipaAttrPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// parseAttrs разбирает ?attrs=mail,uid,memberof: нижний регистр, без повторов,
+// по порядку. Пустая строка — nil (все атрибуты, как раньше).
+func parseAttrs(raw string) ([]string, error) {
+	var attrs []string
+	for _, a := range strings.Split(raw, ",") {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "" {
+			continue
+		}
+		if !ipaAttrPattern.MatchString(a) {
+			return nil, fmt.Errorf("invalid attribute %q", a)
+		}
+		attrs = append(attrs, a)
+	}
+	slices.Sort(attrs)
+	return slices.Compact(attrs), nil
+}
+
+// ipaUserDefaultAttrs — атрибуты, которые user_show отдаёт и без all:true
+// (default_attributes пользователя FreeIPA). Выбрать поля на стороне IPA
+// нельзя, но если всё запрошенное сюда входит, all:true не нужен — и
+// jpegphoto, сертификаты и прочие тяжёлые атрибуты не тянутся.
+var ipaUserDefaultAttrs = []string{
+	"uid", "givenname", "sn", "cn", "displayname", "initials", "gecos",
+	"homedirectory", "loginshell", "uidnumber", "gidnumber", "mail",
+	"telephonenumber", "mobile", "title", "ou", "memberof", "memberofindirect",
+	"nsaccountlock", "krbprincipalname", "krbcanonicalname", "ipasshpubkey",
+}
+
+// userShowParams — именованные параметры user_show для набора attrs.
+func userShowParams(attrs []string) map[string]any {
+	if len(attrs) == 0 {
+		return map[string]any{"all": true}
+	}
+	for _, a := range attrs {
+		if !slices.Contains(ipaUserDefaultAttrs, a) {
+			return map[string]any{"all": true}
+		}
+	}
+	return nil
+}
+
+// selectAttributes оставляет в записи только attrs (без учёта регистра).
+// memberof и memberofindirect IPA разворачивает в memberof_group,
+// memberof_role и т.п. — они входят по префиксу.
+func selectAttributes(entry map[string]any, attrs []string) map[string]any {
+	out := make(map[string]any, len(attrs))
+	for k, v := range entry {
+		key := strings.ToLower(k)
+		for _, a := range attrs {
+			if key == a || strings.HasPrefix(key, a+"_") && strings.HasPrefix(a, "memberof") {
+				out[k] = v
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Записи IPA с ограниченным атрибутом: carol — админ, alice и bob — нет.
+var attrsUsers = map[string]map[string]any{
+	"alice": {"uid": []any{"alice"}, "memberof_group": []any{"ipausers"}, "krblastpwdchange": []any{"20260101000000Z"}},
+	"bob":   {"uid": []any{"bob"}, "memberof_group": []any{"ipausers"}, "krblastpwdchange": []any{"20260101000000Z"}},
+	"carol": {"uid": []any{"carol"}, "memberof_group": []any{"admins"}, "krblastpwdchange": []any{"20260101000000Z"}},
+}
+
+func TestUserShowAttributesByCaller(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		user, realm string
+		uid         string
+		full        bool
+		shows       int // вызовов user_show: цель и, если не себя, вызывающий
+	}{
+		{"self admin", "carol", "EX.COM", "carol", true, 1},
+		{"self non-admin", "alice", "EX.COM", "alice", false, 1},
+		{"admin views other", "carol", "EX.COM", "bob", true, 2},
+		{"non-admin views other", "alice", "EX.COM", "bob", false, 2},
+		// carol из доверенного реалма — не админ carol@EX.COM и не «смотрит себя»
+		{"foreign realm same name", "carol", "AD.EXAMPLE.ORG", "carol", false, 1},
+		{"foreign realm views other", "carol", "AD.EXAMPLE.ORG", "bob", false, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newIPAStub(t, map[string]ipaMethod{"user_show": ipaUsers(attrsUsers)})
+			appCfg.IPA.AdminGroups = []string{"admins"}
+
+			w := serveAs(http.HandlerFunc(IpaUserHandler), http.MethodGet, "/user_show?uid="+tc.uid, "", tc.user, tc.realm)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got["uid"]; !ok {
+				t.Fatalf("uid missing from %v", got)
+			}
+			if _, ok := got["krblastpwdchange"]; ok != tc.full {
+				t.Fatalf("krblastpwdchange present = %v, want %v", ok, tc.full)
+			}
+			shows := stub.callsOf("user_show")
+			if len(shows) != tc.shows {
+				t.Fatalf("user_show calls = %+v, want %d", shows, tc.shows)
+			}
+			for _, c := range shows[1:] {
+				if c.Args[0] != tc.user || tc.realm != "EX.COM" {
+					t.Fatalf("caller lookup %+v for %s@%s", c, tc.user, tc.realm)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	got, err := parseAttrs(" Mail,uid,,memberof,mail ")
+	if err != nil || strings.Join(got, ",") != "mail,memberof,uid" {
+		t.Fatalf("parseAttrs = %v, %v", got, err)
+	}
+	if got, err := parseAttrs(""); err != nil || got != nil {
+		t.Fatalf("empty: %v, %v", got, err)
+	}
+	for _, bad := range []string{"mail;binary", "1uid", "uid,*", "cn=admin"} {
+		if _, err := parseAttrs(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestSelectAttributes(t *testing.T) {
+	entry := map[string]any{
+		"uid": 1, "Mail": 2, "sn": 3,
+		"memberof_group": 4, "memberofindirect_role": 5, "uid_extra": 6,
+	}
+	got := selectAttributes(entry, []string{"mail", "memberof", "uid"})
+	want := []string{"Mail", "memberof_group", "uid"}
+	keys := make([]string, 0, len(got))
+	for k := range got {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, want) {
+		t.Fatalf("selected %v, want %v", keys, want)
+	}
+}
+
+func TestUserShowSelectedAttributes(t *testing.T) {
+	for _, tc := range []struct {
+		attrs string
+		want  []string
+		all   bool
+	}{
+		// Всё из атрибутов по умолчанию — без all:true
+		{"mail,uid", []string{"mail", "uid"}, false},
+		{"uid,memberof", []string{"memberof_group", "uid"}, false},
+		{"uid,jpegphoto", []string{"jpegphoto", "uid"}, true},
+		// Ограниченный атрибут не отдаётся и по прямому запросу
+		{"uid,krblastpwdchange", []string{"uid"}, true},
+		{"", []string{"jpegphoto", "mail", "memberof_group", "uid"}, true},
+	} {
+		t.Run(tc.attrs, func(t *testing.T) {
+			stub := newIPAStub(t, map[string]ipaMethod{"user_show": ipaUsers(map[string]map[string]any{
+				"bob": {
+					"uid": []any{"bob"}, "mail": []any{"bob@ex.com"}, "jpegphoto": []any{"..."},
+					"memberof_group": []any{"ipausers"}, "krblastpwdchange": []any{"20260101000000Z"},
+				},
+			})})
+			appCfg.IPA.AdminGroups = []string{"admins"}
+
+			w := serveAs(http.HandlerFunc(IpaUserHandler), http.MethodGet, "/user_show?nocache=1&uid=bob&attrs="+tc.attrs, "", "bob", "EX.COM")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			keys := make([]string, 0, len(got))
+			for k := range got {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tc.want) {
+				t.Fatalf("attributes %v, want %v", keys, tc.want)
+			}
+			if _, all := stub.callsOf("user_show")[0].Named["all"]; all != tc.all {
+				t.Fatalf("all:true sent = %v, want %v", all, tc.all)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// Authorize проверяет auth.route_groups: для маршрута с записью вызывающий
+// должен состоять хотя бы в одной из групп, иначе 403. Группы берутся из
+// memberof_group его записи в IPA под его же делегированными кредами; у
+// принципалов не из реалма IPA (ipa.realm) записи нет — им такой маршрут 403.
+// Служебные маршруты (adminRoutes) без записи закрыты так же группами
+// ipa.admin_groups. Ставится внутри SPNEGO, после AcceptSPNs.
+func Authorize(next http.Handler) http.Handler {
+	check := middleware.DelegatedCredentials(authorizeGroups(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, restricted := routeGroups(r.URL.Path); !restricted {
+			next.ServeHTTP(w, r)
+			return
+		}
+		check.ServeHTTP(w, r)
+	})
+}
+
+// adminRoutes — служебные маршруты, которые без auth.route_groups не
+// открываются всем аутентифицированным.
+var adminRoutes = map[string]bool{"/debug/vars": true}
+
+// routeGroups — группы, нужные маршруту path; restricted == false — маршрут
+// открыт всем. Служебный маршрут без групп (пустой ipa.admin_groups) закрыт.
+func routeGroups(path string) (groups []string, restricted bool) {
+	if groups = appCfg.Auth.RouteGroups[path]; len(groups) > 0 {
+		return groups, true
+	}
+	if adminRoutes[path] {
+		return appCfg.IPA.AdminGroups, true
+	}
+	return nil, false
+}
+
+func authorizeGroups(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groups, _ := routeGroups(r.URL.Path)
+		if len(groups) == 0 {
+			fail(w, r, CodeForbidden, http.StatusForbidden, "access to "+r.URL.Path+" is disabled: no groups configured")
+			return
+		}
+		id, ok := identityFromRequest(w, r, false)
+		if !ok {
+			return
+		}
+		uid, ok := ipaUID(id)
+		if !ok {
+			fail(w, r, CodeForbidden, http.StatusForbidden,
+				"access to "+r.URL.Path+" requires IPA group membership, "+principalName(id)+" is not an IPA principal")
+			return
+		}
+		ccache, ok := delegatedCCache(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+		sess, err := ipaSessionFor(ctx, principalName(id), ccache)
+		if err != nil {
+			fail(w, r, ipaCode(err), ipaErrorStatus(err), "authz: "+err.Error())
+			return
+		}
+		self, err := sess.Call(ctx, "user_show", []any{uid}, nil)
+		if err != nil {
+			fail(w, r, ipaCode(err), ipaErrorStatus(err), "authz: "+err.Error())
+			return
+		}
+		if !hasAnyGroup(self, groups) {
+			fail(w, r, CodeForbidden, http.StatusForbidden,
+				"access to "+r.URL.Path+" requires membership in one of: "+strings.Join(groups, ", "))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
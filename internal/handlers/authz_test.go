@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// authzUsers — alice читает (ipausers), carol — админ; bob — цель запросов.
+var authzUsers = map[string]map[string]any{
+	"alice": {"uid": []any{"alice"}, "memberof_group": []any{"ipausers"}},
+	"carol": {"uid": []any{"carol"}, "memberof_group": []any{"ipausers", "admins"}},
+	"bob":   {"uid": []any{"bob"}, "memberof_group": []any{"ipausers"}},
+}
+
+func authzMux(t *testing.T) (*ipaStub, http.Handler) {
+	t.Helper()
+	stub := newIPAStub(t, map[string]ipaMethod{
+		"user_show": ipaUsers(authzUsers),
+		"user_add": func(args []any, named map[string]any) (any, *IPAError) {
+			return map[string]any{"uid": args}, nil
+		},
+	})
+	appCfg.Auth.RouteGroups = map[string][]string{
+		"/user_show": {"ipausers"},
+		"/user_add":  {"admins"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user_show", IpaUserHandler)
+	mux.HandleFunc("/user_add", UserAddHandler)
+	return stub, Authorize(mux)
+}
+
+func serveAs(h http.Handler, method, target, body, user, realm string) *httptest.ResponseRecorder {
+	r := asUser(httptest.NewRequest(method, target, strings.NewReader(body)), user, realm)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+const userAddBody = `{"uid":"dave","attrs":{"givenname":"Dave","sn":"Jones"}}`
+
+func TestAuthorizeReadGroup(t *testing.T) {
+	stub, h := authzMux(t)
+
+	if w := serveAs(h, http.MethodGet, "/user_show?uid=bob", "", "alice", "EX.COM"); w.Code != http.StatusOK {
+		t.Fatalf("/user_show as reader: %d %s", w.Code, w.Body)
+	}
+	w := serveAs(h, http.MethodPost, "/user_add", userAddBody, "alice", "EX.COM")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "admins") {
+		t.Fatalf("/user_add as reader: %d %s", w.Code, w.Body)
+	}
+	if calls := stub.callsOf("user_add"); len(calls) != 0 {
+		t.Fatalf("user_add reached IPA: %v", calls)
+	}
+}
+
+func TestAuthorizeAdminGroup(t *testing.T) {
+	stub, h := authzMux(t)
+
+	w := serveAs(h, http.MethodPost, "/user_add", userAddBody, "carol", "EX.COM")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("/user_add as admin: %d %s", w.Code, w.Body)
+	}
+	calls := stub.callsOf("user_add")
+	if len(calls) != 1 || calls[0].Args[0] != "dave" || calls[0].Named["sn"] != "Jones" {
+		t.Fatalf("user_add calls = %+v", calls)
+	}
+}
+
+func TestAuthorizeForeignRealm(t *testing.T) {
+	stub, h := authzMux(t)
+
+	// alice@AD.EXAMPLE.ORG — не локальная alice: её группы не проверяются вовсе
+	w := serveAs(h, http.MethodGet, "/user_show?uid=bob", "", "alice", "AD.EXAMPLE.ORG")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("/user_show from foreign realm: %d %s", w.Code, w.Body)
+	}
+	if got := stub.called(); slices.Contains(got, "user_show") {
+		t.Fatalf("foreign principal was looked up in IPA: %v", got)
+	}
+}
+
+func TestAuthorizeRouteWithoutGroups(t *testing.T) {
+	_, h := authzMux(t)
+	delete(appCfg.Auth.RouteGroups, "/user_show")
+
+	// Без записи маршрут открыт и пользователю другого реалма
+	if w := serveAs(h, http.MethodGet, "/user_show?uid=bob", "", "alice", "AD.EXAMPLE.ORG"); w.Code != http.StatusOK {
+		t.Fatalf("/user_show without route_groups: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAuthorizeDebugVarsAdminOnly(t *testing.T) {
+	_, h := authzMux(t)
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/", h)
+	h = Authorize(mux)
+
+	// Без записи в route_groups — ipa.admin_groups, а не все аутентифицированные
+	if w := serveAs(h, http.MethodGet, "/debug/vars", "", "alice", "EX.COM"); w.Code != http.StatusForbidden {
+		t.Fatalf("/debug/vars as reader: %d %s", w.Code, w.Body)
+	}
+	if w := serveAs(h, http.MethodGet, "/debug/vars", "", "carol", "EX.COM"); w.Code != http.StatusOK {
+		t.Fatalf("/debug/vars as admin: %d %s", w.Code, w.Body)
+	}
+
+	// Без admin_groups служебный маршрут закрыт для всех
+	appCfg.IPA.AdminGroups = nil
+	if w := serveAs(h, http.MethodGet, "/debug/vars", "", "carol", "EX.COM"); w.Code != http.StatusForbidden {
+		t.Fatalf("/debug/vars without admin groups: %d %s", w.Code, w.Body)
+	}
+
+	// Явная запись route_groups перекрывает admin_groups
+	appCfg.Auth.RouteGroups["/debug/vars"] = []string{"ipausers"}
+	if w := serveAs(h, http.MethodGet, "/debug/vars", "", "alice", "EX.COM"); w.Code != http.StatusOK {
+		t.Fatalf("/debug/vars with route_groups: %d %s", w.Code, w.Body)
+	}
+}
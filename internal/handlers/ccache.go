@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+// delegatedCCache возвращает ccache, положенный middleware.DelegatedCredentials
+// (krb5.credential_flow: delegated — другого пути нет). При ошибке ответ уже
+// записан и ok == false.
+func delegatedCCache(w http.ResponseWriter, r *http.Request) (path string, ok bool) {
+	if path = middleware.CCacheFromContext(r.Context()); path == "" {
+		fail(w, r, CodeKrbNoDelegation, http.StatusUnauthorized, middleware.ErrNoDelegatedCredentials.Error())
+		return "", false
+	}
+	return path, true
+}
+
+// RejectCredentials — ответ на отказ middleware.DelegatedCredentials в общем
+// JSON-конверте (подключается через middleware.SetCredentialsReject).
+func RejectCredentials(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrCredentialsExpired):
+		fail(w, r, CodeKrbExpired, http.StatusUnauthorized, err.Error()+", please re-authenticate")
+	case errors.Is(err, middleware.ErrBadDelegatedCredentials):
+		fail(w, r, CodeKrbBadCCache, http.StatusUnauthorized, err.Error())
+	default:
+		fail(w, r, CodeKrbNoDelegation, http.StatusUnauthorized, err.Error())
+	}
+}
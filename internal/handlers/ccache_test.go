@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+func TestDelegatedCCache(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users", nil).WithContext(requestCtx("/run/krb5cc_1"))
+	if path, ok := delegatedCCache(w, r); !ok || path != "/run/krb5cc_1" {
+		t.Fatalf("delegatedCCache = %q, %v", path, ok)
+	}
+
+	// Без делегированного ccache другого пути нет — 401, а не S4U
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/users", nil)
+	if _, ok := delegatedCCache(w, r); ok {
+		t.Fatal("delegatedCCache succeeded without credentials")
+	}
+	if code := errorCodeOf(t, w); w.Code != http.StatusUnauthorized || code != CodeKrbNoDelegation {
+		t.Fatalf("status=%d code=%s, want 401 %s", w.Code, code, CodeKrbNoDelegation)
+	}
+}
+
+func TestRejectCredentials(t *testing.T) {
+	cases := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{middleware.ErrNoDelegatedCredentials, CodeKrbNoDelegation},
+		{fmt.Errorf("%w: bad name", middleware.ErrBadDelegatedCredentials), CodeKrbBadCCache},
+		{fmt.Errorf("ccache: %w", pgx.ErrCredentialsExpired), CodeKrbExpired},
+		{errors.New("other"), CodeKrbNoDelegation},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		RejectCredentials(w, httptest.NewRequest(http.MethodGet, "/users", nil), c.err)
+		if code := errorCodeOf(t, w); w.Code != http.StatusUnauthorized || code != c.code {
+			t.Errorf("%v: status=%d code=%s, want 401 %s", c.err, w.Code, code, c.code)
+		}
+	}
+}
+
+// Истёкший делегированный ccache: 401 с подсказкой войти заново сразу же
+func TestExpiredCCacheReauthenticate(t *testing.T) {
+	middleware.SetCredentialsReject(RejectCredentials)
+	t.Cleanup(func() { middleware.SetCredentialsReject(nil) })
+	h := middleware.DelegatedCredentials(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("request with expired credentials reached the handler")
+	}))
+
+	path := writeTGTCCacheUntil(t, "alice", "EX.COM", time.Now().Add(-time.Minute))
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	r.Header.Set("X_krb5ccname", "FILE:"+path)
+	r = r.WithContext(middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM"}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Retry-After") != "0" || w.Header().Get("WWW-Authenticate") != "Negotiate" {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+	var body errorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != CodeKrbExpired || body.Action != "reauthenticate" || !strings.Contains(body.Message, "please re-authenticate") {
+		t.Fatalf("body = %+v", body)
+	}
+
+	// Без кредов вовсе повтор ничего не даст — Retry-After нет
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("no credentials: status = %d, Retry-After = %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func errorCodeOf(t *testing.T, w *httptest.ResponseRecorder) ErrorCode {
+	t.Helper()
+	var body errorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", w.Body, err)
+	}
+	return body.Code
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	appconfig "go-http-pgsql-krb5/internal/config"
+)
+
+// Конфигурация, с которой работают хэндлеры; задаётся из main до старта сервера.
+var appCfg = &appconfig.Config{}
+
+func Configure(c *appconfig.Config) {
+	appCfg = c
+}
@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/jcmturner/goidentity/v6"
+	"go-http-pgsql-krb5/pkg/krb"
 	"go-http-pgsql-krb5/pkg/pgx"
 	"net/http"
-	"os"
-	"strings"
 	"time"
 )
 
@@ -17,50 +16,144 @@ type dbData struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
+// scanDBData разбирает строку результата без паники: NULL или неожиданный
+// тип от драйвера превращаются в ошибку с номером колонки и типом значения.
+func scanDBData(row []any) (dbData, error) {
+	var d dbData
+	if len(row) < 3 {
+		return d, fmt.Errorf("row has %d columns, want 3", len(row))
+	}
+	var ok bool
+	if d.CurrentUser, ok = row[0].(string); !ok {
+		return d, fmt.Errorf("column 0 (current_user): want string, got %T", row[0])
+	}
+	if d.SessionUser, ok = row[1].(string); !ok {
+		return d, fmt.Errorf("column 1 (session_user): want string, got %T", row[1])
+	}
+	if d.Timestamp, ok = row[2].(time.Time); !ok {
+		return d, fmt.Errorf("column 2 (now): want time.Time, got %T", row[2])
+	}
+	return d, nil
+}
+
+// Форма ответа на пустой результат запроса (db.empty_result):
+//   - array (по умолчанию) — []
+//   - envelope — {"rows":[],"count":0}
+//   - no_content — 204 без тела
+func writeEmptyResult(w http.ResponseWriter) {
+	switch appCfg.DB.EmptyResult {
+	case "no_content":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "envelope":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"rows": []any{}, "count": 0})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]any{})
+	}
+}
+
+// queryAsUser — точка подмены pgx.QueryAsUser в тестах обработчика.
+var queryAsUser = pgx.QueryAsUser
+
 func TestSelectHandler(w http.ResponseWriter, r *http.Request) {
-	ccacheRaw := r.Header.Get("X_krb5ccname")
-	if ccacheRaw == "" {
-		http.Error(w, "no delegated credentials", http.StatusUnauthorized)
+	// Имя пользователя нужно для DSN, так что без identity здесь не обойтись
+	id, ok := identityFromRequest(w, r, false)
+	if !ok {
 		return
 	}
-	ccache := strings.Split(ccacheRaw, ":")[1]
 
-	id := goidentity.FromHTTPRequestContext(r)
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
 
-	if id == nil {
-		http.Error(w, "id is required", http.StatusUnauthorized)
+	if appCfg.Krb5.CheckDelegation {
+		spn := krb.ServiceSPN(appCfg.DB.KrbSrvName, appCfg.DB.Host)
+		if err := pgx.CheckDelegatedTicket(ccache, appCfg.Krb5.ConfigPath, spn); err != nil {
+			fail(w, r, credentialCode(err), http.StatusUnauthorized, err.Error())
+			return
+		}
 	}
 
+	// Роль в Postgres — короткое имя; полный принципал с реалмом (для карт
+	// pg_ident) даёт PrincipalFromContext
 	username := id.UserName()
-	//domain := id.Domain()
 
-	//principal := fmt.Sprintf("%s@%s", username, strings.ToLower(domain))
+	dbDsn := pgx.BuildDSN(pgx.DSNOptions{
+		Host:       appCfg.DB.Host,
+		Port:       appCfg.DB.Port,
+		User:       username,
+		DBName:     appCfg.DB.Name,
+		SSLMode:    "require",
+		KrbSrvName: appCfg.DB.KrbSrvName,
+	})
+
+	const query = "select current_user, session_user, now()"
+
+	// simulate=1 — только проверить запрос под пользователем и вернуть типы, не выполняя
+	if r.URL.Query().Get("simulate") == "1" {
+		desc, err := pgx.DescribeAsUser(r.Context(), dbDsn, ccache, appCfg.Krb5.ConfigPath, query)
+		if err != nil {
+			fail(w, r, dbCode(err), http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(desc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 
-	dbDsn := fmt.Sprintf("host=%s user=%s dbname=%s sslmode=require krbsrvname=postgres", os.Getenv("PG_HOST"), username, os.Getenv("PG_DB"))
+	// format=csv — потоковая выгрузка без накопления строк в памяти
+	if r.URL.Query().Get("format") == "csv" {
+		streamCSV(w, r, dbDsn, ccache, query)
+		return
+	}
 
-	rows, err := pgx.QueryAsUser(
+	// explain=1 — план запроса (EXPLAIN без ANALYZE, запрос не выполняется)
+	if r.URL.Query().Get("explain") == "1" {
+		plan, err := pgx.ExplainAsUser(r.Context(), dbDsn, ccache, appCfg.Krb5.ConfigPath, query)
+		if err != nil {
+			fail(w, r, dbCode(err), http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(plan)
+		return
+	}
+
+	rows, err := queryAsUser(
 		r.Context(),
 		dbDsn,
 		ccache,
-		os.Getenv("KRB5_CONFIG_PATH"), // либо "" чтобы взять системный
-		"select current_user, session_user, now()",
+		appCfg.Krb5.ConfigPath, // либо "" чтобы взять системный
+		query,
 	)
 
+	if errors.Is(err, pgx.ErrCredentialsExpired) {
+		fail(w, r, CodeKrbExpired, http.StatusUnauthorized, err.Error()+", please re-authenticate")
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		fail(w, r, dbCode(err), http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	userDataList := make([]dbData, len(rows))
-
-	for _, row := range rows {
-
-		var userdata dbData
+	if len(rows) == 0 {
+		writeEmptyResult(w)
+		return
+	}
 
-		userdata.CurrentUser = row[0].(string)
-		userdata.SessionUser = row[1].(string)
-		userdata.Timestamp = row[2].(time.Time)
+	userDataList := make([]dbData, 0, len(rows))
 
+	for _, row := range rows {
+		userdata, err := scanDBData(row)
+		if err != nil {
+			fail(w, r, CodeInternal, http.StatusInternalServerError, err.Error())
+			return
+		}
 		userDataList = append(userDataList, userdata)
 	}
 
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// useFakeRows подменяет запрос к Postgres: обработчик получает rows как есть.
+func useFakeRows(t *testing.T, rows [][]any) {
+	t.Helper()
+	prevCfg, prevQuery := appCfg, queryAsUser
+	appCfg = appconfig.Defaults()
+	queryAsUser = func(context.Context, string, string, string, string, ...any) ([][]any, error) {
+		return rows, nil
+	}
+	t.Cleanup(func() { appCfg, queryAsUser = prevCfg, prevQuery })
+}
+
+func serveSelect(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM", ccache: "/run/krb5cc_1"})
+	r := httptest.NewRequest(http.MethodGet, "/db", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	TestSelectHandler(w, r)
+	return w
+}
+
+func TestSelectHandlerRows(t *testing.T) {
+	ts := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	useFakeRows(t, [][]any{
+		{"alice", "alice", ts},
+		{"bob", "alice", ts},
+	})
+
+	w := serveSelect(t)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var got []dbData
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	// Каждая строка ровно один раз, без пустых записей перед ними
+	want := []dbData{
+		{CurrentUser: "alice", SessionUser: "alice", Timestamp: ts},
+		{CurrentUser: "bob", SessionUser: "alice", Timestamp: ts},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSelectHandlerEmptyResult(t *testing.T) {
+	for _, tc := range []struct {
+		mode   string
+		status int
+		body   string
+	}{
+		{"array", http.StatusOK, "[]\n"},
+		{"envelope", http.StatusOK, `{"count":0,"rows":[]}` + "\n"},
+		{"no_content", http.StatusNoContent, ""},
+	} {
+		useFakeRows(t, nil)
+		appCfg.DB.EmptyResult = tc.mode
+
+		w := serveSelect(t)
+		if w.Code != tc.status || w.Body.String() != tc.body {
+			t.Errorf("%s: status = %d, body = %q; want %d, %q", tc.mode, w.Code, w.Body, tc.status, tc.body)
+		}
+	}
+}
+
+func TestSelectHandlerBadColumn(t *testing.T) {
+	ts := time.Now()
+	for _, tc := range []struct {
+		name string
+		row  []any
+		want string
+	}{
+		{"null", []any{"alice", nil, ts}, "column 1 (session_user): want string, got <nil>"},
+		{"wrong type", []any{"alice", "alice", "2026-10-16"}, "column 2 (now): want time.Time, got string"},
+		{"short row", []any{"alice"}, "row has 1 columns, want 3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useFakeRows(t, [][]any{tc.row})
+
+			w := serveSelect(t)
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+			}
+			var body errorBody
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(body.Message, tc.want) {
+				t.Fatalf("message = %q, want %q", body.Message, tc.want)
+			}
+		})
+	}
+}
+
+// Имя пользователя с пробелом и кавычкой не ломает DSN и не добавляет параметров
+func TestSelectHandlerDSN(t *testing.T) {
+	useFakeRows(t, nil)
+	appCfg.DB.Host, appCfg.DB.Name = "db.ex.com", "app"
+	var dsn string
+	queryAsUser = func(_ context.Context, d string, _, _, _ string, _ ...any) ([][]any, error) {
+		dsn = d
+		return nil, nil
+	}
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "o'brien dbname=postgres", realm: "EX.COM", ccache: "/run/krb5cc_1"})
+	w := httptest.NewRecorder()
+	TestSelectHandler(w, httptest.NewRequest(http.MethodGet, "/db", nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("ParseConfig(%s): %v", dsn, err)
+	}
+	if cfg.User != "o'brien dbname=postgres" || cfg.Database != "app" || cfg.Host != "db.ex.com" {
+		t.Fatalf("DSN %s parsed as user %q, dbname %q, host %q", dsn, cfg.User, cfg.Database, cfg.Host)
+	}
+}
+
+func TestSelectHandlerChecksDelegation(t *testing.T) {
+	useFakeRows(t, [][]any{{"alice", "alice", time.Now()}})
+	appCfg.Krb5.CheckDelegation = true
+	appCfg.Krb5.ConfigPath = ""
+	appCfg.DB.Host = "db.ex.com"
+	queried := false
+	queryAsUser = func(context.Context, string, string, string, string, ...any) ([][]any, error) {
+		queried = true
+		return nil, nil
+	}
+
+	// ccache /run/krb5cc_1 не прочитать — билет к Postgres не получить, до запроса не доходит
+	w := serveSelect(t)
+	if w.Code != http.StatusUnauthorized || queried {
+		t.Fatalf("status = %d, queried = %v: %s", w.Code, queried, w.Body)
+	}
+}
+
+func TestSelectHandlerWithoutIdentity(t *testing.T) {
+	useFakeRows(t, [][]any{{"alice", "alice", time.Now()}})
+	queried := false
+	queryAsUser = func(context.Context, string, string, string, string, ...any) ([][]any, error) {
+		queried = true
+		return nil, nil
+	}
+
+	// Без пользователя DSN не собрать — даже degraded не пропускает к запросу
+	for _, policy := range []string{"reject", "degraded"} {
+		appCfg.Auth.NilIdentity = policy
+		w := httptest.NewRecorder()
+		TestSelectHandler(w, httptest.NewRequest(http.MethodGet, "/db", nil))
+		if w.Code != http.StatusUnauthorized || queried {
+			t.Fatalf("%s: status = %d, queried = %v: %s", policy, w.Code, queried, w.Body)
+		}
+		// Ровно один ответ: обработчик вернулся сразу после отказа
+		if code := errorCodeOf(t, w); code != CodeKrbMissing {
+			t.Fatalf("%s: code = %q", policy, code)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+const (
+	// Сбрасывать буфер клиенту каждые exportFlushRows строк
+	exportFlushRows = 1000
+	// Сколько клиенту дают на приём очередной порции: медленный читатель
+	// тормозит чтение из БД (backpressure), но не держит соединение вечно
+	exportWriteTimeout = 30 * time.Second
+)
+
+// queryAsUserStream — точка подмены pgx.QueryAsUserStream в тестах выгрузки.
+var queryAsUserStream = pgx.QueryAsUserStream
+
+// streamCSV выгружает результат query в CSV построчно: строки идут из курсора
+// Postgres прямо в ответ, буфер регулярно сбрасывается через http.Flusher.
+func streamCSV(w http.ResponseWriter, r *http.Request, dsn, ccache, query string) {
+	rc := http.NewResponseController(w)
+	cw := csv.NewWriter(w)
+	started := false
+	n := 0
+
+	flush := func() error {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		// Дедлайн на следующую порцию; ErrNotSupported — обёртка без дедлайнов
+		if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	err := queryAsUserStream(r.Context(), dsn, ccache, appCfg.Krb5.ConfigPath, query, func(columns []string, values []any) error {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="export.csv"`)
+			if err := cw.Write(columns); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		rec := make([]string, len(values))
+		for i, v := range values {
+			rec[i] = csvValue(v)
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+		if n++; n%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			fail(w, r, dbCode(err), http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Заголовки уже ушли — остаётся оборвать выгрузку и записать причину
+		metrics.Failure(metrics.BackendErr)
+		log.Printf("%s %s: export aborted after %d rows: %v", r.Method, r.URL.Path, n, err)
+		panic(http.ErrAbortHandler)
+	}
+	if !started {
+		writeEmptyResult(w)
+		return
+	}
+	flush()
+}
+
+func csvValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case []byte:
+		return string(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// flushRecorder считает сбросы буфера и запоминает, сколько байт ушло к каждому.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.Len())
+	f.ResponseRecorder.Flush()
+}
+
+// useExportRows подменяет потоковый запрос: fn получает rows, затем err.
+func useExportRows(t *testing.T, rows [][]any, err error) {
+	t.Helper()
+	useFakeRows(t, nil)
+	prev := queryAsUserStream
+	queryAsUserStream = func(_ context.Context, _, _, _, _ string, fn func([]string, []any) error, _ ...any) error {
+		for _, row := range rows {
+			if err := fn([]string{"current_user", "session_user", "now"}, row); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	t.Cleanup(func() { queryAsUserStream = prev })
+}
+
+func serveExport(t *testing.T) *flushRecorder {
+	t.Helper()
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM", ccache: "/run/krb5cc_1"})
+	r := httptest.NewRequest(http.MethodGet, "/test_db?format=csv", nil).WithContext(ctx)
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	TestSelectHandler(w, r)
+	return w
+}
+
+func TestExportCSVStreams(t *testing.T) {
+	ts := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rows := make([][]any, 2500)
+	for i := range rows {
+		rows[i] = []any{"alice", nil, ts}
+	}
+	useExportRows(t, rows, nil)
+
+	w := serveExport(t)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	recs, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2501 || strings.Join(recs[0], ",") != "current_user,session_user,now" {
+		t.Fatalf("got %d records, header %v", len(recs), recs[0])
+	}
+	if got := strings.Join(recs[1], ","); got != "alice,,2026-10-16T12:00:00Z" {
+		t.Fatalf("row = %q", got)
+	}
+	// Заголовок сразу, затем каждые exportFlushRows строк и в конце — строки
+	// уходят клиенту по мере чтения, а не одним куском
+	if len(w.flushed) != 4 {
+		t.Fatalf("flushes at %v bytes, want 4", w.flushed)
+	}
+	for i := 1; i < len(w.flushed); i++ {
+		if w.flushed[i] <= w.flushed[i-1] {
+			t.Fatalf("flushes at %v bytes", w.flushed)
+		}
+	}
+}
+
+func TestExportCSVErrors(t *testing.T) {
+	// Ошибка до первой строки — обычный JSON-ответ с кодом
+	useExportRows(t, nil, errors.New("connection refused"))
+	w := serveExport(t)
+	if w.Code != http.StatusInternalServerError || errorCodeOf(t, w.ResponseRecorder) != CodeDBError {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	// Пустой результат — как у JSON-ответа
+	useExportRows(t, nil, nil)
+	appCfg.DB.EmptyResult = "no_content"
+	if w := serveExport(t); w.Code != http.StatusNoContent {
+		t.Fatalf("empty export: status = %d", w.Code)
+	}
+
+	// Обрыв после заголовков: ответ прерывается, а не выдаётся за полный
+	useExportRows(t, [][]any{{"alice", "alice", time.Now()}}, errors.New("server closed the connection"))
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", r)
+		}
+	}()
+	serveExport(t)
+	t.Fatal("export with a mid-stream error completed")
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+// ErrorCode — стабильный машиночитаемый код ошибки в теле ответа. Клиенты
+// ветвятся по нему, а не по тексту сообщения; значения не переименовываются.
+type ErrorCode string
+
+const (
+	CodeKrbMissing      ErrorCode = "KRB_MISSING"       // нет identity после SPNEGO
+	CodeKrbNoDelegation ErrorCode = "KRB_NO_DELEGATION" // нет делегированных кредов
+	CodeKrbBadCCache    ErrorCode = "KRB_BAD_CCACHE"    // X_krb5ccname не разбирается или не читается
+	CodeKrbExpired      ErrorCode = "KRB_EXPIRED"       // TGT истёк, нужен повторный вход
+	CodeBadRequest      ErrorCode = "BAD_REQUEST"
+	CodeIPANotFound     ErrorCode = "IPA_NOT_FOUND"
+	CodeIPADuplicate    ErrorCode = "IPA_DUPLICATE"
+	CodeIPAAccessDenied ErrorCode = "IPA_ACCESS_DENIED"
+	CodeIPAAuthFailed   ErrorCode = "IPA_AUTH_FAILED"
+	CodeIPAInvalid      ErrorCode = "IPA_INVALID"
+	CodeIPAUnavailable  ErrorCode = "IPA_UNAVAILABLE"
+	CodeDBPermission    ErrorCode = "DB_PERMISSION_DENIED"
+	CodeDBAuthFailed    ErrorCode = "DB_AUTH_FAILED"
+	CodeDBTimeout       ErrorCode = "DB_TIMEOUT"
+	CodeDBError         ErrorCode = "DB_ERROR"
+	CodeForbidden       ErrorCode = "FORBIDDEN"         // нет нужной группы для маршрута
+	CodeRealmNotAllowed ErrorCode = "REALM_NOT_ALLOWED" // реалм не в auth.allowed_realms
+	CodeRealmBlocked    ErrorCode = "REALM_BLOCKED"     // реалм в auth.blocked_realms
+	CodeTooManyRequests ErrorCode = "TOO_MANY_REQUESTS" // превышен auth.max_in_flight
+	CodeNotReady        ErrorCode = "NOT_READY"
+	CodeInternal        ErrorCode = "INTERNAL"
+)
+
+// codeClasses — класс отказа для метрик по коду ответа.
+var codeClasses = map[ErrorCode]string{
+	CodeKrbMissing:      metrics.AuthMissing,
+	CodeKrbNoDelegation: metrics.AuthMissing,
+	CodeKrbBadCCache:    metrics.AuthMissing,
+	CodeKrbExpired:      metrics.AuthExpired,
+	CodeBadRequest:      metrics.BadRequest,
+	CodeIPANotFound:     metrics.BadRequest,
+	CodeIPADuplicate:    metrics.BadRequest,
+	CodeIPAAccessDenied: metrics.AuthzDenied,
+	CodeIPAAuthFailed:   metrics.AuthExpired,
+	CodeIPAInvalid:      metrics.BadRequest,
+	CodeDBPermission:    metrics.AuthzDenied,
+	CodeForbidden:       metrics.AuthzDenied,
+	CodeRealmNotAllowed: metrics.AuthzDenied,
+	CodeRealmBlocked:    metrics.AuthzDenied,
+	CodeDBAuthFailed:    metrics.AuthExpired,
+	CodeTooManyRequests: metrics.RateLimited,
+}
+
+func (c ErrorCode) class() string {
+	if class, ok := codeClasses[c]; ok {
+		return class
+	}
+	return metrics.BackendErr
+}
+
+// errorBody — единый JSON-конверт ошибки всех хэндлеров.
+type errorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Что клиенту сделать, чтобы повтор удался (например, "reauthenticate")
+	Action string `json:"action,omitempty"`
+}
+
+// fail отвечает ошибкой в JSON-конверте и учитывает её класс в метриках и
+// логе — так 401 от отсутствующих и от истёкших кредов различимы.
+func fail(w http.ResponseWriter, r *http.Request, code ErrorCode, status int, msg string) {
+	class := code.class()
+	metrics.Failure(class)
+	if code == CodeKrbExpired {
+		metrics.CredentialExpired()
+	}
+	log.Printf("%s %s: %s/%s (%d): %s", r.Method, r.URL.Path, class, code, status, msg)
+	body := errorBody{Code: code, Message: msg}
+	if code == CodeKrbExpired {
+		// Обновить билеты надо было уже: повторять сразу, но после kinit
+		// и с новым Negotiate
+		body.Action = "reauthenticate"
+		w.Header().Set("Retry-After", "0")
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// credentialCode — код отказа при проверке делегированных кредов.
+func credentialCode(err error) ErrorCode {
+	if errors.Is(err, pgx.ErrCredentialsExpired) {
+		return CodeKrbExpired
+	}
+	return CodeKrbNoDelegation
+}
+
+// dbCode — код по ошибке Postgres: 42501 (insufficient_privilege) — это
+// авторизация, класс 28 (invalid_authorization) — аутентификация,
+// 57014 (query_canceled) и истёкший контекст — таймаут.
+func dbCode(err error) ErrorCode {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrCredentialsExpired):
+		return CodeKrbExpired
+	case errors.Is(err, context.DeadlineExceeded), pgconn.Timeout(err):
+		return CodeDBTimeout
+	case errors.As(err, &pgErr) && pgErr.Code == "42501":
+		return CodeDBPermission
+	case errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "28"):
+		return CodeDBAuthFailed
+	case errors.As(err, &pgErr) && pgErr.Code == "57014":
+		return CodeDBTimeout
+	default:
+		return CodeDBError
+	}
+}
+
+// ipaCode — код по ошибке IPA, в тех же диапазонах, что и IPAError.HTTPStatus.
+func ipaCode(err error) ErrorCode {
+	var ipaErr *IPAError
+	if !errors.As(err, &ipaErr) {
+		return CodeIPAUnavailable
+	}
+	switch status := ipaErr.HTTPStatus(); {
+	case ipaErr.Code == IPAErrNotFound:
+		return CodeIPANotFound
+	case ipaErr.Code == IPAErrDuplicateEntry:
+		return CodeIPADuplicate
+	case status == http.StatusUnauthorized:
+		return CodeIPAAuthFailed
+	case status == http.StatusForbidden:
+		return CodeIPAAccessDenied
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return CodeIPAInvalid
+	default:
+		return CodeIPAUnavailable
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+func TestDBCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorCode
+	}{
+		{fmt.Errorf("connect: %w", pgx.ErrCredentialsExpired), CodeKrbExpired},
+		{context.DeadlineExceeded, CodeDBTimeout},
+		{&pgconn.PgError{Code: "57014"}, CodeDBTimeout},
+		{&pgconn.PgError{Code: "42501"}, CodeDBPermission},
+		{&pgconn.PgError{Code: "28000"}, CodeDBAuthFailed},
+		{&pgconn.PgError{Code: "28P01"}, CodeDBAuthFailed},
+		{&pgconn.PgError{Code: "42P01"}, CodeDBError},
+		{errors.New("broken pipe"), CodeDBError},
+	} {
+		if got := dbCode(tc.err); got != tc.want {
+			t.Errorf("dbCode(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestIPACode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorCode
+	}{
+		{&IPAError{Code: IPAErrNotFound}, CodeIPANotFound},
+		{&IPAError{Code: IPAErrDuplicateEntry}, CodeIPADuplicate},
+		{&IPAError{Code: 1100}, CodeIPAAuthFailed},
+		{&IPAError{Code: 2100}, CodeIPAAccessDenied},
+		{&IPAError{Code: 3005}, CodeIPAInvalid},
+		{&IPAError{Code: 4202}, CodeIPAInvalid},
+		{&IPAError{Code: 903}, CodeIPAUnavailable},
+		{errors.New("connection refused"), CodeIPAUnavailable},
+	} {
+		if got := ipaCode(tc.err); got != tc.want {
+			t.Errorf("ipaCode(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+// Отказ аутентификации и отказ авторизации различимы в классе и в логе
+func TestFailClassifies(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range []struct {
+		code   ErrorCode
+		status int
+		class  string
+	}{
+		{CodeKrbMissing, http.StatusUnauthorized, metrics.AuthMissing},
+		{CodeKrbExpired, http.StatusUnauthorized, metrics.AuthExpired},
+		{CodeDBPermission, http.StatusForbidden, metrics.AuthzDenied},
+		{CodeForbidden, http.StatusForbidden, metrics.AuthzDenied},
+		{CodeDBError, http.StatusBadGateway, metrics.BackendErr},
+	} {
+		logged.Reset()
+		w := httptest.NewRecorder()
+		fail(w, httptest.NewRequest(http.MethodGet, "/test_db", nil), tc.code, tc.status, "denied")
+		if w.Code != tc.status || errorCodeOf(t, w) != tc.code {
+			t.Errorf("%s: status = %d: %s", tc.code, w.Code, w.Body)
+		}
+		if want := fmt.Sprintf("GET /test_db: %s/%s (%d): denied", tc.class, tc.code, tc.status); !strings.Contains(logged.String(), want) {
+			t.Errorf("%s: log = %q, want %q", tc.code, logged.String(), want)
+		}
+		// Только истёкшие креды просят клиента войти заново
+		if reauth := w.Header().Get("WWW-Authenticate") == "Negotiate"; reauth != (tc.code == CodeKrbExpired) {
+			t.Errorf("%s: WWW-Authenticate = %q", tc.code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+// Конверт ошибки — ровно code, message и (для истёкших кредов) action
+func TestFailEnvelope(t *testing.T) {
+	for _, tc := range []struct {
+		code   ErrorCode
+		action string
+	}{
+		{CodeDBTimeout, ""},
+		{CodeKrbExpired, "reauthenticate"},
+	} {
+		w := httptest.NewRecorder()
+		fail(w, httptest.NewRequest(http.MethodGet, "/db", nil), tc.code, http.StatusUnauthorized, "boom")
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s: Content-Type = %q", tc.code, ct)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %q: %v", tc.code, w.Body, err)
+		}
+		want := map[string]string{"code": string(tc.code), "message": "boom"}
+		if tc.action != "" {
+			want["action"] = tc.action
+		}
+		if len(body) != len(want) {
+			t.Errorf("%s: body = %v, want %v", tc.code, body, want)
+		}
+		for k, v := range want {
+			if body[k] != v {
+				t.Errorf("%s: %s = %q, want %q", tc.code, k, body[k], v)
+			}
+		}
+	}
+}
+
+// Ошибки Postgres доходят до клиента стабильным кодом, а не текстом
+func TestSelectHandlerErrorCodes(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		want   ErrorCode
+	}{
+		{fmt.Errorf("connect: %w", pgx.ErrCredentialsExpired), http.StatusUnauthorized, CodeKrbExpired},
+		{&pgconn.PgError{Code: "42501", Message: "permission denied for table t"}, http.StatusInternalServerError, CodeDBPermission},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusInternalServerError, CodeDBTimeout},
+		{&pgconn.PgError{Code: "28000"}, http.StatusInternalServerError, CodeDBAuthFailed},
+	} {
+		useFakeRows(t, nil)
+		queryAsUser = func(context.Context, string, string, string, string, ...any) ([][]any, error) {
+			return nil, tc.err
+		}
+		w := serveSelect(t)
+		if w.Code != tc.status || errorCodeOf(t, w) != tc.want {
+			t.Errorf("%v: status = %d, body = %s; want %d %s", tc.err, w.Code, w.Body, tc.status, tc.want)
+		}
+	}
+}
+
+func TestIpaUserHandlerErrorCodes(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		status int
+		want   ErrorCode
+	}{
+		{"/user_show", http.StatusBadRequest, CodeBadRequest},
+		{"/user_show?uid=bob&attrs=bad%20attr", http.StatusBadRequest, CodeBadRequest},
+		{"/user_show?uid=nobody", http.StatusNotFound, CodeIPANotFound},
+	} {
+		newIPAStub(t, map[string]ipaMethod{"user_show": ipaUsers(nil)})
+		w := serveAs(http.HandlerFunc(IpaUserHandler), http.MethodGet, tc.target, "", "alice", "EX.COM")
+		if w.Code != tc.status || errorCodeOf(t, w) != tc.want {
+			t.Errorf("%s: status = %d, body = %s; want %d %s", tc.target, w.Code, w.Body, tc.status, tc.want)
+		}
+	}
+}
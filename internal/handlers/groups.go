@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// Почему групп из PAC нет. Вызывающий может откатиться на группы из IPA
+// (как Authorize) или отказать.
+var (
+	ErrPACDecodeDisabled = errors.New("PAC decoding is disabled (krb5.decode_pac)")
+	ErrNoPAC             = errors.New("ticket carries no PAC")
+	ErrNoIdentity        = errors.New("no authenticated identity in context")
+)
+
+// GroupsFromContext возвращает SID групп из PAC билета клиента (AD и IPA
+// с доверием к AD кладут их в KERB_VALIDATION_INFO).
+//
+// PAC расшифровывается ключом сервиса, поэтому в keytab должен быть ключ того
+// же enctype, которым KDC зашифровал билет (обычно aes256-cts-hmac-sha1-96;
+// с одним rc4-hmac в keytab PAC от AD не проверится, и SPNEGO отклонит билет).
+func GroupsFromContext(ctx context.Context) ([]string, error) {
+	if !appCfg.Krb5.DecodePAC {
+		return nil, ErrPACDecodeDisabled
+	}
+	id, ok := middleware.IdentityFromContext(ctx)
+	if !ok {
+		return nil, ErrNoIdentity
+	}
+	// Атрибуты PAC есть только у identity из SPNEGO (goidentity)
+	attrs, ok := id.(interface{ Attributes() map[string]interface{} })
+	if !ok {
+		return nil, ErrNoPAC
+	}
+	ad, ok := attrs.Attributes()[credentials.AttributeKeyADCredentials].(credentials.ADCredentials)
+	if !ok {
+		return nil, ErrNoPAC
+	}
+	return ad.GroupMembershipSIDs, nil
+}
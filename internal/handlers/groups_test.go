@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+func TestGroupsFromContext(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	appCfg.Krb5.DecodePAC = true
+	t.Cleanup(func() { appCfg = prev })
+
+	sids := []string{"S-1-5-21-1-2-3-512", "S-1-5-21-1-2-3-513"}
+	withPAC := credentials.New("alice", "EX.COM")
+	withPAC.SetADCredentials(credentials.ADCredentials{GroupMembershipSIDs: sids})
+	spnego := func(c *credentials.Credentials) context.Context {
+		return context.WithValue(context.Background(), goidentity.CTXKey, c)
+	}
+
+	// Identity из SPNEGO — как её положил SPNEGO и после middleware.Identify
+	var identified context.Context
+	r := httptest.NewRequest(http.MethodGet, "/groups", nil).WithContext(spnego(withPAC))
+	middleware.Identify(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		identified = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	for name, ctx := range map[string]context.Context{
+		"spnego":     spnego(withPAC),
+		"identified": identified,
+	} {
+		if got, err := GroupsFromContext(ctx); err != nil || !slices.Equal(got, sids) {
+			t.Errorf("%s: groups = %v, %v", name, got, err)
+		}
+	}
+
+	cases := map[string]struct {
+		ctx  context.Context
+		want error
+	}{
+		"no identity":       {context.Background(), ErrNoIdentity},
+		"no PAC":            {spnego(credentials.New("alice", "EX.COM")), ErrNoPAC},
+		"injected identity": {requestCtx("/run/krb5cc_alice"), ErrNoPAC},
+	}
+	for name, c := range cases {
+		if _, err := GroupsFromContext(c.ctx); !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", name, err, c.want)
+		}
+	}
+
+	appCfg.Krb5.DecodePAC = false
+	if _, err := GroupsFromContext(spnego(withPAC)); !errors.Is(err, ErrPACDecodeDisabled) {
+		t.Fatalf("decode_pac off: err = %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// HealthzHandler — liveness: процесс жив и обслуживает HTTP.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// ReadyzHandler — readiness: keytab читается и содержит все настроенные SPN.
+// Keytab перечитывается на каждый запрос, чтобы заметить ротацию или удаление файла.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkReady(); err != nil {
+		fail(w, r, CodeNotReady, http.StatusServiceUnavailable, "not ready: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ready\n"))
+}
+
+func checkReady() error {
+	kt, err := keytab.Load(appCfg.Krb5.KeytabPath)
+	if err != nil {
+		return fmt.Errorf("load keytab: %w", err)
+	}
+	var missing []string
+	for _, s := range appCfg.Krb5.SPNList() {
+		if !krb.KeytabHasSPN(kt, s) {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no keytab entry for %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+)
+
+// useKeytabFile пишет keytab с принципалами spns@EX.COM и настраивает на него appCfg.
+func useKeytabFile(t *testing.T, spns ...string) string {
+	t.Helper()
+	kt := keytab.New()
+	for _, spn := range spns {
+		if err := kt.AddEntry(spn, "EX.COM", "pw", time.Now(), 1, 18); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "krb5.keytab")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	appCfg.Krb5.KeytabPath = path
+	t.Cleanup(func() { appCfg = prev })
+	return path
+}
+
+func serveReadyz() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ReadyzHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return w
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	HealthzHandler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Fatalf("status = %d: %q", w.Code, w.Body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	path := useKeytabFile(t, "HTTP/app.ex.com", "HTTP/alias.ex.com")
+	appCfg.Krb5.SPN = "HTTP/app.ex.com,HTTP/alias.ex.com"
+	if w := serveReadyz(); w.Code != http.StatusOK || w.Body.String() != "ready\n" {
+		t.Fatalf("status = %d: %q", w.Code, w.Body)
+	}
+
+	// SPN без записи в keytab — не готов, и в ответе видно какой
+	appCfg.Krb5.SPN = "HTTP/app.ex.com,HTTP/new.ex.com"
+	w := serveReadyz()
+	var body errorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || body.Code != CodeNotReady || !strings.Contains(body.Message, "HTTP/new.ex.com") {
+		t.Fatalf("status = %d: %+v", w.Code, body)
+	}
+
+	// Keytab перечитывается на каждый запрос: удаление файла заметно сразу
+	appCfg.Krb5.SPN = "HTTP/app.ex.com"
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveReadyz(); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "load keytab") {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+}
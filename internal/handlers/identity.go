@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// identityFromRequest достаёт identity клиента (middleware.IdentityFromContext). Если её нет,
+// решает политика auth.nil_identity:
+//   - reject (по умолчанию) — ответ 401, хэндлер должен сразу вернуться (ok=false);
+//   - degraded — для хэндлеров, которые умеют работать без пользователя
+//     (degradable=true), возвращается (nil, true).
+func identityFromRequest(w http.ResponseWriter, r *http.Request, degradable bool) (middleware.Identity, bool) {
+	if id, ok := middleware.IdentityFromContext(r.Context()); ok {
+		metrics.AuthSucceeded(principalName(id))
+		return id, true
+	}
+	if degradable && appCfg.Auth.NilIdentity == "degraded" {
+		return nil, true
+	}
+	fail(w, r, CodeKrbMissing, http.StatusUnauthorized, "id is required")
+	return nil, false
+}
+
+func principalName(id middleware.Identity) string {
+	return id.UserName() + "@" + id.Domain()
+}
+
+// PrincipalFromContext — имя пользователя и реалм аутентифицированного клиента.
+// Реалм берётся из identity как есть (у клиентов из доверенных реалмов он свой,
+// регистр сохраняется — реалмы Kerberos регистрозависимы); если он пуст —
+// default_realm из krb5.conf (krb5.config_path). ok=false — identity нет
+// или реалм определить не удалось.
+func PrincipalFromContext(ctx context.Context) (user, realm string, ok bool) {
+	id, found := middleware.IdentityFromContext(ctx)
+	if !found || id.UserName() == "" {
+		return "", "", false
+	}
+	user, realm = id.UserName(), id.Domain()
+	if realm == "" {
+		realm = defaultRealm(appCfg.Krb5.ConfigPath)
+	}
+	return user, realm, realm != ""
+}
+
+// ipaRealm — реалм пользователей IPA: ipa.realm или default_realm из krb5.conf.
+func ipaRealm() string {
+	if appCfg.IPA.Realm != "" {
+		return appCfg.IPA.Realm
+	}
+	return defaultRealm(appCfg.Krb5.ConfigPath)
+}
+
+// ipaUID — uid записи IPA клиента id. ok=false — принципал не из реалма IPA
+// (или реалм IPA не известен): у alice@AD.EXAMPLE.ORG нет записи IPA, а
+// запись "alice" принадлежит другому человеку.
+func ipaUID(id middleware.Identity) (uid string, ok bool) {
+	realm := id.Domain()
+	if realm == "" {
+		realm = defaultRealm(appCfg.Krb5.ConfigPath)
+	}
+	if want := ipaRealm(); id.UserName() == "" || want == "" || realm != want {
+		return "", false
+	}
+	return id.UserName(), true
+}
+
+// callerUID — uid вызывающего для проверки ipa.admin_groups и «смотрит ли он
+// себя»; "" — принципал не из реалма IPA: такой вызывающий непривилегирован.
+func callerUID(id middleware.Identity) string {
+	uid, _ := ipaUID(id)
+	return uid
+}
+
+// krb5.conf читается один раз на путь: default_realm без перезапуска не меняется.
+var defaultRealms = struct {
+	sync.Mutex
+	byPath map[string]string
+}{byPath: map[string]string{}}
+
+// defaultRealm — default_realm из krb5.conf по path ("" — если не задан или
+// файл не читается).
+func defaultRealm(path string) string {
+	defaultRealms.Lock()
+	defer defaultRealms.Unlock()
+	if realm, ok := defaultRealms.byPath[path]; ok {
+		return realm
+	}
+	var realm string
+	if c, err := config.Load(path); err == nil {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	defaultRealms.byPath[path] = realm
+	return realm
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+func TestIdentityFromRequestNilPolicy(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+
+	for _, tc := range []struct {
+		policy     string
+		degradable bool
+		ok         bool // хэндлер продолжает без identity
+	}{
+		{"reject", false, false},
+		{"reject", true, false},
+		{"degraded", false, false},
+		{"degraded", true, true},
+	} {
+		appCfg.Auth.NilIdentity = tc.policy
+		w := httptest.NewRecorder()
+		id, ok := identityFromRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), tc.degradable)
+		if id != nil || ok != tc.ok {
+			t.Fatalf("%s degradable=%v: id = %v, ok = %v", tc.policy, tc.degradable, id, ok)
+		}
+		if tc.ok {
+			if w.Body.Len() != 0 {
+				t.Fatalf("%s degradable=%v: wrote %q", tc.policy, tc.degradable, w.Body)
+			}
+			continue
+		}
+		if w.Code != http.StatusUnauthorized || errorCodeOf(t, w) != CodeKrbMissing {
+			t.Fatalf("%s degradable=%v: status = %d: %s", tc.policy, tc.degradable, w.Code, w.Body)
+		}
+	}
+
+	// С identity политика не важна
+	appCfg.Auth.NilIdentity = "reject"
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM"})
+	w := httptest.NewRecorder()
+	id, ok := identityFromRequest(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), false)
+	if !ok || id == nil || principalName(id) != "alice@EX.COM" || w.Body.Len() != 0 {
+		t.Fatalf("id = %v, ok = %v, body %q", id, ok, w.Body)
+	}
+}
+
+func TestPrincipalFromContext(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+	appCfg.Krb5.ConfigPath = filepath.Join(t.TempDir(), "krb5.conf")
+	if err := os.WriteFile(appCfg.Krb5.ConfigPath, []byte("[libdefaults]\n default_realm = EX.COM\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		id          middleware.Identity
+		user, realm string
+		ok          bool
+	}{
+		{testIdentity{user: "alice", realm: "EX.COM"}, "alice", "EX.COM", true},
+		// Реалм доверенного домена и его регистр сохраняются
+		{testIdentity{user: "bob", realm: "Ad.Example.Org"}, "bob", "Ad.Example.Org", true},
+		// Без реалма — default_realm из krb5.conf
+		{testIdentity{user: "carol"}, "carol", "EX.COM", true},
+		{testIdentity{realm: "EX.COM"}, "", "", false},
+		{nil, "", "", false},
+	} {
+		ctx := context.Background()
+		if tc.id != nil {
+			ctx = middleware.WithIdentity(ctx, tc.id)
+		}
+		user, realm, ok := PrincipalFromContext(ctx)
+		if user != tc.user || realm != tc.realm || ok != tc.ok {
+			t.Errorf("%+v: PrincipalFromContext = %q, %q, %v; want %q, %q, %v", tc.id, user, realm, ok, tc.user, tc.realm, tc.ok)
+		}
+	}
+
+	// krb5.conf не читается — реалм не определить
+	appCfg.Krb5.ConfigPath = filepath.Join(t.TempDir(), "missing.conf")
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "carol"})
+	if user, realm, ok := PrincipalFromContext(ctx); ok || realm != "" {
+		t.Fatalf("without default_realm: %q, %q, %v", user, realm, ok)
+	}
+}
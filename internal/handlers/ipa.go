@@ -3,6 +3,8 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,43 +13,198 @@ import (
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
-	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/dnscache"
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+	"go-http-pgsql-krb5/pkg/redact"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// ---- Вспомогательные типы под ответ IPA JSON-RPC ----
-type ipaRPC struct {
-	Method string        `json:"method"`
-	Params []interface{} `json:"params"`
+// Неуспешный HTTP-статус от /ipa/session/json (401 — сессия протухла)
+type ipaHTTPError struct {
+	StatusCode int
+	Body       string
 }
 
-type ipaResp struct {
-	Result struct {
-		Result map[string]any `json:"result"`
-	} `json:"result"`
-	Error *struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
+func (e *ipaHTTPError) Error() string {
+	return fmt.Sprintf("json rpc HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// Коды ошибок IPA, на которые стоит реагировать отдельно
+const (
+	IPAErrInsufficientAccess = 2100
+	IPAErrNotFound           = 4001
+	IPAErrDuplicateEntry     = 4002
+	ipaErrOption             = 3005
+	ipaErrRequirement        = 3007
+	ipaErrValidation         = 3009
+	ipaErrEmptyModlist       = 4202
+)
+
+// IPAError — ошибка прикладного уровня IPA (метод отработал, но вернул error).
+// Транспортные ошибки (сеть, HTTP-статус, декодирование) этим типом не являются.
+type IPAError struct {
+	Method  string `json:"-"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *IPAError) Error() string {
+	return fmt.Sprintf("ipa %s error %d: %s", e.Method, e.Code, e.Message)
+}
+
+// HTTPStatus сопоставляет код IPA с HTTP-статусом по диапазонам ipalib.errors:
+// 1xxx — аутентификация, 2xxx — авторизация, 3xxx — ошибки вызова, 4xxx — выполнения.
+func (e *IPAError) HTTPStatus() int {
+	switch {
+	case e.Code == IPAErrNotFound:
+		return http.StatusNotFound
+	case e.Code == IPAErrDuplicateEntry:
+		return http.StatusConflict
+	case e.Code >= 1000 && e.Code < 2000:
+		return http.StatusUnauthorized
+	case e.Code >= 2000 && e.Code < 3000:
+		return http.StatusForbidden
+	case e.Code >= 3000 && e.Code < 4000:
+		return http.StatusBadRequest
+	case e.Code >= 4000 && e.Code < 5000:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// ---- Общий транспорт к IPA ----
+
+// Один транспорт на процесс, чтобы TLS-соединения к IPA переиспользовались между запросами.
+var ipaTransport = newIPATransport(90 * time.Second)
+
+// Предел тела ответа IPA, если ipa.max_response_bytes не задан
+const defaultIPAMaxResponseBytes = 10 << 20
+
+func newIPATransport(idleConnTimeout time.Duration) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.IdleConnTimeout = idleConnTimeout
+	return t
+}
+
+// ConfigureIPATransport задаёт IdleConnTimeout транспорта IPA, проверку
+// сертификата IPA (ipa.ca_file, ipa.insecure_skip_verify) и, если resolver
+// не nil, резолвит имена IPA через кэш DNS. Вызывать до старта сервера.
+func ConfigureIPATransport(idleConnTimeout time.Duration, resolver *dnscache.Resolver) error {
+	t := newIPATransport(idleConnTimeout)
+	tlsCfg, err := ipaTLSConfig(appCfg.IPA.CAFile, appCfg.IPA.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	t.TLSClientConfig = tlsCfg
+	if resolver != nil {
+		t.DialContext = resolver.DialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	}
+	ipaTransport = t
+	return nil
+}
+
+// ipaTLSConfig — TLS клиента IPA. caFile заменяет системное хранилище
+// (внутренний CA IPA, /etc/ipa/ca.crt); insecure отключает проверку и нужен
+// только в лабораторных стендах.
+func ipaTLSConfig(caFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("ipa.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ipa.ca_file: no PEM certificates in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if insecure {
+		log.Printf("WARNING: IPA TLS certificate verification is DISABLED (ipa.insecure_skip_verify) — development only")
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// StartIPAIdleReaper периодически закрывает простаивающие соединения к IPA,
+// чтобы не держать TLS-сессии к репликам, которые могли смениться, и
+// выбрасывает истёкшие сессии из кэша ipa.session_cache. Останавливается по ctx.
+func StartIPAIdleReaper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ipaTransport.CloseIdleConnections()
+				sweepIPASessions(time.Now())
+			}
+		}
+	}()
+}
+
+// WarmUpIPA открывает TLS-соединение к IPA через общий транспорт, чтобы оно
+// осталось в пуле. Ответ сервера не важен — важен сам handshake.
+func WarmUpIPA(ctx context.Context, ipaBaseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, strings.TrimRight(ipaBaseURL, "/")+"/ipa/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: ipaTransport}).Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
 }
 
 // ---- Логин в FreeIPA по Kerberos (чистый gokrb5) ----
+// Предел на один HTTP-вызов IPA, если у контекста вызывающего срок дальше
+// (или его нет). Срок берётся из контекста, а не из http.Client.Timeout:
+// иначе вызов переживал бы отменённый запрос клиента.
+const ipaCallTimeout = 10 * time.Second
+
+// ipaCallContext — ctx со сроком не позже чем через ipaCallTimeout.
+func ipaCallContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d, ok := ctx.Deadline(); ok && time.Until(d) <= ipaCallTimeout {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ipaCallTimeout)
+}
+
 func loginKerberos(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath string) (*http.Client, *http.Cookie, error) {
 	u, err := url.Parse(ipaBaseURL)
 	if err != nil {
 		return nil, nil, fmt.Errorf("ipa url: %w", err)
 	}
-	host := strings.ToLower(u.Hostname())
-	spn := "HTTP/" + host // SPN для HTTP Negotiate
+	// Negotiate-токен нельзя отправлять открытым текстом
+	if u.Scheme != "https" && !appCfg.IPA.AllowInsecureHTTP {
+		return nil, nil, fmt.Errorf("ipa url: refusing Kerberos login over %s, https required", u.Scheme)
+	}
+	spn := krb.ServiceSPN("HTTP", u.Hostname()) // SPN для HTTP Negotiate
 
 	// 1) Kerberos client из ccache
-	cc, err := credentials.LoadCCache(ccachePath)
+	cc, err := krb.LoadCCache(ctx, ccachePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("load ccache: %w", err)
 	}
@@ -63,43 +220,46 @@ func loginKerberos(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath str
 		return nil, nil, fmt.Errorf("kerb client: %w", err)
 	}
 
-	// 2) Получаем сервисный билет для HTTP/<host>
-	tkt, skey, err := cli.GetServiceTicket(spn)
+	// 2) Получаем сервисный билет для HTTP/<host> (из ipa.ticket_cache, если есть)
+	tkt, skey, err := ipaServiceTicket(cli, cc, krbCfg, spn, authenticatedPrincipal(ctx))
 	if err != nil {
 		return nil, nil, fmt.Errorf("service ticket for %s: %w", spn, err)
 	}
 
 	// 3) Собираем KRB5 AP_REQ (GSS-токен Kerberos)
-	gtok, err := spnego.NewKRB5TokenAPREQ(
+	gtok, err := krb.NewAPREQToken(
 		cli, tkt, skey,
 		[]int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf},
-		nil,
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("build AP_REQ: %w", err)
+		return nil, nil, fmt.Errorf("build AP_REQ for %s: %w", spn, err)
 	}
 	rawTok, err := gtok.Marshal()
 	if err != nil {
-		return nil, nil, fmt.Errorf("marshal AP_REQ: %w", err)
+		return nil, nil, fmt.Errorf("marshal AP_REQ for %s: %w", spn, err)
 	}
 	authz := "Negotiate " + base64.StdEncoding.EncodeToString(rawTok)
 
 	// 4) Делаем login_kerberos с заголовком Authorization
 	loginURL := strings.TrimRight(ipaBaseURL, "/") + "/ipa/session/login_kerberos"
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, loginURL, nil)
+	callCtx, cancel := ipaCallContext(ctx)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(callCtx, http.MethodGet, loginURL, nil)
 	req.Header.Set("Authorization", authz)
 	req.Header.Set("Accept", "application/json") // IPA так любит
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
+	// Без Timeout: срок задаёт контекст запроса (ipaCallContext), и тот же
+	// клиент потом ходит в JSON-RPC с тем же правилом
+	httpClient := &http.Client{Transport: ipaTransport}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, nil, fmt.Errorf("login_kerberos: %w", err)
+		return nil, nil, fmt.Errorf("login_kerberos: %w", redact.Error(err, "", ""))
 	}
 	io.Copy(io.Discard, resp.Body)
 	resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("login_kerberos HTTP %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("login_kerberos HTTP %d (spn %s)", resp.StatusCode, spn)
 	}
 
 	// 5) Ищем cookie сессии
@@ -116,91 +276,260 @@ func loginKerberos(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath str
 	return httpClient, ipaCookie, nil
 }
 
-func UserShow(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath, uid string) (map[string]any, error) {
-	httpClient, cookie, err := loginKerberos(ctx, ipaBaseURL, krb5ConfPath, ccachePath)
+// ipaTickets — кэш билетов HTTP/<ipa-host> между логинами (ipa.ticket_cache).
+// Без него каждый login_kerberos стоит TGS-REQ к KDC.
+var ipaTickets atomic.Pointer[krb.TicketCache]
+
+// SetIPATicketCache подменяет кэш билетов IPA; nil отключает кэширование.
+func SetIPATicketCache(c krb.TicketCache) {
+	if c == nil {
+		ipaTickets.Store(nil)
+		return
+	}
+	ipaTickets.Store(&c)
+}
+
+// ipaServiceTicket берёт билет к spn из кэша или у KDC. Кэш — по принципалу,
+// который проверил SPNEGO (authenticated): принципал ccache взят из файла и
+// ничем не подтверждён, поэтому без authenticated или при расхождении с ним
+// кэш не читается и не пополняется. Конец срока билета gokrb5 не отдаёт,
+// поэтому в кэш он кладётся до оценки сверху: не позже TGT и не позже
+// ticket_lifetime из krb5.conf от момента запроса.
+func ipaServiceTicket(cli *client.Client, cc *credentials.CCache, krbCfg *config.Config, spn, authenticated string) (messages.Ticket, types.EncryptionKey, error) {
+	cache := krb.TicketCache(krb.NoTicketCache{})
+	if c := ipaTickets.Load(); c != nil && authenticated != "" && authenticated == ccachePrincipal(cc) {
+		cache = *c
+	}
+	principal := authenticated
+	if tkt, key, ok := cache.Get(principal, spn); ok {
+		metrics.IPATicketCache(true)
+		return tkt, key, nil
+	}
+	start := time.Now()
+	tkt, key, err := cli.GetServiceTicket(spn)
+	if err != nil {
+		return tkt, key, err
+	}
+	metrics.IPATicketCache(false)
+	if tgt, ok := cc.GetEntry(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+cc.DefaultPrincipal.Realm)); ok {
+		end := tgt.EndTime
+		if lt := krbCfg.LibDefaults.TicketLifetime; lt > 0 && start.Add(lt).Before(end) {
+			end = start.Add(lt)
+		}
+		cache.Put(principal, spn, tkt, key, end)
+	}
+	return tkt, key, nil
+}
+
+// authenticatedPrincipal — принципал клиента, принятый SPNEGO ("" — не известен).
+func authenticatedPrincipal(ctx context.Context) string {
+	if id, ok := middleware.IdentityFromContext(ctx); ok {
+		return principalName(id)
+	}
+	return ""
+}
+
+// ccachePrincipal — принципал по умолчанию из ccache (user@REALM).
+func ccachePrincipal(cc *credentials.CCache) string {
+	return cc.DefaultPrincipal.PrincipalName.PrincipalNameString() + "@" + cc.DefaultPrincipal.Realm
+}
+
+// UserShow — запись пользователя uid. Без attrs — все атрибуты (all:true),
+// с attrs — только они (имена в нижнем регистре, см. parseAttrs).
+func UserShow(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath, uid string, attrs ...string) (map[string]any, error) {
+	sess, err := NewIPASession(ctx, ipaBaseURL, krb5ConfPath, ccachePath)
 	if err != nil {
 		return nil, err
 	}
 
-	payload := ipaRPC{
-		Method: "user_show",
-		Params: []any{
-			[]string{uid},               // позиционные
-			map[string]any{"all": true}, // именованные
-		},
+	info, err := sess.Call(ctx, "user_show",
+		[]any{uid},            // позиционные
+		userShowParams(attrs), // именованные
+	)
+	if err != nil || len(attrs) == 0 {
+		return info, err
+	}
+	return selectAttributes(info, attrs), nil
+}
+
+// userShowForCaller — UserShow, урезанный по правам вызывающего: не-админам
+// не отдаются ipa.restricted_attributes. Обе выборки идут в одной IPA-сессии.
+// caller — uid вызывающего из callerUID ("" — не пользователь IPA). Непустой
+// attrs оставляет в ответе только эти атрибуты.
+func userShowForCaller(ctx context.Context, sess *IPASession, uid, caller string, attrs []string) (map[string]any, error) {
+	info, err := sess.Call(ctx, "user_show", []any{uid}, userShowParams(attrs))
+	if err != nil {
+		return nil, err
+	}
+
+	var privileged bool
+	if caller != "" && caller == uid {
+		privileged = hasAnyGroup(info, appCfg.IPA.AdminGroups)
+	} else {
+		privileged, err = callerIsPrivileged(ctx, sess, caller)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !privileged {
+		info = filterAttributes(info, appCfg.IPA.RestrictedAttributes)
+	}
+	// Выбор attrs — после проверки прав: для неё нужны группы записи
+	if len(attrs) > 0 {
+		info = selectAttributes(info, attrs)
+	}
+	return info, nil
+}
+
+// IPACall вызывает произвольный метод IPA JSON-RPC (user_show, group_show, host_find, ...)
+// в уже открытой сессии. Возвращает result.result; если там массив (методы *_find),
+// возвращается весь result целиком — с ключами "result", "count", "truncated".
+func IPACall(ctx context.Context, client *http.Client, cookie *http.Cookie, baseURL, method string, positional []any, named map[string]any) (map[string]any, error) {
+	resp, err := ipaCallResp(ctx, client, cookie, baseURL, method, positional, named)
+	if err != nil {
+		return nil, err
 	}
-	body, _ := json.Marshal(payload)
+	return resp.legacyResult()
+}
 
-	jsonURL := strings.TrimRight(ipaBaseURL, "/") + "/ipa/session/json"
+// ipaCallResp — вызов без разбора result: форму выбирает вызывающий
+// (ResultObject или ResultList).
+func ipaCallResp(ctx context.Context, client *http.Client, cookie *http.Cookie, baseURL, method string, positional []any, named map[string]any) (*ipaResp, error) {
+	defer func(start time.Time) { metrics.ObserveIPA(method, time.Since(start)) }(time.Now())
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, jsonURL, bytes.NewReader(body))
+	payload := newIPARPC(method, positional, named, appCfg.IPA.APIVersion)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s: %w", method, err)
+	}
+
+	base := strings.TrimRight(baseURL, "/")
+	ctx, cancel := ipaCallContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/ipa/session/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("json rpc: %w", err)
+	}
 	req.AddCookie(cookie)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-
-	base := strings.TrimRight(ipaBaseURL, "/")
 	req.Header.Set("Referer", base+"/ipa")
 
-	resp, err := httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("json rpc: %w", err)
+		return nil, fmt.Errorf("json rpc: %w", redact.Error(err, "", ""))
 	}
 	defer resp.Body.Close()
 
+	limit := int64(appCfg.IPA.MaxResponseBytes)
+	if limit <= 0 {
+		limit = defaultIPAMaxResponseBytes
+	}
 	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("json rpc HTTP %d: %s", resp.StatusCode, string(b))
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, limit))
+		return nil, &ipaHTTPError{StatusCode: resp.StatusCode, Body: string(b)}
 	}
 
+	// Читаем на байт больше лимита, чтобы отличить "ровно лимит" от "больше"
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("json rpc: read %s response: %w", method, err)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("json rpc: %s response exceeds %d bytes", method, limit)
+	}
+	if appCfg.IPA.StrictJSON {
+		if err := checkDuplicateKeys(b); err != nil {
+			return nil, fmt.Errorf("json rpc: strict decoding of %s response: %w", method, err)
+		}
+	}
 	var out ipaResp
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	if err := json.Unmarshal(b, &out); err != nil {
 		return nil, fmt.Errorf("decode: %w", err)
 	}
 	if out.Error != nil {
-		return nil, fmt.Errorf("ipa error %d: %s", out.Error.Code, out.Error.Message)
+		out.Error.Method = method
+		return nil, out.Error
 	}
-	return out.Result.Result, nil
+	return &out, nil
 }
 
 func IpaUserHandler(w http.ResponseWriter, r *http.Request) {
-	ccacheRaw := r.Header.Get("X_krb5ccname")
-
-	if ccacheRaw == "" {
-		log.Println("no delegated credentials")
-		http.Error(w, "unauthorized ", http.StatusUnauthorized)
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
 		return
 	}
 
-	ccache := strings.Split(ccacheRaw, ":")[1]
+	// Без identity (режим degraded) вызывающий считается непривилегированным
+	id, ok := identityFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var caller, principal string
+	if id != nil {
+		caller, principal = callerUID(id), principalName(id)
+	}
 
 	uid := r.URL.Query().Get("uid")
 	if uid == "" {
-		http.Error(w, "uid is required", http.StatusBadRequest)
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, "uid is required")
+		return
+	}
+	uid, err := normalizeUID(uid)
+	if err != nil {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	// ?attrs=mail,uid,memberof — только эти атрибуты; без него — все
+	attrs, err := parseAttrs(r.URL.Query().Get("attrs"))
+	if err != nil {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if appCfg.Krb5.CheckDelegation {
+		if u, err := url.Parse(appCfg.IPA.BaseURL); err == nil {
+			spn := krb.ServiceSPN("HTTP", u.Hostname())
+			if err := pgx.CheckDelegatedTicket(ccache, appCfg.Krb5.ConfigPath, spn); err != nil {
+				fail(w, r, credentialCode(err), http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
 	defer cancel()
 
-	info, err := UserShow(ctx,
-		os.Getenv("FREEIPA_BASE_URL"), // напр. "https://ipa.example.com"
-		os.Getenv("KRB5_CONFIG_PATH"),
-		ccache,
-		uid,
-	)
+	info := cachedUserShow(principal, uid, attrs, r.URL.Query().Get("nocache") == "1")
+	if info == nil {
+		sess, err := ipaSessionFor(ctx, principal, ccache)
+		if err == nil {
+			info, err = userShowForCaller(ctx, sess, uid, caller, attrs)
+		}
+		if err != nil {
+			status := ipaErrorStatus(err)
+			fail(w, r, ipaCode(err), status, "ipa: "+err.Error())
+			return
+		}
+		storeUserShow(principal, uid, attrs, info)
+	}
 
-	if err != nil {
-		http.Error(w, "ipa: "+err.Error(), http.StatusBadGateway)
+	// Сначала кодируем в буфер: ошибка кодирования — чистый 500 без обрывка тела
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(info); err != nil {
+		fail(w, r, CodeInternal, http.StatusInternalServerError, "ipa: encode response: "+err.Error())
 		return
 	}
-
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	err = json.NewEncoder(w).Encode(info)
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
 
-	if err != nil {
-		http.Error(w, "ipa: "+err.Error(), http.StatusInternalServerError)
+// ipaErrorStatus сопоставляет ошибку IPA с HTTP-статусом ответа клиенту.
+func ipaErrorStatus(err error) int {
+	var ipaErr *IPAError
+	if errors.As(err, &ipaErr) {
+		return ipaErr.HTTPStatus()
 	}
-
-	w.WriteHeader(http.StatusOK)
-	return
+	return http.StatusBadGateway
 }
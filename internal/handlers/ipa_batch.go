@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// IPACommand — один вызов внутри batch.
+type IPACommand struct {
+	Method     string
+	Positional []any
+	Named      map[string]any
+}
+
+// IPAResult — итог одной команды batch: либо Result, либо Error. Status —
+// HTTP-подобный код, чтобы клиент видел, что прошло, а что нет и почему.
+type IPAResult struct {
+	Method string         `json:"method"`
+	Status int            `json:"status"`
+	Result map[string]any `json:"result,omitempty"`
+	Error  *IPAError      `json:"error,omitempty"`
+}
+
+// IPABatch выполняет команды одним вызовом batch. Порядок результатов
+// совпадает с порядком команд; ошибка отдельной команды не валит весь batch.
+func IPABatch(ctx context.Context, sess *IPASession, commands []IPACommand) ([]IPAResult, error) {
+	if len(commands) == 0 {
+		return nil, nil
+	}
+	calls := make([]any, 0, len(commands))
+	for _, c := range commands {
+		// версия нужна и каждой команде внутри batch, не только самому batch
+		rpc := newIPARPC(c.Method, c.Positional, c.Named, appCfg.IPA.APIVersion)
+		calls = append(calls, map[string]any{"method": rpc.Method, "params": rpc.Params})
+	}
+
+	res, err := sess.Call(ctx, "batch", calls, nil)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := res["results"].([]any)
+	if len(raw) != len(commands) {
+		return nil, fmt.Errorf("ipa batch: %d results for %d commands", len(raw), len(commands))
+	}
+
+	out := make([]IPAResult, len(commands))
+	for i, item := range raw {
+		out[i] = batchItemResult(commands[i].Method, item)
+	}
+	return out, nil
+}
+
+// В batch ошибка приходит строкой в "error" и кодом в "error_code",
+// а не объектом, как в обычном ответе.
+func batchItemResult(method string, item any) IPAResult {
+	m, _ := item.(map[string]any)
+	if msg, ok := m["error"].(string); ok && msg != "" {
+		code, _ := m["error_code"].(float64)
+		e := &IPAError{Method: method, Code: int(code), Message: msg}
+		return IPAResult{Method: method, Status: e.HTTPStatus(), Error: e}
+	}
+	result, _ := m["result"].(map[string]any)
+	return IPAResult{Method: method, Status: http.StatusOK, Result: result}
+}
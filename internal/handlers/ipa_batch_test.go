@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// batchResults — ответ batch: results как есть, без разбора команд.
+func batchResults(results ...any) ipaMethod {
+	return func([]any, map[string]any) (any, *IPAError) {
+		return map[string]any{"count": len(results), "results": results}, nil
+	}
+}
+
+func TestIPABatchPartialFailure(t *testing.T) {
+	stub := newIPAStub(t, map[string]ipaMethod{"batch": batchResults(
+		map[string]any{"result": map[string]any{"uid": []any{"alice"}}, "error": nil},
+		map[string]any{"error": "ghost: user not found", "error_code": float64(IPAErrNotFound)},
+		map[string]any{"error": "Insufficient access", "error_code": float64(2100)},
+	)})
+	sess, err := NewIPASession(context.Background(), appCfg.IPA.BaseURL, "", "/run/krb5cc_alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := IPABatch(context.Background(), sess, []IPACommand{
+		{Method: "user_show", Positional: []any{"alice"}},
+		{Method: "user_show", Positional: []any{"ghost"}},
+		{Method: "group_show", Positional: []any{"admins"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("results = %+v", res)
+	}
+	if res[0].Status != http.StatusOK || res[0].Error != nil || res[0].Result["uid"] == nil {
+		t.Fatalf("ok command = %+v", res[0])
+	}
+	if res[1].Status != http.StatusNotFound || res[1].Error == nil || res[1].Error.Code != IPAErrNotFound || res[1].Result != nil {
+		t.Fatalf("missing user = %+v", res[1])
+	}
+	if res[2].Method != "group_show" || res[2].Status != http.StatusForbidden || res[2].Error.Method != "group_show" {
+		t.Fatalf("denied command = %+v", res[2])
+	}
+
+	// Один вызов batch; у каждой команды внутри своя версия API
+	calls := stub.callsOf("batch")
+	if len(calls) != 1 || len(calls[0].Args) != 3 {
+		t.Fatalf("batch calls = %+v", calls)
+	}
+	for i, c := range calls[0].Args {
+		params, _ := c.(map[string]any)["params"].([]any)
+		named, _ := params[1].(map[string]any)
+		if named["version"] != appCfg.IPA.APIVersion {
+			t.Fatalf("command %d params = %v, want version %s", i, params, appCfg.IPA.APIVersion)
+		}
+	}
+}
+
+func TestIPABatchResultCountMismatch(t *testing.T) {
+	stub := newIPAStub(t, map[string]ipaMethod{"batch": batchResults(map[string]any{"result": map[string]any{}})})
+	sess, err := NewIPASession(context.Background(), appCfg.IPA.BaseURL, "", "/run/krb5cc_alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IPABatch(context.Background(), sess, []IPACommand{{Method: "user_show"}, {Method: "group_show"}}); err == nil {
+		t.Fatal("1 result for 2 commands accepted")
+	}
+	// Пустой batch в IPA не уходит
+	if res, err := IPABatch(context.Background(), sess, nil); res != nil || err != nil || len(stub.callsOf("batch")) != 1 {
+		t.Fatalf("empty batch: %v, %v, calls %v", res, err, stub.called())
+	}
+}
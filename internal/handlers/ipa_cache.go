@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-http-pgsql-krb5/internal/metrics"
+)
+
+// userShowCache — LRU-кэш ответов user_show с TTL. Ключ — (принципал, uid, attrs):
+// IPA применяет ACL вызывающего, а userShowForCaller урезает атрибуты по его
+// группам, так что ответ одному принципалу другому не отдаётся.
+type userShowCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	lru     *list.List // front — самая свежая запись
+	byKey   map[userShowKey]*list.Element
+}
+
+type userShowKey struct{ principal, uid, attrs string }
+
+func newUserShowKey(principal, uid string, attrs []string) userShowKey {
+	return userShowKey{principal, uid, strings.Join(attrs, ",")}
+}
+
+type userShowEntry struct {
+	key     userShowKey
+	info    map[string]any
+	expires time.Time
+}
+
+func newUserShowCache(ttl time.Duration, maxSize int) *userShowCache {
+	return &userShowCache{ttl: ttl, maxSize: maxSize, lru: list.New(), byKey: map[userShowKey]*list.Element{}}
+}
+
+// get — живой ответ из кэша или nil. Возвращённую карту не менять: она общая.
+func (c *userShowCache) get(key userShowKey, now time.Time) map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byKey[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*userShowEntry)
+	if !now.Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.byKey, e.key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e.info
+}
+
+func (c *userShowCache) put(key userShowKey, info map[string]any, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.byKey[key]; ok {
+		e := el.Value.(*userShowEntry)
+		e.info, e.expires = info, now.Add(c.ttl)
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.byKey[key] = c.lru.PushFront(&userShowEntry{key: key, info: info, expires: now.Add(c.ttl)})
+	for c.lru.Len() > c.maxSize {
+		old := c.lru.Back()
+		c.lru.Remove(old)
+		delete(c.byKey, old.Value.(*userShowEntry).key)
+	}
+}
+
+var userShows atomic.Pointer[userShowCache]
+
+// SetUserShowCache включает кэш ответов /user_show на ttl, не больше maxSize
+// записей (вытесняются давно не читанные); ttl <= 0 или maxSize <= 0 — выключает.
+func SetUserShowCache(ttl time.Duration, maxSize int) {
+	if ttl <= 0 || maxSize <= 0 {
+		userShows.Store(nil)
+		return
+	}
+	userShows.Store(newUserShowCache(ttl, maxSize))
+}
+
+// cachedUserShow — ответ из кэша для принципала; без принципала (degraded)
+// или при ?nocache=1 кэш не читается.
+func cachedUserShow(principal, uid string, attrs []string, bypass bool) map[string]any {
+	c := userShows.Load()
+	if c == nil || principal == "" || bypass {
+		return nil
+	}
+	info := c.get(newUserShowKey(principal, uid, attrs), time.Now())
+	metrics.IPAUserShowCache(info != nil)
+	return info
+}
+
+// storeUserShow кладёт свежий ответ в кэш (и после ?nocache=1 — он обновляет запись).
+func storeUserShow(principal, uid string, attrs []string, info map[string]any) {
+	if c := userShows.Load(); c != nil && principal != "" {
+		c.put(newUserShowKey(principal, uid, attrs), info, time.Now())
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UserFindOptions — именованные параметры user_find. Нулевые значения не
+// передаются, и действуют умолчания сервера IPA.
+type UserFindOptions struct {
+	SizeLimit int  // sizelimit: максимум записей
+	TimeLimit int  // timelimit: секунд на поиск в LDAP
+	PkeyOnly  bool // pkey_only: только uid, без остальных атрибутов
+}
+
+func (o UserFindOptions) named() map[string]any {
+	named := map[string]any{}
+	if o.SizeLimit > 0 {
+		named["sizelimit"] = o.SizeLimit
+	}
+	if o.TimeLimit > 0 {
+		named["timelimit"] = o.TimeLimit
+	}
+	if o.PkeyOnly {
+		named["pkey_only"] = true
+	} else {
+		named["all"] = true
+	}
+	return named
+}
+
+// UserFindResult — найденные записи и флаги ответа IPA: Count — сколько
+// записей вернулось, Truncated — упёрлись в sizelimit/timelimit.
+type UserFindResult struct {
+	Users     []map[string]any `json:"users"`
+	Count     int              `json:"count"`
+	Truncated bool             `json:"truncated"`
+}
+
+// UserFind ищет пользователей по criteria (подстрока в uid, имени, почте…).
+// В отличие от user_show, result.result здесь — массив записей.
+func UserFind(ctx context.Context, ipaBaseURL, krb5ConfPath, ccachePath string, criteria string, opts UserFindOptions) (*UserFindResult, error) {
+	sess, err := NewIPASession(ctx, ipaBaseURL, krb5ConfPath, ccachePath)
+	if err != nil {
+		return nil, err
+	}
+	return userFind(ctx, sess, criteria, opts)
+}
+
+func userFind(ctx context.Context, sess *IPASession, criteria string, opts UserFindOptions) (*UserFindResult, error) {
+	var positional []any
+	if criteria != "" {
+		positional = []any{criteria}
+	}
+	resp, err := sess.callResp(ctx, "user_find", positional, opts.named())
+	if err != nil {
+		return nil, err
+	}
+	users, err := resp.ResultList()
+	if err != nil {
+		return nil, err
+	}
+	env, err := resp.envelope()
+	if err != nil {
+		return nil, err
+	}
+	out := &UserFindResult{Users: users, Count: len(users)}
+	if n, ok := env["count"].(float64); ok {
+		out.Count = int(n)
+	}
+	out.Truncated, _ = env["truncated"].(bool)
+	return out, nil
+}
+
+// UserFindHandler — GET /user_find?q=...&limit=...[&pkey_only=1]. Для
+// не-админов ipa.restricted_attributes вырезаются из каждой записи.
+func UserFindHandler(w http.ResponseWriter, r *http.Request) {
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
+	id, ok := identityFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var caller, principal string
+	if id != nil {
+		caller, principal = callerUID(id), principalName(id)
+	}
+
+	q := r.URL.Query()
+	opts := UserFindOptions{PkeyOnly: q.Get("pkey_only") == "1"}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			fail(w, r, CodeBadRequest, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		opts.SizeLimit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	sess, err := ipaSessionFor(ctx, principal, ccache)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	found, err := userFind(ctx, sess, q.Get("q"), opts)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	privileged, err := callerIsPrivileged(ctx, sess, caller)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	if !privileged {
+		for i, u := range found.Users {
+			found.Users[i] = filterAttributes(u, appCfg.IPA.RestrictedAttributes)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(found)
+}
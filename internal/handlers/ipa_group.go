@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GroupShow возвращает запись группы IPA (group_show --all).
+func GroupShow(ctx context.Context, baseURL, krb5ConfPath, ccachePath, cn string) (map[string]any, error) {
+	sess, err := NewIPASession(ctx, baseURL, krb5ConfPath, ccachePath)
+	if err != nil {
+		return nil, err
+	}
+	return sess.Call(ctx, "group_show", []any{cn}, map[string]any{"all": true})
+}
+
+// GroupMembers — плоский состав группы с учётом вложенных групп.
+type GroupMembers struct {
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"` // все раскрытые вложенные группы
+	// Truncated — остались вложенные группы глубже depth
+	Truncated bool `json:"truncated"`
+}
+
+// ExpandGroupMembers обходит member_group вглубь не дальше depth уровней и
+// собирает member_user всех встреченных групп без повторов. Уже посещённые
+// группы не раскрываются повторно, так что циклы во вложенности безопасны.
+func ExpandGroupMembers(ctx context.Context, sess *IPASession, cn string, depth int) (*GroupMembers, error) {
+	out := &GroupMembers{Users: []string{}, Groups: []string{}}
+	seenUsers := map[string]bool{}
+	visited := map[string]bool{strings.ToLower(cn): true}
+	level := []string{cn}
+	for d := 0; len(level) > 0; d++ {
+		var next []string
+		for _, g := range level {
+			entry, err := sess.Call(ctx, "group_show", []any{g}, nil)
+			if err != nil {
+				return nil, fmt.Errorf("group_show %s: %w", g, err)
+			}
+			for _, u := range stringList(entry["member_user"]) {
+				if !seenUsers[u] {
+					seenUsers[u] = true
+					out.Users = append(out.Users, u)
+				}
+			}
+			for _, sub := range stringList(entry["member_group"]) {
+				key := strings.ToLower(sub)
+				if visited[key] {
+					continue
+				}
+				if d >= depth {
+					out.Truncated = true
+					continue
+				}
+				visited[key] = true
+				out.Groups = append(out.Groups, sub)
+				next = append(next, sub)
+			}
+		}
+		level = next
+	}
+	slices.Sort(out.Users)
+	slices.Sort(out.Groups)
+	return out, nil
+}
+
+func stringList(v any) []string {
+	raw, _ := v.([]any)
+	out := make([]string, 0, len(raw))
+	for _, x := range raw {
+		if s, ok := x.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// GroupShowHandler — GET /group_show?cn=...[&expand=true]. С expand в ответ
+// добавляется "members" — плоский состав с вложенными группами до
+// ipa.group_expand_depth уровней.
+func GroupShowHandler(w http.ResponseWriter, r *http.Request) {
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
+	id, ok := identityFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var principal string
+	if id != nil {
+		principal = principalName(id)
+	}
+
+	cn := strings.TrimSpace(r.URL.Query().Get("cn"))
+	if !ipaUIDPattern.MatchString(cn) {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, fmt.Sprintf("invalid group name %q", cn))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	sess, err := ipaSessionFor(ctx, principal, ccache)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	group, err := sess.Call(ctx, "group_show", []any{cn}, map[string]any{"all": true})
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("expand") == "true" {
+		members, err := ExpandGroupMembers(ctx, sess, cn, appCfg.IPA.GroupExpandDepth)
+		if err != nil {
+			fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+			return
+		}
+		group["members"] = members
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(group)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// checkDuplicateKeys проходит JSON потоком токенов и возвращает ошибку на
+// первом повторном ключе объекта (encoding/json молча берёт последний).
+// Путь в ошибке — ключи от корня, например "result.result.uid".
+func checkDuplicateKeys(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	type frame struct {
+		object bool
+		keys   map[string]bool
+		path   string
+		key    bool // следующий токен объекта — ключ
+	}
+	var stack []*frame
+	path := func(k string) string {
+		if len(stack) == 0 || stack[len(stack)-1].path == "" {
+			return k
+		}
+		return stack[len(stack)-1].path + "." + k
+	}
+	var pending string // путь значения, которое сейчас читаем
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if k, ok := tok.(string); ok && top != nil && top.object && top.key {
+			if top.keys[k] {
+				return fmt.Errorf("duplicate key %q", path(k))
+			}
+			top.keys[k] = true
+			top.key = false
+			pending = path(k)
+			continue
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{object: true, keys: map[string]bool{}, path: pending, key: true})
+			continue
+		case json.Delim('['):
+			stack = append(stack, &frame{path: pending})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+		// значение прочитано — в объекте дальше снова ключ
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+			if top.object {
+				top.key = true
+			}
+			pending = top.path
+		}
+	}
+}
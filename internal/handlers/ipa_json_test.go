@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+)
+
+func TestCheckDuplicateKeys(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"a":1,"b":{"a":2},"c":[{"a":3},{"a":4}]}`:                 "",
+		`[{"k":1},{"k":2}]`:                                         "",
+		`{"result":{"result":{"uid":["alice"],"uid":["mallory"]}}}`: `duplicate key "result.result.uid"`,
+		`{"a":1,"a":2}`:                                             `duplicate key "a"`,
+		`{"list":[{"x":1,"y":2,"x":3}]}`:                            `duplicate key "list.x"`,
+		`{"a":{"b":{}},"c":{"d":1},"c":{"e":2}}`:                    `duplicate key "c"`,
+		`{"a":[1,{"b":[{"c":1}]}],"d":1,"e":"d"}`:                   "",
+	} {
+		err := checkDuplicateKeys([]byte(in))
+		if want == "" && err != nil || want != "" && (err == nil || err.Error() != want) {
+			t.Errorf("%s: err = %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestIPACallStrictJSON(t *testing.T) {
+	const body = `{"result":{"result":{"uid":["alice"],"uid":["mallory"]}},"error":null}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+
+	call := func() (*ipaResp, error) {
+		return ipaCallResp(context.Background(), srv.Client(), &http.Cookie{Name: "ipa_session", Value: "s"}, srv.URL, "user_show", nil, nil)
+	}
+	// По умолчанию encoding/json берёт последний ключ
+	if _, err := call(); err != nil {
+		t.Fatalf("lenient: %v", err)
+	}
+	appCfg.IPA.StrictJSON = true
+	_, err := call()
+	if err == nil || !strings.Contains(err.Error(), `strict decoding of user_show response: duplicate key "result.result.uid"`) {
+		t.Fatalf("strict: err = %v", err)
+	}
+}
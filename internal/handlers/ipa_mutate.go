@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// IPAMutation — итог изменяющего вызова. В dry-run Result пуст, а Action
+// описывает, что произошло бы при реальном вызове.
+type IPAMutation struct {
+	Method string         `json:"method"`
+	DryRun bool           `json:"dry_run"`
+	Action string         `json:"action"`
+	Params map[string]any `json:"params"`
+	Result map[string]any `json:"result,omitempty"`
+}
+
+// Атрибуты, без которых IPA не создаст пользователя.
+var userAddRequired = []string{"givenname", "sn"}
+
+// UserAdd создаёт пользователя uid. При dryRun сверяет атрибуты со схемой
+// user_add на сервере (json_metadata) и проверяет отсутствие такого
+// пользователя, но user_add не вызывает. Право на создание записи IPA
+// проверит только при реальном вызове.
+func UserAdd(ctx context.Context, sess *IPASession, uid string, attrs map[string]any, dryRun bool) (*IPAMutation, error) {
+	if uid == "" {
+		return nil, &IPAError{Method: "user_add", Code: ipaErrValidation, Message: "uid is required"}
+	}
+	for _, k := range userAddRequired {
+		if v, _ := attrs[k].(string); v == "" {
+			return nil, &IPAError{Method: "user_add", Code: ipaErrRequirement, Message: k + " is required"}
+		}
+	}
+
+	m := &IPAMutation{Method: "user_add", DryRun: dryRun, Action: "create", Params: attrs}
+	if !dryRun {
+		res, err := sess.Call(ctx, "user_add", []any{uid}, attrs)
+		if err != nil {
+			return nil, err
+		}
+		m.Result = res
+		return m, nil
+	}
+
+	if err := validateOptions(ctx, sess, "user_add", attrs); err != nil {
+		return nil, err
+	}
+	// Серверная проверка: существующий uid дал бы DuplicateEntry
+	_, err := sess.Call(ctx, "user_show", []any{uid}, nil)
+	var ipaErr *IPAError
+	switch {
+	case err == nil:
+		return nil, &IPAError{Method: "user_add", Code: IPAErrDuplicateEntry, Message: fmt.Sprintf("user with name %q already exists", uid)}
+	case errors.As(err, &ipaErr) && ipaErr.Code == IPAErrNotFound:
+		return m, nil
+	default:
+		return nil, err
+	}
+}
+
+// UserMod меняет атрибуты пользователя uid. При dryRun сверяет атрибуты со
+// схемой user_mod, проверяет, что пользователь существует, у вызывающего есть
+// право записи каждого атрибута (attributelevelrights) и изменение что-то
+// меняет, но user_mod не вызывает.
+func UserMod(ctx context.Context, sess *IPASession, uid string, attrs map[string]any, dryRun bool) (*IPAMutation, error) {
+	if uid == "" {
+		return nil, &IPAError{Method: "user_mod", Code: ipaErrValidation, Message: "uid is required"}
+	}
+	if len(attrs) == 0 {
+		return nil, &IPAError{Method: "user_mod", Code: ipaErrEmptyModlist, Message: "no modifications to be performed"}
+	}
+
+	m := &IPAMutation{Method: "user_mod", DryRun: dryRun, Action: "modify", Params: attrs}
+	if !dryRun {
+		res, err := sess.Call(ctx, "user_mod", []any{uid}, attrs)
+		if err != nil {
+			return nil, err
+		}
+		m.Result = res
+		return m, nil
+	}
+
+	if err := validateOptions(ctx, sess, "user_mod", attrs); err != nil {
+		return nil, err
+	}
+	cur, err := sess.Call(ctx, "user_show", []any{uid}, map[string]any{"all": true, "rights": true})
+	if err != nil {
+		return nil, err
+	}
+	// Права IPA считает на каждый LDAP-атрибут записи для того, кто спрашивает.
+	// Параметры без одноимённого атрибута (addattr и т.п.) проверит user_mod.
+	rights, _ := cur["attributelevelrights"].(map[string]any)
+	for k := range attrs {
+		if r, ok := rights[strings.ToLower(k)].(string); ok && !strings.Contains(r, "w") {
+			return nil, &IPAError{Method: "user_mod", Code: IPAErrInsufficientAccess, Message: fmt.Sprintf("Insufficient access: no write access to attribute %q", k)}
+		}
+	}
+	changed := false
+	for k, v := range attrs {
+		if !attrEquals(cur[k], v) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil, &IPAError{Method: "user_mod", Code: ipaErrEmptyModlist, Message: "no modifications to be performed"}
+	}
+	return m, nil
+}
+
+// IPA отдаёт атрибуты списками: ["Alice"] равно "Alice".
+func attrEquals(cur, want any) bool {
+	if list, ok := cur.([]any); ok && len(list) == 1 {
+		cur = list[0]
+	}
+	return fmt.Sprint(cur) == fmt.Sprint(want)
+}
+
+// ipaOption — описание параметра команды в json_metadata IPA.
+type ipaOption struct {
+	Name       string `json:"name"`
+	Required   bool   `json:"required"`
+	Autofill   bool   `json:"autofill"`
+	Multivalue bool   `json:"multivalue"`
+	MaxLength  int    `json:"maxlength"`
+	Pattern    string `json:"pattern"`
+	PatternMsg string `json:"pattern_errmsg"`
+}
+
+// validateOptions сверяет attrs с параметрами command, которые отдаёт сам IPA
+// (json_metadata): неизвестные параметры, обязательные без значения,
+// несколько значений для однозначного, maxlength и pattern. Так dry-run ловит
+// то же, что отверг бы настоящий вызов, до записи в LDAP.
+func validateOptions(ctx context.Context, sess *IPASession, command string, attrs map[string]any) error {
+	meta, err := sess.Call(ctx, "json_metadata", nil, map[string]any{"command": command})
+	if err != nil {
+		return err
+	}
+	commands, _ := meta["commands"].(map[string]any)
+	spec, ok := commands[command].(map[string]any)
+	if !ok {
+		return fmt.Errorf("ipa: json_metadata has no command %s", command)
+	}
+	raw, err := json.Marshal(spec["takes_options"])
+	if err != nil {
+		return err
+	}
+	var opts []ipaOption
+	if err := json.Unmarshal(raw, &opts); err != nil {
+		return fmt.Errorf("ipa: json_metadata %s: %w", command, err)
+	}
+
+	known := make(map[string]ipaOption, len(opts))
+	for _, o := range opts {
+		known[o.Name] = o
+		if _, set := attrs[o.Name]; o.Required && !o.Autofill && !set {
+			return &IPAError{Method: command, Code: ipaErrRequirement, Message: fmt.Sprintf("'%s' is required", o.Name)}
+		}
+	}
+	for k, v := range attrs {
+		o, ok := known[k]
+		if !ok {
+			return &IPAError{Method: command, Code: ipaErrOption, Message: fmt.Sprintf("Unknown option: %s", k)}
+		}
+		vals, multi := v.([]any)
+		if !multi {
+			vals = []any{v}
+		} else if !o.Multivalue {
+			return &IPAError{Method: command, Code: ipaErrValidation, Message: fmt.Sprintf("invalid '%s': Only one value is allowed", k)}
+		}
+		for _, val := range vals {
+			str, ok := val.(string)
+			if !ok {
+				continue
+			}
+			if o.MaxLength > 0 && utf8.RuneCountInString(str) > o.MaxLength {
+				return &IPAError{Method: command, Code: ipaErrValidation, Message: fmt.Sprintf("invalid '%s': can be at most %d characters", k, o.MaxLength)}
+			}
+			// Шаблоны IPA — регулярки Python; несовместимые с RE2 оставляем серверу
+			if re, err := regexp.Compile(o.Pattern); o.Pattern != "" && err == nil && !re.MatchString(str) {
+				msg := o.PatternMsg
+				if msg == "" {
+					msg = "must match pattern " + o.Pattern
+				}
+				return &IPAError{Method: command, Code: ipaErrValidation, Message: fmt.Sprintf("invalid '%s': %s", k, msg)}
+			}
+		}
+	}
+	return nil
+}
+
+// Предел тела запроса на изменение записи IPA
+const maxMutationBody = 64 << 10
+
+// mutationRequest — тело POST /user_add и /user_mod: uid и атрибуты записи IPA.
+type mutationRequest struct {
+	UID   string         `json:"uid"`
+	Attrs map[string]any `json:"attrs"`
+}
+
+// decodeMutation разбирает тело запроса на изменение; ok=false — ответ уже отправлен.
+func decodeMutation(w http.ResponseWriter, r *http.Request) (mutationRequest, bool) {
+	var req mutationRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return req, false
+	}
+	uid, err := normalizeUID(req.UID)
+	if err != nil {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, err.Error())
+		return req, false
+	}
+	req.UID = uid
+	return req, true
+}
+
+// UserAddHandler — POST /user_add {"uid":..., "attrs":{...}}[?dry_run=1]:
+// создаёт пользователя IPA под делегированными кредами вызывающего (права на
+// запись проверяет сам IPA). Ответ — IPAMutation: 201 при создании, 200 в dry-run.
+func UserAddHandler(w http.ResponseWriter, r *http.Request) {
+	serveMutation(w, r, UserAdd, http.StatusCreated)
+}
+
+// UserModHandler — POST /user_mod {"uid":..., "attrs":{...}}[?dry_run=1]:
+// меняет атрибуты пользователя IPA под делегированными кредами вызывающего.
+// Ответ — IPAMutation, 200.
+func UserModHandler(w http.ResponseWriter, r *http.Request) {
+	serveMutation(w, r, UserMod, http.StatusOK)
+}
+
+type mutateFunc func(ctx context.Context, sess *IPASession, uid string, attrs map[string]any, dryRun bool) (*IPAMutation, error)
+
+// serveMutation — общий путь изменяющих хэндлеров: creds, тело, сессия IPA,
+// вызов mutate. status — код ответа при реальном изменении, dry-run — 200.
+func serveMutation(w http.ResponseWriter, r *http.Request, mutate mutateFunc, status int) {
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
+	id, ok := identityFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+	req, ok := decodeMutation(w, r)
+	if !ok {
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "1"
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	sess, err := ipaSessionFor(ctx, principalName(id), ccache)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	m, err := mutate(ctx, sess, req.UID, req.Attrs, dryRun)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	if dryRun {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(m)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// userMetadata — json_metadata для user_add/user_mod в форме, которую отдаёт IPA.
+func userMetadata(args []any, named map[string]any) (any, *IPAError) {
+	opts := []map[string]any{
+		{"name": "givenname", "required": true, "maxlength": 20},
+		{"name": "sn", "required": true},
+		{"name": "cn", "required": true, "autofill": true},
+		{"name": "mail", "multivalue": true, "pattern": "^[^@ ]+@[^@ ]+$", "pattern_errmsg": "invalid e-mail format"},
+		{"name": "title"},
+	}
+	if named["command"] == "user_mod" {
+		for _, o := range opts {
+			o["required"] = false
+		}
+	}
+	cmd, _ := named["command"].(string)
+	return map[string]any{"commands": map[string]any{cmd: map[string]any{"takes_options": opts}}}, nil
+}
+
+func mutateStub(t *testing.T) *ipaStub {
+	t.Helper()
+	return newIPAStub(t, map[string]ipaMethod{
+		"json_metadata": userMetadata,
+		"user_show": func(args []any, named map[string]any) (any, *IPAError) {
+			if args[0] != "bob" {
+				return nil, &IPAError{Code: IPAErrNotFound, Message: "user not found"}
+			}
+			u := map[string]any{"uid": []any{"bob"}, "givenname": []any{"Bob"}, "title": []any{"dev"}}
+			if named["rights"] == true {
+				u["attributelevelrights"] = map[string]any{"givenname": "rsc", "title": "rscwo", "mail": "rscwo"}
+			}
+			return u, nil
+		},
+		"user_add": func(args []any, named map[string]any) (any, *IPAError) { return named, nil },
+		"user_mod": func(args []any, named map[string]any) (any, *IPAError) { return named, nil },
+	})
+}
+
+func TestUserAddDryRun(t *testing.T) {
+	cases := []struct {
+		name, body string
+		status     int
+		want       string
+	}{
+		{"valid", `{"uid":"dave","attrs":{"givenname":"Dave","sn":"Jones","mail":["dave@ex.com"]}}`, http.StatusOK, `"dry_run":true`},
+		{"exists", `{"uid":"bob","attrs":{"givenname":"Bob","sn":"Smith"}}`, http.StatusConflict, "already exists"},
+		{"unknown option", `{"uid":"dave","attrs":{"givenname":"Dave","sn":"Jones","shoesize":"42"}}`, http.StatusBadRequest, "Unknown option: shoesize"},
+		{"too long", `{"uid":"dave","attrs":{"givenname":"Daaaaaaaaaaaaaaaaaaaave","sn":"Jones"}}`, http.StatusBadRequest, "at most 20"},
+		{"pattern", `{"uid":"dave","attrs":{"givenname":"Dave","sn":"Jones","mail":"dave"}}`, http.StatusBadRequest, "invalid e-mail format"},
+		{"single value", `{"uid":"dave","attrs":{"givenname":"Dave","sn":"Jones","title":["dev","lead"]}}`, http.StatusBadRequest, "Only one value"},
+	}
+	for _, c := range cases {
+		stub := mutateStub(t)
+		w := serveAs(http.HandlerFunc(UserAddHandler), http.MethodPost, "/user_add?dry_run=1", c.body, "carol", "EX.COM")
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: %d %s, want %d with %q", c.name, w.Code, w.Body, c.status, c.want)
+		}
+		if slices.Contains(stub.called(), "user_add") {
+			t.Errorf("%s: dry-run called user_add", c.name)
+		}
+	}
+}
+
+func TestUserModDryRun(t *testing.T) {
+	cases := []struct {
+		name, body string
+		status     int
+		want       string
+	}{
+		{"valid", `{"uid":"bob","attrs":{"title":"lead"}}`, http.StatusOK, `"dry_run":true`},
+		{"no write right", `{"uid":"bob","attrs":{"givenname":"Robert"}}`, http.StatusForbidden, "no write access"},
+		{"no change", `{"uid":"bob","attrs":{"title":"dev"}}`, http.StatusUnprocessableEntity, "no modifications"},
+		{"unknown option", `{"uid":"bob","attrs":{"shoesize":"42"}}`, http.StatusBadRequest, "Unknown option"},
+		{"no user", `{"uid":"nobody","attrs":{"title":"lead"}}`, http.StatusNotFound, "not found"},
+	}
+	for _, c := range cases {
+		stub := mutateStub(t)
+		w := serveAs(http.HandlerFunc(UserModHandler), http.MethodPost, "/user_mod?dry_run=1", c.body, "carol", "EX.COM")
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: %d %s, want %d with %q", c.name, w.Code, w.Body, c.status, c.want)
+		}
+		if slices.Contains(stub.called(), "user_mod") {
+			t.Errorf("%s: dry-run called user_mod", c.name)
+		}
+	}
+}
+
+func TestUserModHandler(t *testing.T) {
+	stub := mutateStub(t)
+	w := serveAs(http.HandlerFunc(UserModHandler), http.MethodPost, "/user_mod", `{"uid":"bob","attrs":{"title":"lead"}}`, "carol", "EX.COM")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/user_mod: %d %s", w.Code, w.Body)
+	}
+	calls := stub.callsOf("user_mod")
+	if len(calls) != 1 || calls[0].Args[0] != "bob" || calls[0].Named["title"] != "lead" {
+		t.Fatalf("user_mod calls = %+v", calls)
+	}
+	if slices.Contains(stub.called(), "json_metadata") {
+		t.Fatal("real user_mod should leave validation to IPA")
+	}
+}
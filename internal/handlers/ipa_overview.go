@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Больше групп за раз не раскрываем — batch не должен превращаться в выгрузку.
+const overviewMaxGroups = 20
+
+type userOverview struct {
+	User   map[string]any `json:"user"`
+	Groups []IPAResult    `json:"groups"`
+}
+
+// loadUserOverview собирает запись пользователя и записи групп одним batch:
+// user_show uid, group_show на каждую группу и, если вызывающий смотрит не
+// себя, user_show вызывающего — чтобы решить про ipa.restricted_attributes.
+func loadUserOverview(ctx context.Context, sess *IPASession, uid, caller string, groups []string) (*userOverview, error) {
+	cmds := []IPACommand{{Method: "user_show", Positional: []any{uid}, Named: map[string]any{"all": true}}}
+	for _, g := range groups {
+		cmds = append(cmds, IPACommand{Method: "group_show", Positional: []any{g}})
+	}
+	self := caller != "" && caller != uid && len(appCfg.IPA.AdminGroups) > 0
+	if self {
+		cmds = append(cmds, IPACommand{Method: "user_show", Positional: []any{caller}})
+	}
+	res, err := IPABatch(ctx, sess, cmds)
+	if err != nil {
+		return nil, err
+	}
+	if res[0].Error != nil {
+		return nil, res[0].Error
+	}
+
+	var privileged bool
+	switch {
+	case caller == uid:
+		privileged = hasAnyGroup(res[0].Result, appCfg.IPA.AdminGroups)
+	case self:
+		last := res[len(res)-1]
+		if last.Error != nil {
+			return nil, last.Error
+		}
+		privileged = hasAnyGroup(last.Result, appCfg.IPA.AdminGroups)
+	}
+	user := res[0].Result
+	if !privileged {
+		user = filterAttributes(user, appCfg.IPA.RestrictedAttributes)
+	}
+	return &userOverview{User: user, Groups: res[1 : 1+len(groups)]}, nil
+}
+
+// UserOverviewHandler — GET /user_overview?uid=...&groups=g1,g2: пользователь
+// и указанные группы за один HTTP-запрос к IPA. Ошибка отдельной группы
+// (например, not found) приходит в её элементе, а не валит ответ.
+func UserOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
+	id, ok := identityFromRequest(w, r, true)
+	if !ok {
+		return
+	}
+	var caller, principal string
+	if id != nil {
+		caller, principal = callerUID(id), principalName(id)
+	}
+
+	uid, err := normalizeUID(r.URL.Query().Get("uid"))
+	if err != nil {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, err.Error())
+		return
+	}
+	var groups []string
+	for _, g := range strings.Split(r.URL.Query().Get("groups"), ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		if !ipaUIDPattern.MatchString(g) {
+			fail(w, r, CodeBadRequest, http.StatusBadRequest, fmt.Sprintf("invalid group name %q", g))
+			return
+		}
+		groups = append(groups, g)
+	}
+	if len(groups) > overviewMaxGroups {
+		fail(w, r, CodeBadRequest, http.StatusBadRequest, fmt.Sprintf("at most %d groups per request", overviewMaxGroups))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	sess, err := ipaSessionFor(ctx, principal, ccache)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+	out, err := loadUserOverview(ctx, sess, uid, caller, groups)
+	if err != nil {
+		fail(w, r, ipaCode(err), ipaErrorStatus(err), "ipa: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(out)
+}
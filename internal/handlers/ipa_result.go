@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ---- Вспомогательные типы под ответ IPA JSON-RPC ----
+type ipaRPC struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	// Версия API IPA (ipa.api_version): уходит именованным параметром "version",
+	// иначе сервер отвечает предупреждением и формой ответа своей версии
+	Version string `json:"-"`
+}
+
+// newIPARPC собирает запрос; version добавляется в копию named, если
+// вызывающий не задал свою.
+func newIPARPC(method string, positional []any, named map[string]any, version string) ipaRPC {
+	if positional == nil {
+		positional = []any{}
+	}
+	return ipaRPC{Method: method, Params: []any{positional, withIPAVersion(named, version)}, Version: version}
+}
+
+func withIPAVersion(named map[string]any, version string) map[string]any {
+	out := make(map[string]any, len(named)+1)
+	for k, v := range named {
+		out[k] = v
+	}
+	if _, ok := out["version"]; !ok && version != "" {
+		out["version"] = version
+	}
+	return out
+}
+
+// Поле result ответа разбирается лениво: в result.result у *_show/*_add —
+// объект, у *_find — массив, у batch и части команд его нет вовсе.
+type ipaResp struct {
+	Result json.RawMessage `json:"result"`
+	Error  *IPAError       `json:"error"`
+}
+
+// errIPAResultList — result.result оказался массивом там, где ждали объект.
+var errIPAResultList = errors.New("ipa: result is a list")
+
+// envelope — весь result (с "result", "count", "truncated", "summary").
+func (r *ipaResp) envelope() (map[string]any, error) {
+	var env map[string]any
+	if len(r.Result) == 0 || bytes.Equal(r.Result, []byte("null")) {
+		return map[string]any{}, nil
+	}
+	if err := json.Unmarshal(r.Result, &env); err != nil {
+		return nil, fmt.Errorf("ipa: decode result: %w", err)
+	}
+	return env, nil
+}
+
+// inner — сырой result.result; nil, если его нет.
+func (r *ipaResp) inner() (json.RawMessage, error) {
+	if len(r.Result) == 0 || bytes.Equal(r.Result, []byte("null")) {
+		return nil, nil
+	}
+	var env struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(r.Result, &env); err != nil {
+		return nil, fmt.Errorf("ipa: decode result: %w", err)
+	}
+	if bytes.Equal(env.Result, []byte("null")) {
+		return nil, nil
+	}
+	return env.Result, nil
+}
+
+// ResultObject — result.result объектом; если result.result нет (batch и т.п.),
+// возвращается весь result. Для массива — errIPAResultList.
+func (r *ipaResp) ResultObject() (map[string]any, error) {
+	raw, err := r.inner()
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return r.envelope()
+	}
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+		return nil, errIPAResultList
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("ipa: decode result.result: %w", err)
+	}
+	return obj, nil
+}
+
+// ResultList — result.result массивом записей (*_find); нет поля — пустой список.
+func (r *ipaResp) ResultList() ([]map[string]any, error) {
+	raw, err := r.inner()
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return []map[string]any{}, nil
+	}
+	var list []map[string]any
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("ipa: decode result.result as list: %w", err)
+	}
+	return list, nil
+}
+
+// legacyResult — то, что исторически возвращает IPACall: result.result для
+// объекта и весь result для массива.
+func (r *ipaResp) legacyResult() (map[string]any, error) {
+	obj, err := r.ResultObject()
+	if errors.Is(err, errIPAResultList) {
+		return r.envelope()
+	}
+	return obj, err
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func ipaRespOf(t *testing.T, body string) *ipaResp {
+	t.Helper()
+	var r ipaResp
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+func TestIPARespObject(t *testing.T) {
+	r := ipaRespOf(t, `{"result":{"result":{"uid":["alice"]},"value":"alice","summary":null},"error":null}`)
+	obj, err := r.ResultObject()
+	if err != nil || len(obj) != 1 || obj["uid"].([]any)[0] != "alice" {
+		t.Fatalf("ResultObject = %v, %v", obj, err)
+	}
+	if _, err := r.ResultList(); err == nil {
+		t.Fatal("ResultList of an object succeeded")
+	}
+
+	// batch: result.result нет — весь result
+	r = ipaRespOf(t, `{"result":{"count":2,"results":[{},{}]},"error":null}`)
+	if obj, err := r.ResultObject(); err != nil || obj["count"] != float64(2) {
+		t.Fatalf("batch ResultObject = %v, %v", obj, err)
+	}
+	if list, err := r.ResultList(); err != nil || list == nil || len(list) != 0 {
+		t.Fatalf("batch ResultList = %v, %v", list, err)
+	}
+
+	// null в result и в result.result — пустой объект, не ошибка
+	for _, body := range []string{`{"result":null,"error":null}`, `{"result":{"result":null},"error":null}`} {
+		if _, err := ipaRespOf(t, body).ResultObject(); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+	}
+}
+
+func TestIPARespList(t *testing.T) {
+	r := ipaRespOf(t, `{"result":{"result":[{"uid":["alice"]},{"uid":["bob"]}],"count":2,"truncated":false},"error":null}`)
+	list, err := r.ResultList()
+	if err != nil || len(list) != 2 || list[1]["uid"].([]any)[0] != "bob" {
+		t.Fatalf("ResultList = %v, %v", list, err)
+	}
+	if _, err := r.ResultObject(); !errors.Is(err, errIPAResultList) {
+		t.Fatalf("ResultObject of a list: err = %v", err)
+	}
+	// Старый контракт IPACall: для списка — весь result с count
+	legacy, err := r.legacyResult()
+	if err != nil || legacy["count"] != float64(2) || legacy["truncated"] != false {
+		t.Fatalf("legacyResult = %v, %v", legacy, err)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// Время жизни сессии IPA по умолчанию (session_auth_duration), если cookie
+// пришла без Expires/Max-Age — а обычно так и есть.
+const ipaSessionLifetime = 20 * time.Minute
+
+// Обновляем сессию заранее, чтобы не ловить 401 на границе срока.
+const ipaSessionRefreshSkew = 30 * time.Second
+
+// IPASession держит http-клиент и cookie ipa_session после login_kerberos и
+// переиспользует их для нескольких RPC. Делегированный ccache принадлежит
+// конкретному пользователю, поэтому между запросами сессия живёт только в
+// кэше по принципалу (ipaSessionFor). Вызовы идут параллельно: mu держится
+// только на чтение и подмену cookie, сеть — вне блокировки.
+type IPASession struct {
+	baseURL      string
+	krb5ConfPath string
+
+	mu         sync.Mutex
+	ccachePath string
+	client     *http.Client
+	cookie     *http.Cookie
+	expires    time.Time
+	// Идущий login_kerberos: остальные вызовы ждут его, а не логинятся сами
+	inflight *loginCall
+}
+
+// loginCall — результат одного login_kerberos для всех, кто его ждёт.
+type loginCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewIPASession выполняет первичный логин в IPA по делегированному ccache.
+func NewIPASession(ctx context.Context, baseURL, krb5ConfPath, ccachePath string) (*IPASession, error) {
+	s := &IPASession{baseURL: baseURL, krb5ConfPath: krb5ConfPath, ccachePath: ccachePath}
+	if err := s.relogin(ctx, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// current — клиент, cookie и срок сессии на сейчас.
+func (s *IPASession) current() (*http.Client, *http.Cookie, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client, s.cookie, s.expires
+}
+
+// relogin заменяет cookie stale новой. Если её уже заменил другой вызов,
+// ничего не делает; если логин уже идёт — ждёт его. Логин идёт с ccache
+// текущего запроса: сессия из кэша переживает запрос, с ccache которого она
+// началась, а его файл к этому времени может быть удалён (GssapiDelegCcacheUnique).
+func (s *IPASession) relogin(ctx context.Context, stale *http.Cookie) error {
+	s.mu.Lock()
+	if s.cookie != stale {
+		s.mu.Unlock()
+		return nil
+	}
+	if c := s.inflight; c != nil {
+		s.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c := &loginCall{done: make(chan struct{})}
+	s.inflight = c
+	ccachePath := middleware.CCacheFromContext(ctx)
+	if ccachePath == "" {
+		ccachePath = s.ccachePath
+	}
+	s.mu.Unlock()
+
+	httpClient, cookie, err := ipaLogin(ctx, s.baseURL, s.krb5ConfPath, ccachePath)
+
+	s.mu.Lock()
+	if err == nil {
+		s.client, s.cookie, s.expires = httpClient, cookie, cookieExpiry(cookie, time.Now())
+		s.ccachePath = ccachePath
+	}
+	c.err = err
+	s.inflight = nil
+	s.mu.Unlock()
+	close(c.done)
+	return err
+}
+
+// ipaLogin — login_kerberos в IPASession; подменяется только в тестах пакета.
+var ipaLogin = loginKerberos
+
+func cookieExpiry(c *http.Cookie, now time.Time) time.Time {
+	switch {
+	case c.MaxAge > 0:
+		return now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		return c.Expires
+	default:
+		return now.Add(ipaSessionLifetime)
+	}
+}
+
+// Expires — когда истечёт текущая cookie сессии.
+func (s *IPASession) Expires() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expires
+}
+
+// Call вызывает метод IPA в сессии. Перед вызовом обновляет истекающую сессию,
+// а если IPA всё равно ответил 401 — перелогинивается и повторяет один раз.
+func (s *IPASession) Call(ctx context.Context, method string, positional []any, named map[string]any) (map[string]any, error) {
+	resp, err := s.callResp(ctx, method, positional, named)
+	if err != nil {
+		return nil, err
+	}
+	return resp.legacyResult()
+}
+
+// callResp — Call без разбора result, для методов со списком в result.result.
+func (s *IPASession) callResp(ctx context.Context, method string, positional []any, named map[string]any) (*ipaResp, error) {
+	client, cookie, expires := s.current()
+	if time.Now().Add(ipaSessionRefreshSkew).After(expires) {
+		if err := s.relogin(ctx, cookie); err != nil {
+			return nil, fmt.Errorf("ipa session refresh: %w", err)
+		}
+		client, cookie, _ = s.current()
+	}
+	res, err := ipaCallResp(ctx, client, cookie, s.baseURL, method, positional, named)
+	var httpErr *ipaHTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
+		if err := s.relogin(ctx, cookie); err != nil {
+			return nil, fmt.Errorf("ipa session relogin: %w", err)
+		}
+		client, cookie, _ = s.current()
+		return ipaCallResp(ctx, client, cookie, s.baseURL, method, positional, named)
+	}
+	return res, err
+}
+
+// Кэш сессий IPA между запросами (ipa.session_cache): ключ — принципал,
+// принятый SPNEGO (DelegatedCredentials уже сверил с ним ccache), так что
+// сессия отдаётся и с другим ccache того же пользователя. Экономит
+// login_kerberos на каждый запрос; Call сам перелогинится при истечении.
+var ipaSessions = struct {
+	sync.Mutex
+	byPrincipal map[string]*IPASession
+}{byPrincipal: map[string]*IPASession{}}
+
+// ipaSessionFor — сессия для запроса: из кэша, если он включён и известен
+// принципал, иначе новая.
+func ipaSessionFor(ctx context.Context, principal, ccachePath string) (*IPASession, error) {
+	if !appCfg.IPA.SessionCache || principal == "" {
+		return NewIPASession(ctx, appCfg.IPA.BaseURL, appCfg.Krb5.ConfigPath, ccachePath)
+	}
+	if s := cachedIPASession(principal); s != nil {
+		return s, nil
+	}
+	s, err := NewIPASession(ctx, appCfg.IPA.BaseURL, appCfg.Krb5.ConfigPath, ccachePath)
+	if err != nil {
+		return nil, err
+	}
+	storeIPASession(principal, s, time.Now())
+	return s, nil
+}
+
+// storeIPASession кладёт сессию в кэш и выбрасывает истёкшие. Метрика
+// активных принципалов считает сессии в кэше, а не запросы.
+func storeIPASession(principal string, s *IPASession, now time.Time) {
+	sweepIPASessions(now)
+	ipaSessions.Lock()
+	_, replaced := ipaSessions.byPrincipal[principal]
+	ipaSessions.byPrincipal[principal] = s
+	ipaSessions.Unlock()
+	if !replaced {
+		metrics.SessionOpened(principal)
+	}
+}
+
+// sweepIPASessions выбрасывает из кэша сессии, истёкшие к now. Срок каждой
+// сессии читается вне блокировки кэша: Expires ждёт mu сессии, и занятая
+// сессия одного пользователя не должна держать кэш всех остальных.
+func sweepIPASessions(now time.Time) {
+	ipaSessions.Lock()
+	snapshot := maps.Clone(ipaSessions.byPrincipal)
+	ipaSessions.Unlock()
+
+	expired := map[string]*IPASession{}
+	for p, s := range snapshot {
+		if now.After(s.Expires()) {
+			expired[p] = s
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	var gone []string
+	ipaSessions.Lock()
+	for p, s := range expired {
+		// Пока проверяли срок, сессию могли заменить свежей
+		if ipaSessions.byPrincipal[p] == s {
+			delete(ipaSessions.byPrincipal, p)
+			gone = append(gone, p)
+		}
+	}
+	ipaSessions.Unlock()
+	for _, p := range gone {
+		metrics.SessionClosed(p)
+	}
+}
+
+// cachedIPASession — живая сессия principal из кэша или nil.
+func cachedIPASession(principal string) *IPASession {
+	ipaSessions.Lock()
+	s := ipaSessions.byPrincipal[principal]
+	ipaSessions.Unlock()
+	if s == nil || time.Now().After(s.Expires()) {
+		return nil
+	}
+	return s
+}
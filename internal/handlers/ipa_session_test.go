@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/metrics"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// resetIPASessions очищает кэш сессий IPA до и после теста.
+func resetIPASessions(t *testing.T) {
+	t.Helper()
+	sweepIPASessions(time.Now().Add(24 * time.Hour))
+	t.Cleanup(func() { sweepIPASessions(time.Now().Add(24 * time.Hour)) })
+}
+
+func TestIPASessionCacheActivePrincipals(t *testing.T) {
+	resetIPASessions(t)
+	now := time.Now()
+	base := metrics.ActivePrincipals()
+
+	storeIPASession("alice@EX.COM", &IPASession{expires: now.Add(time.Minute)}, now)
+	storeIPASession("bob@EX.COM", &IPASession{expires: now.Add(time.Hour)}, now)
+	// Новая сессия того же принципала заменяет старую, а не добавляется
+	storeIPASession("alice@EX.COM", &IPASession{expires: now.Add(time.Minute)}, now)
+	if got := metrics.ActivePrincipals() - base; got != 2 {
+		t.Fatalf("active = %d, want 2", got)
+	}
+
+	sweepIPASessions(now.Add(2 * time.Minute))
+	if got := metrics.ActivePrincipals() - base; got != 1 {
+		t.Fatalf("active = %d after alice's session expired, want 1", got)
+	}
+}
+
+// fakeIPALogin подменяет login_kerberos: записывает ccache каждого логина и
+// выдаёт cookie с номером логина.
+type fakeIPALogin struct {
+	mu      sync.Mutex
+	ccaches []string
+}
+
+func useFakeIPALogin(t *testing.T, srv *httptest.Server) *fakeIPALogin {
+	t.Helper()
+	f := &fakeIPALogin{}
+	prev := ipaLogin
+	ipaLogin = func(_ context.Context, _, _, ccachePath string) (*http.Client, *http.Cookie, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.ccaches = append(f.ccaches, ccachePath)
+		return srv.Client(), &http.Cookie{Name: "ipa_session", Value: ccachePath}, nil
+	}
+	t.Cleanup(func() { ipaLogin = prev })
+	return f
+}
+
+func (f *fakeIPALogin) logins() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ccaches...)
+}
+
+// withSessionCache включает ipa.session_cache с IPA по адресу srv.
+func withSessionCache(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	prev := appCfg
+	cfg := appconfig.Defaults()
+	cfg.IPA.BaseURL = srv.URL
+	cfg.IPA.SessionCache = true
+	appCfg = cfg
+	t.Cleanup(func() { appCfg = prev })
+	resetIPASessions(t)
+}
+
+// requestCtx — ctx запроса, прошедшего DelegatedCredentials с ccache.
+func requestCtx(ccache string) context.Context {
+	return middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM", ccache: ccache})
+}
+
+const okIPAResponse = `{"result":{"result":{"uid":["alice"]},"value":"alice"},"error":null,"id":0}`
+
+func TestIPASessionCacheHitAcrossCCaches(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(okIPAResponse))
+	}))
+	defer srv.Close()
+	withSessionCache(t, srv)
+	login := useFakeIPALogin(t, srv)
+
+	// GssapiDelegCcacheUnique: у каждого запроса свой файл ccache
+	first, err := ipaSessionFor(requestCtx("/run/krb5cc_1"), "alice@EX.COM", "/run/krb5cc_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ipaSessionFor(requestCtx("/run/krb5cc_2"), "alice@EX.COM", "/run/krb5cc_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("second request of the same principal did not reuse the cached session")
+	}
+	if got := login.logins(); len(got) != 1 {
+		t.Fatalf("logins = %v, want one", got)
+	}
+
+	// Другой принципал сессию alice не получает
+	other, err := ipaSessionFor(requestCtx("/run/krb5cc_3"), "bob@EX.COM", "/run/krb5cc_3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Fatal("bob got alice's session")
+	}
+}
+
+func TestIPASessionReloginOn401UsesRequestCCache(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// Сессия из первого логина на сервере уже истекла
+		if c, _ := r.Cookie("ipa_session"); c == nil || c.Value == "/run/krb5cc_1" {
+			http.Error(w, "session expired", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(okIPAResponse))
+	}))
+	defer srv.Close()
+	withSessionCache(t, srv)
+	login := useFakeIPALogin(t, srv)
+
+	if _, err := ipaSessionFor(requestCtx("/run/krb5cc_1"), "alice@EX.COM", "/run/krb5cc_1"); err != nil {
+		t.Fatal(err)
+	}
+	// Следующий запрос пришёл с другим ccache; файл первого уже удалён
+	ctx := requestCtx("/run/krb5cc_2")
+	s, err := ipaSessionFor(ctx, "alice@EX.COM", "/run/krb5cc_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Call(ctx, "user_show", []any{"alice"}, nil); err != nil {
+		t.Fatalf("Call after relogin: %v", err)
+	}
+	got := login.logins()
+	if len(got) != 2 || got[1] != "/run/krb5cc_2" {
+		t.Fatalf("logins = %v, want relogin with /run/krb5cc_2", got)
+	}
+	if calls != 2 {
+		t.Fatalf("IPA calls = %d, want 401 then retry", calls)
+	}
+}
+
+// countingIPALogin — login_kerberos с cookie "1", "2", ... по номеру логина.
+func countingIPALogin(t *testing.T, srv *httptest.Server) *atomic.Int32 {
+	t.Helper()
+	var n atomic.Int32
+	prev := ipaLogin
+	ipaLogin = func(context.Context, string, string, string) (*http.Client, *http.Cookie, error) {
+		v := n.Add(1)
+		return srv.Client(), &http.Cookie{Name: "ipa_session", Value: strconv.Itoa(int(v))}, nil
+	}
+	t.Cleanup(func() { ipaLogin = prev })
+	return &n
+}
+
+func TestIPASessionCallsRunConcurrently(t *testing.T) {
+	var inside atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inside.Add(1)
+		<-release
+		w.Write([]byte(okIPAResponse))
+	}))
+	defer srv.Close()
+	withSessionCache(t, srv)
+	countingIPALogin(t, srv)
+
+	s, err := NewIPASession(context.Background(), srv.URL, "", "/run/krb5cc_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const calls = 4
+	errs := make(chan error, calls)
+	for range calls {
+		go func() {
+			_, err := s.Call(context.Background(), "user_show", []any{"alice"}, nil)
+			errs <- err
+		}()
+	}
+	// Все вызовы одновременно ждут ответа IPA — сессия их не выстраивает в очередь
+	deadline := time.Now().Add(5 * time.Second)
+	for inside.Load() < calls {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("%d of %d calls reached IPA concurrently", inside.Load(), calls)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Срок сессии читается и пока вызовы висят в сети
+	got := make(chan time.Time, 1)
+	go func() { got <- s.Expires() }()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Error("Expires blocked behind in-flight calls")
+	}
+	close(release)
+	for range calls {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestIPASessionReloginOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cookie первого логина сервер уже не принимает
+		if c, _ := r.Cookie("ipa_session"); c == nil || c.Value == "1" {
+			http.Error(w, "session expired", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(okIPAResponse))
+	}))
+	defer srv.Close()
+	withSessionCache(t, srv)
+	logins := countingIPALogin(t, srv)
+
+	s, err := NewIPASession(context.Background(), srv.URL, "", "/run/krb5cc_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const calls = 8
+	var wg sync.WaitGroup
+	for range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Call(context.Background(), "user_show", []any{"alice"}, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// Первый логин и один перелогин на все вызовы, получившие 401
+	if n := logins.Load(); n != 2 {
+		t.Fatalf("logins = %d, want 2", n)
+	}
+}
+
+func TestSweepIPASessionsDoesNotHoldCacheOnBusySession(t *testing.T) {
+	resetIPASessions(t)
+	now := time.Now()
+	busy := &IPASession{expires: now.Add(time.Hour)}
+	storeIPASession("alice@EX.COM", busy, now)
+	storeIPASession("bob@EX.COM", &IPASession{expires: now.Add(time.Hour)}, now)
+
+	// Сессию alice держит долгий вызов; sweep ждёт её срок
+	busy.mu.Lock()
+	swept := make(chan struct{})
+	go func() {
+		sweepIPASessions(now.Add(time.Minute))
+		close(swept)
+	}()
+	got := make(chan *IPASession, 1)
+	go func() { got <- cachedIPASession("bob@EX.COM") }()
+	select {
+	case s := <-got:
+		if s == nil {
+			t.Error("bob's session is gone")
+		}
+	case <-time.After(time.Second):
+		t.Error("cache lookup for bob blocked behind alice's busy session")
+	}
+	busy.mu.Unlock()
+	<-swept
+}
+
+func TestSessionStatusReportsIPACookieExpiry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	withSessionCache(t, srv)
+	prev := ipaLogin
+	ipaLogin = func(context.Context, string, string, string) (*http.Client, *http.Cookie, error) {
+		return srv.Client(), &http.Cookie{Name: "ipa_session", Value: "1", MaxAge: 300}, nil
+	}
+	t.Cleanup(func() { ipaLogin = prev })
+
+	ctx := requestCtx("/run/krb5cc_1")
+	s, err := ipaSessionFor(ctx, "alice@EX.COM", "/run/krb5cc_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/session/status", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	SessionStatusHandler(w, r)
+	var got sessionStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	if !got.IPA.Cached || !got.IPA.ExpiresAt.Equal(s.Expires()) {
+		t.Fatalf("ipa_session = %+v, want cached until %v", got.IPA, s.Expires())
+	}
+	if got.IPA.TTLSeconds < 295 || got.IPA.TTLSeconds > 300 {
+		t.Fatalf("ttl_seconds = %d, want about the cookie's Max-Age of 300", got.IPA.TTLSeconds)
+	}
+}
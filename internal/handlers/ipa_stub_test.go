@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// ipaMethod отвечает на вызов JSON-RPC: result.result или ошибка IPA.
+type ipaMethod func(args []any, named map[string]any) (any, *IPAError)
+
+type ipaStubCall struct {
+	Method string
+	Args   []any
+	Named  map[string]any
+}
+
+// ipaStub — IPA JSON-RPC на httptest с подменённым login_kerberos. Вызовы
+// записываются; метод без обработчика отвечает ошибкой 3005 (CommandError).
+type ipaStub struct {
+	mu      sync.Mutex
+	calls   []ipaStubCall
+	methods map[string]ipaMethod
+}
+
+// newIPAStub поднимает заглушку IPA и настраивает на неё appCfg (реалм IPA —
+// EX.COM). Тест может менять appCfg дальше: исходный вернётся в Cleanup.
+func newIPAStub(t *testing.T, methods map[string]ipaMethod) *ipaStub {
+	t.Helper()
+	stub := &ipaStub{methods: methods}
+	srv := httptest.NewServer(http.HandlerFunc(stub.serve))
+	t.Cleanup(srv.Close)
+
+	prev := appCfg
+	cfg := appconfig.Defaults()
+	cfg.IPA.BaseURL = srv.URL
+	cfg.IPA.Realm = "EX.COM"
+	appCfg = cfg
+	t.Cleanup(func() { appCfg = prev })
+	useFakeIPALogin(t, srv)
+	return stub
+}
+
+func (s *ipaStub) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string `json:"method"`
+		Params []json.RawMessage
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Params) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var call ipaStubCall
+	call.Method = req.Method
+	json.Unmarshal(req.Params[0], &call.Args)
+	json.Unmarshal(req.Params[1], &call.Named)
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	fn := s.methods[req.Method]
+	s.mu.Unlock()
+
+	var (
+		res    any
+		ipaErr *IPAError
+	)
+	if fn == nil {
+		ipaErr = &IPAError{Code: 3005, Message: "unknown command " + req.Method}
+	} else {
+		res, ipaErr = fn(call.Args, call.Named)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if ipaErr != nil {
+		json.NewEncoder(w).Encode(map[string]any{"result": nil, "error": ipaErr, "id": 0})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"result": res}, "error": nil, "id": 0})
+}
+
+// called — имена вызванных методов по порядку.
+func (s *ipaStub) called() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.calls))
+	for i, c := range s.calls {
+		out[i] = c.Method
+	}
+	return out
+}
+
+// callsOf — вызовы method.
+func (s *ipaStub) callsOf(method string) []ipaStubCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ipaStubCall
+	for _, c := range s.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ipaUsers — user_show по таблице записей; нет записи — NotFound.
+func ipaUsers(users map[string]map[string]any) ipaMethod {
+	return func(args []any, _ map[string]any) (any, *IPAError) {
+		uid, _ := args[0].(string)
+		if u, ok := users[uid]; ok {
+			return u, nil
+		}
+		return nil, &IPAError{Code: IPAErrNotFound, Message: uid + ": user not found"}
+	}
+}
+
+// asUser — запрос от user@realm с делегированным ccache.
+func asUser(r *http.Request, user, realm string) *http.Request {
+	id := testIdentity{user: user, realm: realm, ccache: "/run/krb5cc_" + user}
+	return r.WithContext(middleware.WithIdentity(context.Background(), id))
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// useIPATransport — свежий транспорт IPA на время теста.
+func useIPATransport(t *testing.T, idle time.Duration) {
+	t.Helper()
+	prevCfg, prevTransport := appCfg, ipaTransport
+	appCfg = appconfig.Defaults()
+	if err := ConfigureIPATransport(idle, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { appCfg, ipaTransport = prevCfg, prevTransport })
+}
+
+func TestConfigureIPATransportIdleTimeout(t *testing.T) {
+	useIPATransport(t, 42*time.Second)
+	if ipaTransport.IdleConnTimeout != 42*time.Second {
+		t.Fatalf("IdleConnTimeout = %s", ipaTransport.IdleConnTimeout)
+	}
+}
+
+func TestIPAIdleReaperClosesIdleConns(t *testing.T) {
+	var closed atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	useIPATransport(t, time.Hour)
+
+	// Соединение прогрева остаётся в пуле: IdleConnTimeout в час его не закроет
+	if err := WarmUpIPA(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartIPAIdleReaper(ctx, 10*time.Millisecond)
+	for i := 0; i < 200 && closed.Load() == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if closed.Load() == 0 {
+		t.Fatal("idle IPA connection was not reaped")
+	}
+}
+
+func TestLoginKerberosRequiresHTTPS(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+	ccache := filepath.Join(t.TempDir(), "missing")
+
+	// Без https токен Negotiate не уходит: отказ ещё до чтения ccache
+	_, _, err := loginKerberos(context.Background(), "http://ipa.ex.com/ipa", "", ccache)
+	if err == nil || !strings.Contains(err.Error(), "https required") {
+		t.Fatalf("err = %v, want https required", err)
+	}
+	appCfg.IPA.AllowInsecureHTTP = true
+	_, _, err = loginKerberos(context.Background(), "http://ipa.ex.com/ipa", "", ccache)
+	if err == nil || strings.Contains(err.Error(), "https required") || !strings.Contains(err.Error(), "load ccache") {
+		t.Fatalf("with allow_insecure_http: err = %v, want to reach the ccache", err)
+	}
+}
+
+func TestIPAMaxResponseBytes(t *testing.T) {
+	const ok = `{"result":{"result":{"uid":["alice"]}},"error":null}`
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := body.Load().(string)
+		if strings.HasPrefix(b, "503 ") {
+			http.Error(w, b[4:], http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(b))
+	}))
+	defer srv.Close()
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	appCfg.IPA.MaxResponseBytes = 100
+	defer func() { appCfg = prev }()
+
+	call := func(b string) (*ipaResp, error) {
+		body.Store(b)
+		return ipaCallResp(context.Background(), srv.Client(), &http.Cookie{Name: "ipa_session", Value: "s"}, srv.URL, "user_show", nil, nil)
+	}
+	// Ровно лимит — читается целиком
+	if _, err := call(ok + strings.Repeat(" ", 100-len(ok))); err != nil {
+		t.Fatalf("response at the limit: %v", err)
+	}
+	_, err := call(ok + strings.Repeat(" ", 101-len(ok)))
+	if err == nil || !strings.Contains(err.Error(), "user_show response exceeds 100 bytes") {
+		t.Fatalf("response over the limit: err = %v", err)
+	}
+	// Тело ошибки тоже не больше лимита
+	_, err = call("503 " + strings.Repeat("x", 1000))
+	var httpErr *ipaHTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable || len(httpErr.Body) != 100 {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestIPACallContext(t *testing.T) {
+	// Без срока у вызывающего — не дольше ipaCallTimeout
+	ctx, cancel := ipaCallContext(context.Background())
+	d, ok := ctx.Deadline()
+	cancel()
+	if !ok || time.Until(d) > ipaCallTimeout {
+		t.Fatalf("no caller deadline: deadline = %v, %v", d, ok)
+	}
+	// Более ранний срок вызывающего не продлевается
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	want, _ := parent.Deadline()
+	ctx, cancel = ipaCallContext(parent)
+	defer cancel()
+	if d, _ := ctx.Deadline(); !d.Equal(want) {
+		t.Fatalf("caller deadline %v became %v", want, d)
+	}
+}
+
+// Срок запроса обрывает login_kerberos, который IPA держит без ответа
+func TestLoginKerberosHonorsContext(t *testing.T) {
+	useIPATransport(t, time.Minute)
+	appCfg.IPA.AllowInsecureHTTP = true
+	released := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(released)
+	}))
+	defer srv.Close()
+
+	spn := krb.ServiceSPN("HTTP", "127.0.0.1")
+	tkt := messages.Ticket{
+		TktVNO: 5, Realm: "EX.COM", SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn),
+		EncPart: types.EncryptedData{EType: 18, KVNO: 1, Cipher: []byte("ticket")},
+	}
+	cache := krb.NewMemoryTicketCache(0)
+	cache.Put("alice@EX.COM", spn, tkt, types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}, time.Now().Add(time.Hour))
+	SetIPATicketCache(cache)
+	t.Cleanup(func() { SetIPATicketCache(nil) })
+	krb5conf := filepath.Join(t.TempDir(), "krb5.conf")
+	if err := os.WriteFile(krb5conf, []byte("[libdefaults]\n default_realm = EX.COM\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM"})
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := loginKerberos(ctx, srv.URL, krb5conf, writeTGTCCache(t, "alice", "EX.COM"))
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "login_kerberos") {
+		t.Fatalf("err = %v, want the login call to hit the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("login returned after %v", elapsed)
+	}
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight login request was not cancelled")
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+const testIPASPN = "HTTP/ipa.example.com"
+
+// ccacheFor — ccache, чей принципал по умолчанию (как и в файле) ничем не подтверждён.
+func ccacheFor(user, realm string) *credentials.CCache {
+	var cc credentials.CCache
+	cc.DefaultPrincipal.Realm = realm
+	cc.DefaultPrincipal.PrincipalName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user)
+	return &cc
+}
+
+// withVictimTicket включает кэш билетов IPA с билетом alice и возвращает его ключ.
+func withVictimTicket(t *testing.T) types.EncryptionKey {
+	t.Helper()
+	cache := krb.NewMemoryTicketCache(0)
+	key := types.EncryptionKey{KeyType: 18, KeyValue: bytes.Repeat([]byte{7}, 32)}
+	cache.Put("alice@EXAMPLE.COM", testIPASPN, messages.Ticket{Realm: "EXAMPLE.COM"}, key, time.Now().Add(time.Hour))
+	SetIPATicketCache(cache)
+	t.Cleanup(func() { SetIPATicketCache(nil) })
+	return key
+}
+
+// offlineClient — клиент без KDC: любой поход за билетом заканчивается ошибкой.
+func offlineClient(user string) *client.Client {
+	return client.NewWithPassword(user, "EXAMPLE.COM", "secret", config.New(), client.DisablePAFXFAST(true))
+}
+
+func TestIPAServiceTicketCacheHitForAuthenticatedPrincipal(t *testing.T) {
+	key := withVictimTicket(t)
+	_, got, err := ipaServiceTicket(offlineClient("alice"), ccacheFor("alice", "EXAMPLE.COM"), config.New(), testIPASPN, "alice@EXAMPLE.COM")
+	if err != nil {
+		t.Fatalf("ipaServiceTicket: %v", err)
+	}
+	if !bytes.Equal(got.KeyValue, key.KeyValue) {
+		t.Fatal("expected the cached session key")
+	}
+}
+
+func TestIPAServiceTicketForgedCCachePrincipal(t *testing.T) {
+	key := withVictimTicket(t)
+	// mallory аутентифицирован SPNEGO, но подсунул ccache с принципалом alice
+	_, got, err := ipaServiceTicket(offlineClient("alice"), ccacheFor("alice", "EXAMPLE.COM"), config.New(), testIPASPN, "mallory@EXAMPLE.COM")
+	if err == nil || bytes.Equal(got.KeyValue, key.KeyValue) {
+		t.Fatalf("forged ccache got a cached ticket (err=%v)", err)
+	}
+}
+
+func TestIPAServiceTicketNoAuthenticatedPrincipal(t *testing.T) {
+	key := withVictimTicket(t)
+	_, got, err := ipaServiceTicket(offlineClient("alice"), ccacheFor("alice", "EXAMPLE.COM"), config.New(), testIPASPN, "")
+	if err == nil || bytes.Equal(got.KeyValue, key.KeyValue) {
+		t.Fatalf("unauthenticated lookup got a cached ticket (err=%v)", err)
+	}
+}
+
+type testIdentity struct{ user, realm, ccache string }
+
+func (i testIdentity) UserName() string   { return i.user }
+func (i testIdentity) Domain() string     { return i.realm }
+func (i testIdentity) CCachePath() string { return i.ccache }
+
+func TestAuthenticatedPrincipal(t *testing.T) {
+	if got := authenticatedPrincipal(context.Background()); got != "" {
+		t.Fatalf("without identity: %q", got)
+	}
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "bob", realm: "AD.EXAMPLE.ORG"})
+	if got := authenticatedPrincipal(ctx); got != "bob@AD.EXAMPLE.ORG" {
+		t.Fatalf("authenticatedPrincipal = %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// inFlight — семафоры запросов в работе по принципалу. Запись живёт, пока у
+// принципала есть хоть один запрос, так что карта не растёт с числом клиентов.
+type inFlight struct {
+	mu    sync.Mutex
+	limit int
+	used  map[string]int
+}
+
+// acquire занимает слот принципала; false — все limit слотов заняты.
+func (f *inFlight) acquire(principal string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.used[principal] >= f.limit {
+		return false
+	}
+	f.used[principal]++
+	return true
+}
+
+func (f *inFlight) release(principal string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.used[principal]--; f.used[principal] <= 0 {
+		delete(f.used, principal)
+	}
+}
+
+// PrincipalLimit ограничивает число одновременных запросов одного принципала
+// (auth.max_in_flight): лишние получают 429, пока идущие не завершатся. Один
+// сломанный или скомпрометированный клиент не выбирает так соединения к KDC,
+// IPA и Postgres. Слот освобождается и при панике хэндлера. limit <= 0 —
+// без ограничения. Ставится внутри SPNEGO; запросы без identity не считаются.
+func PrincipalLimit(next http.Handler, limit int) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	f := &inFlight{limit: limit, used: make(map[string]int)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := middleware.IdentityFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal := principalName(id)
+		if !f.acquire(principal) {
+			w.Header().Set("Retry-After", "1")
+			fail(w, r, CodeTooManyRequests, http.StatusTooManyRequests,
+				fmt.Sprintf("too many concurrent requests for %s (limit %d)", principal, limit))
+			return
+		}
+		defer f.release(principal)
+		next.ServeHTTP(w, r)
+	})
+}
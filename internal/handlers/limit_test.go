@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestPrincipalLimit(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := PrincipalLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveAs(h, http.MethodGet, "/slow", "", "alice", "EX.COM")
+		}()
+		<-entered
+	}
+
+	// Оба слота alice заняты — третий запрос сразу 429
+	w := serveAs(h, http.MethodGet, "/db", "", "alice", "EX.COM")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" || errorCodeOf(t, w) != CodeTooManyRequests {
+		t.Fatalf("over the limit: %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	// Лимит у каждого принципала свой; без identity не считается
+	if w := serveAs(h, http.MethodGet, "/db", "", "bob", "EX.COM"); w.Code != http.StatusNoContent {
+		t.Fatalf("other principal: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/db", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("no identity: %d", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if w := serveAs(h, http.MethodGet, "/db", "", "alice", "EX.COM"); w.Code != http.StatusNoContent {
+		t.Fatalf("after release: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestPrincipalLimitReleasesOnPanic(t *testing.T) {
+	h := PrincipalLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), 1)
+
+	func() {
+		defer func() { recover() }()
+		serveAs(h, http.MethodGet, "/panic", "", "alice", "EX.COM")
+	}()
+	if w := serveAs(h, http.MethodGet, "/db", "", "alice", "EX.COM"); w.Code != http.StatusNoContent {
+		t.Fatalf("slot leaked after panic: %d %s", w.Code, w.Body)
+	}
+}
+
+// auth.max_in_flight: 0 — без ограничения
+func TestPrincipalLimitDisabled(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := PrincipalLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), 0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveAs(h, http.MethodGet, "/slow", "", "alice", "EX.COM")
+	}()
+	<-entered
+	defer func() { close(release); <-done }()
+	if w := serveAs(h, http.MethodGet, "/db", "", "alice", "EX.COM"); w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go-http-pgsql-krb5/internal/middleware"
+)
+
+// RealmPolicy применяет auth.blocked_realms и auth.allowed_realms к реалму
+// клиента. Заблокированный реалм получает настроенный статус (403/451) и
+// сообщение и попадает в лог аудита; реалм вне непустого allowed_realms —
+// обычный 403. Ставится внутри SPNEGO.
+func RealmPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := middleware.IdentityFromContext(r.Context())
+		if !ok {
+			// без identity решает auth.nil_identity в хэндлере
+			next.ServeHTTP(w, r)
+			return
+		}
+		realm := id.Domain()
+		if containsFold(appCfg.Auth.BlockedRealms, realm) {
+			log.Printf("audit: realm %s blocked by policy for %s (%s %s)", realm, principalName(id), r.Method, r.URL.Path)
+			fail(w, r, CodeRealmBlocked, appCfg.Auth.BlockedStatus, appCfg.Auth.BlockedMessage)
+			return
+		}
+		if len(appCfg.Auth.AllowedRealms) > 0 && !containsFold(appCfg.Auth.AllowedRealms, realm) {
+			fail(w, r, CodeRealmNotAllowed, http.StatusForbidden, "realm "+realm+" is not allowed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+)
+
+func useRealmPolicy(t *testing.T, allowed, blocked []string, status int) http.Handler {
+	t.Helper()
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	appCfg.Auth.AllowedRealms, appCfg.Auth.BlockedRealms = allowed, blocked
+	appCfg.Auth.BlockedStatus = status
+	appCfg.Auth.BlockedMessage = "trust with this realm is not honored"
+	t.Cleanup(func() { appCfg = prev })
+	return RealmPolicy(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestRealmPolicyBlocked(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	for _, status := range []int{http.StatusUnavailableForLegalReasons, http.StatusForbidden} {
+		logged.Reset()
+		// Блокировка сильнее allowlist и не зависит от регистра
+		h := useRealmPolicy(t, []string{"PARTNER.COM"}, []string{"partner.com"}, status)
+		w := serveAs(h, http.MethodGet, "/db", "", "mallory", "PARTNER.COM")
+		if w.Code != status || errorCodeOf(t, w) != CodeRealmBlocked {
+			t.Fatalf("status = %d, body = %s; want %d", w.Code, w.Body, status)
+		}
+		if !strings.Contains(w.Body.String(), "trust with this realm is not honored") {
+			t.Errorf("message not in %s", w.Body)
+		}
+		if !strings.Contains(logged.String(), "audit: realm PARTNER.COM blocked by policy for mallory@PARTNER.COM (GET /db)") {
+			t.Errorf("audit log = %q", logged.String())
+		}
+	}
+}
+
+func TestRealmPolicyAllowlist(t *testing.T) {
+	h := useRealmPolicy(t, []string{"EX.COM"}, []string{"PARTNER.COM"}, http.StatusUnavailableForLegalReasons)
+
+	if w := serveAs(h, http.MethodGet, "/db", "", "alice", "ex.com"); w.Code != http.StatusNoContent {
+		t.Fatalf("allowed realm: %d %s", w.Code, w.Body)
+	}
+	// Реалм вне allowlist — обычный 403, а не настроенный ответ блокировки
+	w := serveAs(h, http.MethodGet, "/db", "", "eve", "OTHER.COM")
+	if w.Code != http.StatusForbidden || errorCodeOf(t, w) != CodeRealmNotAllowed {
+		t.Fatalf("foreign realm: %d %s", w.Code, w.Body)
+	}
+
+	// Пустой allowlist пропускает всё, кроме заблокированного
+	h = useRealmPolicy(t, nil, []string{"PARTNER.COM"}, http.StatusForbidden)
+	if w := serveAs(h, http.MethodGet, "/db", "", "eve", "OTHER.COM"); w.Code != http.StatusNoContent {
+		t.Fatalf("no allowlist: %d %s", w.Code, w.Body)
+	}
+	// Без identity решает хэндлер
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/db", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("no identity: %d %s", w.Code, w.Body)
+	}
+}
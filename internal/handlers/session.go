@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+type layerStatus struct {
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type ipaSessionStatus struct {
+	Cached bool `json:"cached"`
+	layerStatus
+}
+
+type sessionStatus struct {
+	Principal string           `json:"principal"`
+	Kerberos  layerStatus      `json:"kerberos"`
+	IPA       ipaSessionStatus `json:"ipa_session"`
+}
+
+func newLayerStatus(expires time.Time, now time.Time) layerStatus {
+	return layerStatus{ExpiresAt: expires, TTLSeconds: max(int64(expires.Sub(now)/time.Second), 0)}
+}
+
+// SessionStatusHandler — GET /session/status: сколько осталось жить TGT в
+// делегированном ccache и закэшированной сессии IPA (ipa.session_cache).
+// Ничего не обновляет и в IPA не ходит.
+func SessionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := identityFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+	ccache, ok := delegatedCCache(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	out := sessionStatus{Principal: principalName(id)}
+	if end, err := pgx.CCacheValid(ccache); err != nil {
+		out.Kerberos.Error = err.Error()
+	} else {
+		out.Kerberos = newLayerStatus(end, now)
+	}
+	if s := cachedIPASession(out.Principal); s != nil {
+		out.IPA = ipaSessionStatus{Cached: true, layerStatus: newLayerStatus(s.Expires(), now)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
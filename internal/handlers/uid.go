@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Допустимый uid по правилам IPA (ipalib PATTERN_GROUPUSER_NAME).
+var ipaUIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.][a-zA-Z0-9_.-]{0,252}[a-zA-Z0-9_.$-]?$`)
+
+// normalizeUID приводит uid из запроса к виду, который ждёт IPA: при
+// ipa.strip_realm принципал "alice@EXAMPLE.COM" становится "alice".
+func normalizeUID(raw string) (string, error) {
+	uid := strings.TrimSpace(raw)
+	if appCfg.IPA.StripRealm {
+		if i := strings.LastIndex(uid, "@"); i >= 0 {
+			uid = uid[:i]
+		}
+	}
+	if !ipaUIDPattern.MatchString(uid) {
+		return "", fmt.Errorf("invalid uid %q", raw)
+	}
+	return uid, nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+)
+
+func TestNormalizeUID(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+
+	for _, tc := range []struct {
+		raw   string
+		strip bool
+		want  string // "" — uid отвергнут
+	}{
+		{"alice", true, "alice"},
+		{" alice ", true, "alice"},
+		{"alice@EX.COM", true, "alice"},
+		{"svc.app_1", true, "svc.app_1"},
+		{"machine1$", true, "machine1$"},
+		{"alice@EX.COM", false, ""},
+		{"", true, ""},
+		{"@EX.COM", true, ""},
+		{"-alice", true, ""},
+		{"al ice", true, ""},
+		{"../admin", true, ""},
+		{strings.Repeat("a", 256), true, ""},
+	} {
+		appCfg.IPA.StripRealm = tc.strip
+		got, err := normalizeUID(tc.raw)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("normalizeUID(%q, strip=%v) = %q, want an error", tc.raw, tc.strip, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("normalizeUID(%q, strip=%v) = %q, %v; want %q", tc.raw, tc.strip, got, err, tc.want)
+		}
+	}
+}
+
+func TestUserShowStripsRealm(t *testing.T) {
+	stub := newIPAStub(t, map[string]ipaMethod{"user_show": ipaUsers(attrsUsers)})
+
+	w := serveAs(http.HandlerFunc(IpaUserHandler), http.MethodGet, "/user_show?uid="+url.QueryEscape("bob@EX.COM"), "", "alice", "EX.COM")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if calls := stub.callsOf("user_show"); len(calls) == 0 || calls[0].Args[0] != "bob" {
+		t.Fatalf("user_show calls = %+v, want uid bob", calls)
+	}
+
+	// Неверный uid в IPA не уходит
+	before := len(stub.called())
+	w = serveAs(http.HandlerFunc(IpaUserHandler), http.MethodGet, "/user_show?uid="+url.QueryEscape("bob smith"), "", "alice", "EX.COM")
+	if w.Code != http.StatusBadRequest || errorCodeOf(t, w) != CodeBadRequest || len(stub.called()) != before {
+		t.Fatalf("status = %d, calls %v: %s", w.Code, stub.called(), w.Body)
+	}
+}
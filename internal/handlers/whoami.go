@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+type whoami struct {
+	Principal   string    `json:"principal"`
+	UserName    string    `json:"username"`
+	Realm       string    `json:"realm"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AuthTime    time.Time `json:"auth_time,omitempty"`
+	// Принципал из делегированного ccache — должен совпадать с Principal;
+	// расхождение объясняет отказы на стороне IPA/Postgres.
+	Delegated      string `json:"delegated_principal,omitempty"`
+	DelegatedError string `json:"delegated_error,omitempty"`
+}
+
+// WhoAmIHandler отдаёт канонический принципал (user@REALM), под которым
+// SPNEGO принял клиента, и принципал делегированного ccache, если он есть.
+func WhoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := identityFromRequest(w, r, false)
+	if !ok {
+		return
+	}
+	out := whoami{
+		Principal: principalName(id),
+		UserName:  id.UserName(),
+		Realm:     id.Domain(),
+	}
+	// Есть у identity из SPNEGO, у подставленной — не обязательно
+	if kid, ok := id.(interface {
+		DisplayName() string
+		AuthTime() time.Time
+	}); ok {
+		out.DisplayName, out.AuthTime = kid.DisplayName(), kid.AuthTime()
+	}
+	if raw := middleware.CCacheName(r); raw != "" {
+		out.Delegated, out.DelegatedError = delegatedPrincipal(r.Context(), raw)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func delegatedPrincipal(ctx context.Context, header string) (principal, errMsg string) {
+	path, err := middleware.ParseCCacheName(header)
+	if err != nil {
+		return "", err.Error()
+	}
+	cc, err := krb.LoadCCache(ctx, path)
+	if err != nil {
+		return "", err.Error()
+	}
+	return cc.GetClientPrincipalName().PrincipalNameString() + "@" + cc.GetClientRealm(), ""
+}
+
+// PrincipalHeader добавляет в каждый ответ заголовок name с каноническим
+// принципалом клиента. Ставится внутри SPNEGO-мидлвари.
+func PrincipalHeader(next http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := middleware.IdentityFromContext(r.Context()); ok {
+			w.Header().Set(name, principalName(id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
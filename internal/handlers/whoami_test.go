@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	appconfig "go-http-pgsql-krb5/internal/config"
+	"go-http-pgsql-krb5/internal/middleware"
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// writeTGTCCache пишет ccache с TGT user@realm (билет не настоящий — нужен только принципал).
+func writeTGTCCache(t *testing.T, user, realm string) string {
+	t.Helper()
+	return writeTGTCCacheUntil(t, user, realm, time.Now().Add(time.Hour))
+}
+
+// writeTGTCCacheUntil — то же с TGT, истекающим в end.
+func writeTGTCCacheUntil(t *testing.T, user, realm string, end time.Time) string {
+	t.Helper()
+	tgt := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm)
+	now := end.Add(-time.Hour)
+	cred := &messages.KRBCred{Tickets: []messages.Ticket{{
+		TktVNO: 5, Realm: realm, SName: tgt,
+		EncPart: types.EncryptedData{EType: 18, KVNO: 1, Cipher: []byte("ticket")},
+	}}}
+	cred.DecryptedEncPart.TicketInfo = []messages.KrbCredInfo{{
+		Key:    types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+		PRealm: realm, PName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user),
+		AuthTime: now, StartTime: now, EndTime: end,
+		SRealm: realm, SName: tgt,
+	}}
+	path := filepath.Join(t.TempDir(), "krb5cc_"+user)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := krb.WriteCCache(f, cred); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func serveWhoAmI(t *testing.T, ccacheHeader string) whoami {
+	t.Helper()
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+
+	r := asUser(httptest.NewRequest(http.MethodGet, "/whoami", nil), "alice", "EX.COM")
+	if ccacheHeader != "" {
+		r.Header.Set("X_krb5ccname", ccacheHeader)
+	}
+	w := httptest.NewRecorder()
+	WhoAmIHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var out whoami
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestWhoAmI(t *testing.T) {
+	out := serveWhoAmI(t, "")
+	if out.Principal != "alice@EX.COM" || out.UserName != "alice" || out.Realm != "EX.COM" || out.Delegated != "" {
+		t.Fatalf("whoami = %+v", out)
+	}
+
+	// Делегированный ccache того же пользователя
+	out = serveWhoAmI(t, "FILE:"+writeTGTCCache(t, "alice", "EX.COM"))
+	if out.Delegated != "alice@EX.COM" || out.DelegatedError != "" {
+		t.Fatalf("delegated = %q, %q", out.Delegated, out.DelegatedError)
+	}
+	// Чужой ccache виден как расхождение
+	out = serveWhoAmI(t, writeTGTCCache(t, "bob", "EX.COM"))
+	if out.Principal != "alice@EX.COM" || out.Delegated != "bob@EX.COM" {
+		t.Fatalf("whoami = %+v", out)
+	}
+	out = serveWhoAmI(t, "relative/krb5cc")
+	if out.Delegated != "" || !strings.Contains(out.DelegatedError, "not absolute") {
+		t.Fatalf("delegated error = %q", out.DelegatedError)
+	}
+}
+
+func TestWhoAmIWithoutIdentity(t *testing.T) {
+	prev := appCfg
+	appCfg = appconfig.Defaults()
+	defer func() { appCfg = prev }()
+
+	w := httptest.NewRecorder()
+	WhoAmIHandler(w, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestPrincipalHeader(t *testing.T) {
+	h := PrincipalHeader(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), "X-Principal")
+
+	w := httptest.NewRecorder()
+	ctx := middleware.WithIdentity(context.Background(), testIdentity{user: "alice", realm: "EX.COM"})
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if got := w.Header().Get("X-Principal"); got != "alice@EX.COM" {
+		t.Fatalf("X-Principal = %q", got)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if _, ok := w.Header()["X-Principal"]; ok {
+		t.Fatal("header set without an identity")
+	}
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import "expvar"
+
+// Классы отказов, чтобы в метриках и логах отличать, почему запрос не прошёл.
+const (
+	AuthMissing = "auth-missing" // нет identity или делегированных кредов
+	AuthExpired = "auth-expired" // креды есть, но истекли/отвергнуты
+	AuthzDenied = "authz-denied" // пользователь известен, но прав нет
+	BadRequest  = "bad-request"  // некорректный запрос клиента
+	RateLimited = "rate-limited" // превышен лимит запросов принципала
+	BackendErr  = "backend-error"
+)
+
+var failuresByClass = expvar.NewMap("failures_total_by_class")
+
+// Failure учитывает отказ класса class.
+func Failure(class string) {
+	failuresByClass.Add(class, 1)
+	switch class {
+	case AuthMissing, AuthExpired, AuthzDenied:
+		authFailures.inc(class)
+	}
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func classCount(class string) int64 {
+	if v, ok := failuresByClass.Get(class).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func authFailureCount(class string) uint64 {
+	authFailures.mu.Lock()
+	defer authFailures.mu.Unlock()
+	return authFailures.byLabel[class]
+}
+
+func TestFailureClasses(t *testing.T) {
+	for _, tc := range []struct {
+		class string
+		auth  bool // попадает в auth_failures_total
+	}{
+		{AuthMissing, true},
+		{AuthExpired, true},
+		{AuthzDenied, true},
+		{BadRequest, false},
+		{RateLimited, false},
+		{BackendErr, false},
+	} {
+		before, authBefore := classCount(tc.class), authFailureCount(tc.class)
+		Failure(tc.class)
+		if got := classCount(tc.class) - before; got != 1 {
+			t.Errorf("%s: failures_total_by_class += %d", tc.class, got)
+		}
+		want := uint64(0)
+		if tc.auth {
+			want = 1
+		}
+		if got := authFailureCount(tc.class) - authBefore; got != want {
+			t.Errorf("%s: auth_failures_total += %d, want %d", tc.class, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+)
+
+// Учёт активных принципалов: у кого сейчас есть сессия IPA в кэше или пул
+// соединений к Postgres (не запросы в полёте). Счётчик ссылок, потому что у
+// одного пользователя может быть и сессия, и несколько пулов.
+var active = struct {
+	sync.Mutex
+	refs map[string]int
+}{refs: map[string]int{}}
+
+// Аутентификации по реалмам: имя пользователя в метку не попадает, чтобы
+// кардинальность не росла вместе с числом сотрудников.
+var authByRealm = expvar.NewMap("auth_total_by_realm")
+
+func init() {
+	expvar.Publish("active_principals", expvar.Func(func() any { return ActivePrincipals() }))
+}
+
+// SessionOpened отмечает, что у principal появилась сессия IPA в кэше или пул.
+func SessionOpened(principal string) {
+	active.Lock()
+	active.refs[principal]++
+	active.Unlock()
+}
+
+// SessionClosed парный к SessionOpened: сессия или пул выброшены.
+func SessionClosed(principal string) {
+	active.Lock()
+	if active.refs[principal] <= 1 {
+		delete(active.refs, principal)
+	} else {
+		active.refs[principal]--
+	}
+	active.Unlock()
+}
+
+// ActivePrincipals — число различных принципалов с живыми сессиями.
+func ActivePrincipals() int {
+	active.Lock()
+	defer active.Unlock()
+	return len(active.refs)
+}
+
+// AuthSucceeded учитывает успешную аутентификацию principal вида user@REALM.
+func AuthSucceeded(principal string) {
+	realm := "unknown"
+	if i := strings.LastIndex(principal, "@"); i >= 0 && i < len(principal)-1 {
+		realm = strings.ToUpper(principal[i+1:])
+	}
+	authByRealm.Add(realm, 1)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestActivePrincipalsCountsDistinctPrincipals(t *testing.T) {
+	base := ActivePrincipals()
+	SessionOpened("alice@EX.COM")
+	SessionOpened("alice@EX.COM") // сессия IPA и пул одного пользователя
+	SessionOpened("bob@EX.COM")
+	if got := ActivePrincipals() - base; got != 2 {
+		t.Fatalf("active = %d, want 2", got)
+	}
+	SessionClosed("alice@EX.COM")
+	if got := ActivePrincipals() - base; got != 2 {
+		t.Fatalf("alice still has a session: active = %d, want 2", got)
+	}
+	SessionClosed("alice@EX.COM")
+	SessionClosed("bob@EX.COM")
+	if got := ActivePrincipals() - base; got != 0 {
+		t.Fatalf("active = %d after all closed, want 0", got)
+	}
+	// Лишнее закрытие не уводит счётчик в минус
+	SessionClosed("bob@EX.COM")
+	if got := ActivePrincipals() - base; got != 0 {
+		t.Fatalf("active = %d after extra close, want 0", got)
+	}
+}
+
+func realmCount(realm string) int64 {
+	if v, ok := authByRealm.Get(realm).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestAuthSucceededByRealm(t *testing.T) {
+	for _, tc := range []struct {
+		principal, realm string
+	}{
+		{"alice@EX.COM", "EX.COM"},
+		{"bob@ad.example.org", "AD.EXAMPLE.ORG"}, // реалм в метке — в верхнем регистре
+		{"svc/host@EX.COM", "EX.COM"},
+		{"carol", "unknown"},
+		{"dave@", "unknown"},
+	} {
+		before := realmCount(tc.realm)
+		AuthSucceeded(tc.principal)
+		if got := realmCount(tc.realm) - before; got != 1 {
+			t.Errorf("%s: %s counter +%d, want +1", tc.principal, tc.realm, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Метрики в текстовом формате Prometheus (/metrics). Клиентская библиотека не
+// подключается: гистограмм с одной меткой и пары счётчиков хватает, а формат
+// экспозиции простой.
+
+// Границы корзин — как DefBuckets в client_golang, в секундах.
+var defBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // по корзинам, не накопительно
+	sum    float64
+	count  uint64
+}
+
+// histogramVec — гистограмма с одной меткой.
+type histogramVec struct {
+	name, help, label string
+	mu                sync.Mutex
+	byLabel           map[string]*histogram
+}
+
+func newHistogramVec(name, help, label string) *histogramVec {
+	return &histogramVec{name: name, help: help, label: label, byLabel: map[string]*histogram{}}
+}
+
+func (v *histogramVec) observe(label string, d time.Duration) {
+	s := d.Seconds()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h := v.byLabel[label]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(defBuckets))}
+		v.byLabel[label] = h
+	}
+	for i, le := range defBuckets {
+		if s <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+func (v *histogramVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, l := range sortedKeys(v.byLabel) {
+		h := v.byLabel[l]
+		lbl := v.label + "=" + strconv.Quote(l)
+		var cum uint64
+		for i, le := range defBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", v.name, lbl, formatFloat(le), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", v.name, lbl, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", v.name, lbl, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", v.name, lbl, h.count)
+	}
+}
+
+// counterVec — счётчик с одной меткой (пустое имя метки — без меток).
+type counterVec struct {
+	name, help, label string
+	mu                sync.Mutex
+	byLabel           map[string]uint64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{name: name, help: help, label: label, byLabel: map[string]uint64{}}
+}
+
+func (v *counterVec) inc(label string) {
+	v.mu.Lock()
+	v.byLabel[label]++
+	v.mu.Unlock()
+}
+
+func (v *counterVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	if v.label == "" {
+		fmt.Fprintf(w, "%s %d\n", v.name, v.byLabel[""])
+		return
+	}
+	for _, l := range sortedKeys(v.byLabel) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", v.name, v.label, strconv.Quote(l), v.byLabel[l])
+	}
+}
+
+var (
+	ipaDuration = newHistogramVec("ipa_rpc_duration_seconds",
+		"Duration of FreeIPA JSON-RPC calls.", "method")
+	pgDuration = newHistogramVec("postgres_query_duration_seconds",
+		"Duration of Postgres calls made under delegated credentials.", "op")
+	authFailures = newCounterVec("auth_failures_total",
+		"Requests rejected for missing, expired or insufficient credentials.", "class")
+	credExpired = newCounterVec("credential_expired_total",
+		"Requests rejected because delegated credentials had expired.", "")
+	ipaTickets = newCounterVec("ipa_ticket_cache_total",
+		"FreeIPA service ticket lookups: hit served from cache, miss went to the KDC.", "result")
+	ipaUserShows = newCounterVec("ipa_user_show_cache_total",
+		"FreeIPA user_show lookups: hit served from cache, miss went to FreeIPA.", "result")
+)
+
+// ObserveIPA учитывает длительность вызова метода IPA.
+func ObserveIPA(method string, d time.Duration) {
+	ipaDuration.observe(method, d)
+}
+
+// ObservePostgres учитывает длительность операции op (query, exec, tx,
+// describe, explain) в Postgres.
+func ObservePostgres(op string, d time.Duration) {
+	pgDuration.observe(op, d)
+}
+
+// CredentialExpired учитывает отказ из-за истёкших делегированных кредов.
+func CredentialExpired() {
+	credExpired.inc("")
+}
+
+// IPATicketCache учитывает билет к IPA: из кэша (hit) или от KDC (miss).
+func IPATicketCache(hit bool) {
+	if hit {
+		ipaTickets.inc("hit")
+	} else {
+		ipaTickets.inc("miss")
+	}
+}
+
+// IPAUserShowCache учитывает ответ user_show: из кэша (hit) или от IPA (miss).
+func IPAUserShowCache(hit bool) {
+	if hit {
+		ipaUserShows.inc("hit")
+	} else {
+		ipaUserShows.inc("miss")
+	}
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		ipaDuration.write(w)
+		pgDuration.write(w)
+		authFailures.write(w)
+		credExpired.write(w)
+		ipaTickets.write(w)
+		ipaUserShows.write(w)
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
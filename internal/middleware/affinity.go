@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+// DBAffinity привязывает все запросы к Postgres внутри HTTP-запроса к одному
+// соединению (см. pgx.WithAffinity) и закрывает его по завершении.
+func DBAffinity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, release := pgx.WithAffinity(r.Context())
+		defer release()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
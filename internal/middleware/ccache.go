@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+// Причины, по которым DelegatedCredentials отклоняет запрос. Истёкший TGT
+// приходит как pgx.ErrCredentialsExpired.
+var (
+	ErrNoDelegatedCredentials  = errors.New("no delegated credentials")
+	ErrBadDelegatedCredentials = errors.New("bad delegated credentials")
+)
+
+type ccacheKey struct{}
+
+// CCacheFromContext — имя ccache, положенное DelegatedCredentials или
+// заданное подставленной Identity ("" — нет).
+func CCacheFromContext(ctx context.Context) string {
+	if path, _ := ctx.Value(ccacheKey{}).(string); path != "" {
+		return path
+	}
+	return injectedCCache(ctx)
+}
+
+// CredentialsRejectFunc отвечает клиенту на отклонённые креды; err — одна из
+// ошибок выше (или обёрнутая в неё причина).
+type CredentialsRejectFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+var credentialsReject atomic.Pointer[CredentialsRejectFunc]
+
+// SetCredentialsReject подменяет ответ на отклонённые креды (по умолчанию —
+// 401 с текстом ошибки); nil возвращает ответ по умолчанию.
+func SetCredentialsReject(fn CredentialsRejectFunc) {
+	if fn == nil {
+		credentialsReject.Store(nil)
+		return
+	}
+	credentialsReject.Store(&fn)
+}
+
+func rejectCredentials(w http.ResponseWriter, r *http.Request, err error) {
+	if fn := credentialsReject.Load(); fn != nil {
+		(*fn)(w, r, err)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// DelegatedCredentials разбирает X_krb5ccname (или ccache от AcceptDelegation,
+// см. CCacheName) один раз на запрос: проверяет, что ccache читается, выписан
+// на того же принципала, что принял SPNEGO, и TGT в нём не истёк, и кладёт
+// имя в контекст (см. CCacheFromContext). Без заголовка или с негодным
+// ccache запрос дальше не идёт. Повторная обёртка ничего не делает; ccache
+// подставленной Identity (тесты) принимается без заголовка и проверок.
+func DelegatedCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CCacheFromContext(r.Context()) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		raw := CCacheName(r)
+		if raw == "" {
+			rejectCredentials(w, r, ErrNoDelegatedCredentials)
+			return
+		}
+		path, err := ParseCCacheName(raw)
+		var cc *credentials.CCache
+		if err == nil {
+			cc, err = krb.LoadCCache(r.Context(), path)
+		}
+		if err == nil {
+			err = checkCCachePrincipal(r, cc)
+		}
+		if err != nil {
+			rejectCredentials(w, r, fmt.Errorf("%w: %v", ErrBadDelegatedCredentials, err))
+			return
+		}
+		if _, err := pgx.CCacheExpiry(cc); errors.Is(err, pgx.ErrCredentialsExpired) {
+			rejectCredentials(w, r, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ccacheKey{}, path)
+		if id, ok := IdentityFromContext(ctx); ok {
+			// принципал сверен с ccache — по нему pgx выбирает пул пользователя
+			ctx = pgx.WithPrincipal(ctx, id.UserName()+"@"+id.Domain())
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkCCachePrincipal сверяет принципал ccache (он взят из файла и ничем не
+// подтверждён) с принципалом, который принял SPNEGO: чужой ccache иначе ушёл
+// бы в IPA и Postgres от имени другого пользователя. Без identity сверять не
+// с чем — решает auth.nil_identity в хэндлере.
+func checkCCachePrincipal(r *http.Request, cc *credentials.CCache) error {
+	id, ok := IdentityFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	want := id.UserName() + "@" + id.Domain()
+	got := cc.DefaultPrincipal.PrincipalName.PrincipalNameString() + "@" + cc.DefaultPrincipal.Realm
+	if got != want {
+		return fmt.Errorf("ccache principal %s does not match authenticated %s", got, want)
+	}
+	return nil
+}
+
+// ParseCCacheName разбирает значение X_krb5ccname в имя ccache для krb.LoadCCache.
+// Поддерживаются "FILE:/path", голый "/path", Windows-пути ("FILE:C:\path", "C:\path"),
+// "DIR:/dir" и типы, подключённые через krb.RegisterCCacheType. KCM:/KEYRING:
+// без подключённого источника отвергаются с подсказкой, а не открываются как файл.
+// Путь к файлу или каталогу должен быть абсолютным и без "..": имя приходит в
+// заголовке, и относительный путь разрешился бы от рабочего каталога сервиса.
+func ParseCCacheName(header string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", errors.New("empty ccache name")
+	}
+	if strings.ContainsRune(header, 0) {
+		return "", errors.New("NUL byte in ccache name")
+	}
+	typ, rest, found := strings.Cut(header, ":")
+	switch {
+	case !found:
+		return checkCCachePath(header)
+	case len(typ) == 1:
+		// буква диска, а не тип ccache
+		return checkCCachePath(header)
+	case strings.EqualFold(typ, "FILE"):
+		if rest == "" {
+			return "", fmt.Errorf("empty path in ccache name %q", header)
+		}
+		return checkCCachePath(rest)
+	case strings.EqualFold(typ, "DIR"):
+		// "DIR:/dir" или "DIR::/dir/tktXYZ"
+		if _, err := checkCCachePath(strings.TrimPrefix(rest, ":")); err != nil {
+			return "", err
+		}
+		return header, nil
+	case krb.HasCCacheType(typ):
+		// подключённый источник (KCM, KEYRING и т.п.) — имя уходит как есть
+		return header, nil
+	default:
+		return "", krb.UnsupportedCCacheType(typ)
+	}
+}
+
+// checkCCachePath принимает абсолютный путь (POSIX или Windows с буквой диска)
+// без элементов "..".
+func checkCCachePath(p string) (string, error) {
+	drive := len(p) >= 3 && p[1] == ':' && (p[2] == '\\' || p[2] == '/') &&
+		('a' <= p[0]|0x20 && p[0]|0x20 <= 'z')
+	if !strings.HasPrefix(p, "/") && !drive {
+		return "", fmt.Errorf("ccache path %q is not absolute", p)
+	}
+	for _, el := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if el == ".." {
+			return "", fmt.Errorf("ccache path %q contains \"..\"", p)
+		}
+	}
+	return p, nil
+}
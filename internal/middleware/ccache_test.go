@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/pgx"
+)
+
+type testIdentity struct{ user, realm string }
+
+func (i testIdentity) UserName() string   { return i.user }
+func (i testIdentity) Domain() string     { return i.realm }
+func (i testIdentity) CCachePath() string { return "" }
+
+// writeTestCCache пишет ccache с TGT principal@realm, истекающим в end.
+func writeTestCCache(t *testing.T, user, realm string, end time.Time) string {
+	t.Helper()
+	tgt := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm)
+	cred := &messages.KRBCred{Tickets: []messages.Ticket{{
+		TktVNO: 5, Realm: realm, SName: tgt,
+		EncPart: types.EncryptedData{EType: 18, KVNO: 1, Cipher: []byte("ticket")},
+	}}}
+	cred.DecryptedEncPart.TicketInfo = []messages.KrbCredInfo{{
+		Key:    types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+		PRealm: realm, PName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user),
+		AuthTime: end.Add(-time.Hour), StartTime: end.Add(-time.Hour), EndTime: end,
+		SRealm: realm, SName: tgt,
+	}}
+	path := filepath.Join(t.TempDir(), "krb5cc_test")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := krb.WriteCCache(f, cred); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serveDelegated прогоняет запрос с X_krb5ccname=path от имени id через
+// DelegatedCredentials; возвращает ccache, дошедший до хэндлера, и ошибку отказа.
+func serveDelegated(t *testing.T, id Identity, path string) (string, error) {
+	t.Helper()
+	var rejected error
+	SetCredentialsReject(func(w http.ResponseWriter, r *http.Request, err error) {
+		rejected = err
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	t.Cleanup(func() { SetCredentialsReject(nil) })
+
+	var got string
+	h := DelegatedCredentials(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = CCacheFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/user_show", nil)
+	r.Header.Set("X_krb5ccname", "FILE:"+path)
+	r = r.WithContext(WithIdentity(r.Context(), id))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return got, rejected
+}
+
+func TestDelegatedCredentialsMatchingPrincipal(t *testing.T) {
+	path := writeTestCCache(t, "alice", "EXAMPLE.COM", time.Now().Add(time.Hour))
+	got, err := serveDelegated(t, testIdentity{"alice", "EXAMPLE.COM"}, path)
+	if err != nil || got != path {
+		t.Fatalf("ccache=%q err=%v, want %q accepted", got, err, path)
+	}
+}
+
+func TestDelegatedCredentialsPrincipalMismatch(t *testing.T) {
+	path := writeTestCCache(t, "alice", "EXAMPLE.COM", time.Now().Add(time.Hour))
+	for _, id := range []testIdentity{
+		{"mallory", "EXAMPLE.COM"},
+		{"alice", "AD.EXAMPLE.ORG"}, // тот же логин из другого реалма
+		{"alice", "example.com"},    // реалмы регистрозависимы
+	} {
+		got, err := serveDelegated(t, id, path)
+		if got != "" || !errors.Is(err, ErrBadDelegatedCredentials) {
+			t.Errorf("%s@%s: ccache=%q err=%v, want %v", id.user, id.realm, got, err, ErrBadDelegatedCredentials)
+		}
+	}
+}
+
+func TestDelegatedCredentialsExpired(t *testing.T) {
+	path := writeTestCCache(t, "alice", "EXAMPLE.COM", time.Now().Add(-time.Minute))
+	got, err := serveDelegated(t, testIdentity{"alice", "EXAMPLE.COM"}, path)
+	if got != "" || !errors.Is(err, pgx.ErrCredentialsExpired) {
+		t.Fatalf("ccache=%q err=%v, want %v", got, err, pgx.ErrCredentialsExpired)
+	}
+}
+
+func TestDelegatedCredentialsUnreadable(t *testing.T) {
+	got, err := serveDelegated(t, testIdentity{"alice", "EXAMPLE.COM"}, filepath.Join(t.TempDir(), "missing"))
+	if got != "" || !errors.Is(err, ErrBadDelegatedCredentials) {
+		t.Fatalf("ccache=%q err=%v, want %v", got, err, ErrBadDelegatedCredentials)
+	}
+}
+
+func TestParseCCacheName(t *testing.T) {
+	for _, tc := range []struct {
+		header, want string
+		wantErr      error // nil — любая ошибка, если want пуст
+	}{
+		{header: "FILE:/run/krb5cc_1000", want: "/run/krb5cc_1000"},
+		{header: "file:/run/krb5cc_1000", want: "/run/krb5cc_1000"},
+		{header: "/run/krb5cc_1000", want: "/run/krb5cc_1000"},
+		{header: "  /run/krb5cc_1000\t", want: "/run/krb5cc_1000"},
+		{header: `C:\Users\alice\krb5cc`, want: `C:\Users\alice\krb5cc`},
+		{header: `FILE:C:\Users\alice\krb5cc`, want: `C:\Users\alice\krb5cc`},
+		{header: "FILE:d:/krb5cc", want: "d:/krb5cc"},
+		{header: "DIR:/run/user/1000/krb5cc", want: "DIR:/run/user/1000/krb5cc"},
+		{header: "DIR::/run/user/1000/krb5cc/tktABC", want: "DIR::/run/user/1000/krb5cc/tktABC"},
+		{header: "/run/krb5cc..1000", want: "/run/krb5cc..1000"}, // ".." внутри имени — не переход
+
+		{header: "KEYRING:persistent:1000", wantErr: krb.ErrUnsupportedCCacheType},
+		{header: "MEMORY:x", wantErr: krb.ErrUnsupportedCCacheType},
+		{header: "KCM:1000", wantErr: krb.ErrUnsupportedCCacheType},
+		{header: "BOGUS:/x", wantErr: krb.ErrUnsupportedCCacheType},
+		{header: ""},
+		{header: "   "},
+		{header: "FILE:"},
+		{header: "DIR:"},
+		{header: "krb5cc_1000"},
+		{header: "FILE:krb5cc_1000"},
+		{header: "./krb5cc"},
+		{header: "DIR:run/krb5cc"},
+		{header: "C:krb5cc"},
+		{header: "/run/../etc/shadow"},
+		{header: "FILE:/run/krb5cc/.."},
+		{header: `C:\run\..\secret`},
+		{header: "DIR::/run/../tkt"},
+		{header: "/run/krb5cc\x00/etc/passwd"},
+		{header: "FILE:/run/krb5cc_1000\x00"},
+	} {
+		got, err := ParseCCacheName(tc.header)
+		if tc.want != "" {
+			if err != nil || got != tc.want {
+				t.Errorf("%q: got %q, %v; want %q", tc.header, got, err, tc.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%q: accepted as %q", tc.header, got)
+		} else if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("%q: err = %v, want %v", tc.header, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// ParseTrustedProxies разбирает список CIDR (голый адрес — сеть из одного хоста).
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: not an address or CIDR", s)
+		}
+		out = append(out, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()))
+	}
+	return out, nil
+}
+
+// SetTrustedProxies задаёт прокси (Apache перед сервисом и т.п.), чьим
+// X-Forwarded-For/Forwarded можно верить. Пустой список — заголовки игнорируются.
+func SetTrustedProxies(p []netip.Prefix) {
+	trustedProxies.Store(&p)
+}
+
+func isTrustedProxy(a netip.Addr) bool {
+	p := trustedProxies.Load()
+	if p == nil || !a.IsValid() {
+		return false
+	}
+	for _, n := range *p {
+		if n.Contains(a.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPKey struct{}
+
+// ClientIPFromContext — адрес клиента, вычисленный ClientIP ("" — не вычислялся).
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// ClientIP кладёт в контекст реальный адрес клиента. Заголовкам прокси верим,
+// только если соединение пришло от доверенного прокси: цепочка адресов
+// проходится справа налево, доверенные прокси пропускаются, первый чужой адрес
+// и есть клиент. Подделанный клиентом заголовок так дальше его самого не уводит.
+// Ставится снаружи Logging.
+func ClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, resolveClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func resolveClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(remote) {
+		return host
+	}
+	chain := forwardedChain(r.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(chain[i])
+		if err != nil {
+			// мусор в цепочке — дальше ей не верим
+			return remote.String()
+		}
+		if !isTrustedProxy(a) {
+			return a.Unmap().String()
+		}
+	}
+	if len(chain) > 0 {
+		return chain[0]
+	}
+	return host
+}
+
+// forwardedChain — адреса из Forwarded (for=), а без него из X-Forwarded-For,
+// от клиента к последнему прокси.
+func forwardedChain(h http.Header) []string {
+	var chain []string
+	if vals := h.Values("Forwarded"); len(vals) > 0 {
+		for _, v := range vals {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if !ok || !strings.EqualFold(k, "for") {
+						continue
+					}
+					chain = append(chain, forwardedNode(val))
+				}
+			}
+		}
+		return chain
+	}
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				chain = append(chain, s)
+			}
+		}
+	}
+	return chain
+}
+
+// forwardedNode достаёт адрес из узла Forwarded: "192.0.2.1", "\"[2001:db8::1]:443\"".
+func forwardedNode(v string) string {
+	v = strings.Trim(strings.TrimSpace(v), `"`)
+	if strings.HasPrefix(v, "[") {
+		if end := strings.Index(v, "]"); end > 0 {
+			return v[1:end]
+		}
+	}
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		return host
+	}
+	return v
+}
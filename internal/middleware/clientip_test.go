@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func useTrustedProxies(t *testing.T, list ...string) {
+	t.Helper()
+	p, err := ParseTrustedProxies(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTrustedProxies(p)
+	t.Cleanup(func() { trustedProxies.Store(nil) })
+}
+
+func clientIPOf(remote string, header ...string) string {
+	var got string
+	h := ClientIP(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = ClientIPFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Add(header[i], header[i+1])
+	}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return got
+}
+
+func TestClientIP(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.0/8", "192.0.2.7")
+
+	for _, tc := range []struct {
+		name   string
+		remote string
+		header []string
+		want   string
+	}{
+		{"no proxy", "198.51.100.1:5555", nil, "198.51.100.1"},
+		// Заголовок от недоверенного адреса игнорируется
+		{"untrusted peer", "198.51.100.1:5555", []string{"X-Forwarded-For", "203.0.113.9"}, "198.51.100.1"},
+		{"trusted proxy", "10.1.1.1:5555", []string{"X-Forwarded-For", "203.0.113.9"}, "203.0.113.9"},
+		// Клиент подставил свой XFF: берётся первый недоверенный справа
+		{"spoofed", "10.1.1.1:5555", []string{"X-Forwarded-For", "1.2.3.4, 203.0.113.9"}, "203.0.113.9"},
+		{"proxy chain", "10.1.1.1:5555", []string{"X-Forwarded-For", "203.0.113.9, 192.0.2.7, 10.2.2.2"}, "203.0.113.9"},
+		{"repeated header", "10.1.1.1:5555", []string{"X-Forwarded-For", "203.0.113.9", "X-Forwarded-For", "10.2.2.2"}, "203.0.113.9"},
+		{"all trusted", "10.1.1.1:5555", []string{"X-Forwarded-For", "10.3.3.3, 10.2.2.2"}, "10.3.3.3"},
+		{"garbage", "10.1.1.1:5555", []string{"X-Forwarded-For", "203.0.113.9, not-an-ip"}, "10.1.1.1"},
+		{"trusted without header", "10.1.1.1:5555", nil, "10.1.1.1"},
+		// Forwarded важнее X-Forwarded-For
+		{"forwarded", "10.1.1.1:5555", []string{"Forwarded", `for=203.0.113.9;proto=https`, "X-Forwarded-For", "1.2.3.4"}, "203.0.113.9"},
+		{"forwarded ipv6", "10.1.1.1:5555", []string{"Forwarded", `for="[2001:db8::1]:443", for=10.2.2.2`}, "2001:db8::1"},
+		{"ipv4-mapped peer", "[::ffff:10.1.1.1]:5555", []string{"X-Forwarded-For", "203.0.113.9"}, "203.0.113.9"},
+	} {
+		if got := clientIPOf(tc.remote, tc.header...); got != tc.want {
+			t.Errorf("%s: client IP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	trustedProxies.Store(nil)
+	if got := clientIPOf("10.1.1.1:5555", "X-Forwarded-For", "203.0.113.9"); got != "10.1.1.1" {
+		t.Fatalf("client IP = %q", got)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	p, err := ParseTrustedProxies([]string{"10.1.2.3/8", "192.0.2.7", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 3 || p[0].String() != "10.0.0.0/8" || p[1].String() != "192.0.2.7/32" || p[2].String() != "2001:db8::/32" {
+		t.Fatalf("prefixes = %v", p)
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.ex.com"}); err == nil {
+		t.Fatal("host name accepted")
+	}
+}
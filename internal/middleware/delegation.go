@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// AcceptDelegation принимает TGT, переданный клиентом в AP_REQ (ContextFlagDeleg),
+// когда SPNEGO завершается в самом сервисе, без фронтенда, пишущего X_krb5ccname.
+// Креды пишутся во временный ccache в dir ("" — os.TempDir()) с правами 0600,
+// его путь кладётся в контекст запроса (см. CCacheName) — дальше работает
+// обычный DelegatedCredentials. Файл удаляется по завершении запроса.
+// X_krb5ccname от клиента при включённой мидлвари всегда удаляется (с
+// записью в лог): без фронтенда его выставил сам клиент, и верить ему
+// нельзя — иначе можно подсунуть чужой ccache.
+// Ставится ВНУТРИ SPNEGOKRB5Authenticate: AP_REQ здесь уже проверен.
+// Запросить делегирование сервер не может — решает клиент (политика браузера,
+// флаг ok-as-delegate у SPN); без TGT запрос идёт дальше без ccache.
+func AcceptDelegation(next http.Handler, kt *keytab.Keytab, dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		if r.Header.Get("X_krb5ccname") != "" {
+			log.Printf("accept delegation: %s: ignoring client-supplied X_krb5ccname", r.RemoteAddr)
+			r.Header.Del("X_krb5ccname")
+		}
+		path, err := writeDelegatedCCache(r, kt, dir)
+		switch {
+		case err == nil:
+			defer os.Remove(path)
+			r = r.WithContext(context.WithValue(r.Context(), forwardedCCacheKey{}, "FILE:"+path))
+		case !errors.Is(err, krb.ErrNoDelegation):
+			log.Printf("accept delegation: %s: %v", r.RemoteAddr, err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type forwardedCCacheKey struct{}
+
+// CCacheName — имя делегированного ccache запроса в виде X_krb5ccname:
+// ccache из TGT, принятого AcceptDelegation, иначе заголовок от фронтенда.
+func CCacheName(r *http.Request) string {
+	if name, _ := r.Context().Value(forwardedCCacheKey{}).(string); name != "" {
+		return name
+	}
+	return r.Header.Get("X_krb5ccname")
+}
+
+func writeDelegatedCCache(r *http.Request, kt *keytab.Keytab, dir string) (string, error) {
+	apReq, err := apReqFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+	cred, err := krb.ExtractDelegation(&apReq, kt)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "krb5cc_deleg_*")
+	if err != nil {
+		return "", err
+	}
+	// CreateTemp создаёт файл с 0600
+	if err = krb.WriteCCache(f, cred); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
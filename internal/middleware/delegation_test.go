@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+func TestAcceptDelegationDropsClientCCacheHeader(t *testing.T) {
+	var seen string
+	var seenHeader string
+	h := AcceptDelegation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, seenHeader = CCacheName(r), r.Header.Get("X_krb5ccname")
+	}), keytab.New(), t.TempDir())
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	r := httptest.NewRequest(http.MethodGet, "/user_show", nil)
+	r.Header.Set("X_krb5ccname", "FILE:/tmp/krb5cc_victim")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if seen != "" || seenHeader != "" {
+		t.Fatalf("client-supplied ccache reached the handler: name=%q header=%q", seen, seenHeader)
+	}
+	if !strings.Contains(logged.String(), "ignoring client-supplied X_krb5ccname") {
+		t.Fatalf("dropped header not logged: %q", logged.String())
+	}
+	if r.Header.Get("X_krb5ccname") == "" {
+		t.Fatal("original request headers must not be modified")
+	}
+}
+
+func TestAcceptDelegationRejectsClientCCacheDownstream(t *testing.T) {
+	var got error
+	SetCredentialsReject(func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer SetCredentialsReject(nil)
+
+	called := false
+	h := AcceptDelegation(DelegatedCredentials(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})), keytab.New(), t.TempDir())
+
+	r := httptest.NewRequest(http.MethodGet, "/user_show", nil)
+	r.Header.Set("X_krb5ccname", "FILE:/tmp/krb5cc_victim")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if called || rec.Code != http.StatusUnauthorized || !errors.Is(got, ErrNoDelegatedCredentials) {
+		t.Fatalf("called=%v status=%d err=%v, want 401 %v", called, rec.Code, got, ErrNoDelegatedCredentials)
+	}
+}
+
+func TestCCacheNamePrefersForwardedTGT(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X_krb5ccname", "FILE:/tmp/from-header")
+	if got := CCacheName(r); got != "FILE:/tmp/from-header" {
+		t.Fatalf("CCacheName = %q, want header value", got)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), forwardedCCacheKey{}, "FILE:/tmp/forwarded"))
+	if got := CCacheName(r); got != "FILE:/tmp/forwarded" {
+		t.Fatalf("CCacheName = %q, want forwarded ccache", got)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jcmturner/goidentity/v6"
+)
+
+// Identity — то, что хэндлерам нужно знать о клиенте: кто он и где его
+// делегированный ccache. В проде её даёт SPNEGO (см. Identify), в тестах
+// подставляется через WithIdentity без всего стека Kerberos.
+type Identity interface {
+	UserName() string
+	Domain() string
+	// CCachePath — имя делегированного ccache ("" — делегирования нет)
+	CCachePath() string
+}
+
+type identityKey struct{}
+
+// WithIdentity кладёт id в контекст; IdentityFromContext вернёт её как есть.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// krbIdentity — identity из SPNEGO; ccache дописывается из контекста, когда
+// его разобрал DelegatedCredentials. Прочие методы goidentity (DisplayName,
+// AuthTime, атрибуты PAC) доступны через приведение типа.
+type krbIdentity struct {
+	goidentity.Identity
+	ccache string
+}
+
+func (k krbIdentity) CCachePath() string { return k.ccache }
+
+// IdentityFromContext — identity клиента: подставленная через WithIdentity
+// или построенная из goidentity, которую положил SPNEGO. ok == false —
+// клиент не аутентифицирован.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	if !ok {
+		kid, _ := ctx.Value(goidentity.CTXKey).(goidentity.Identity)
+		if kid == nil {
+			return nil, false
+		}
+		id = krbIdentity{Identity: kid}
+	}
+	if k, isKrb := id.(krbIdentity); isKrb && k.ccache == "" {
+		k.ccache = CCacheFromContext(ctx)
+		id = k
+	}
+	return id, true
+}
+
+// Identify кладёт в контекст Identity из SPNEGO, если там ещё нет подставленной.
+// Ставится внутри SPNEGO-мидлвари.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(identityKey{}).(Identity); !ok {
+			if kid, _ := r.Context().Value(goidentity.CTXKey).(goidentity.Identity); kid != nil {
+				r = r.WithContext(WithIdentity(r.Context(), krbIdentity{Identity: kid}))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// injectedCCache — ccache подставленной (не SPNEGO) identity, если он задан.
+func injectedCCache(ctx context.Context) string {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	if !ok {
+		return ""
+	}
+	if _, isKrb := id.(krbIdentity); isKrb {
+		return ""
+	}
+	return id.CCachePath()
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// KeytabEntry — запись keytab, ключом которой был расшифрован билет клиента.
+type KeytabEntry struct {
+	Principal string
+	KVNO      int
+	EType     string
+}
+
+// KeytabAudit логирует, какая запись keytab (principal, kvno, enctype) подошла к
+// билету запроса. Ставится ВНУТРИ SPNEGOKRB5Authenticate: сюда доходят только
+// аутентифицированные запросы, а заголовок Authorization ещё на месте.
+// Помогает убедиться, что после ротации ключей клиенты пришли с новым kvno.
+func KeytabAudit(next http.Handler, kt *keytab.Keytab) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, err := UsedKeytabEntry(r, kt)
+		if err != nil {
+			log.Printf("keytab audit: %s: %v", r.RemoteAddr, err)
+		} else {
+			log.Printf("keytab audit: %s principal=%s kvno=%d enctype=%s", r.RemoteAddr, e.Principal, e.KVNO, e.EType)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UsedKeytabEntry достаёт из Negotiate-токена запроса билет и находит в kt ключ для него.
+func UsedKeytabEntry(r *http.Request, kt *keytab.Keytab) (KeytabEntry, error) {
+	tkt, err := ticketFromRequest(r)
+	if err != nil {
+		return KeytabEntry{}, err
+	}
+	_, kvno, err := kt.GetEncryptionKey(tkt.SName, tkt.Realm, tkt.EncPart.KVNO, tkt.EncPart.EType)
+	if err != nil {
+		return KeytabEntry{}, err
+	}
+	return KeytabEntry{
+		Principal: tkt.SName.PrincipalNameString() + "@" + tkt.Realm,
+		KVNO:      kvno,
+		EType:     etypeName(tkt.EncPart.EType),
+	}, nil
+}
+
+func ticketFromRequest(r *http.Request) (messages.Ticket, error) {
+	apReq, err := apReqFromRequest(r)
+	if err != nil {
+		return messages.Ticket{}, err
+	}
+	return apReq.Ticket, nil
+}
+
+// apReqFromRequest достаёт AP_REQ из Negotiate-заголовка запроса.
+func apReqFromRequest(r *http.Request) (messages.APReq, error) {
+	s := strings.SplitN(r.Header.Get(spnego.HTTPHeaderAuthRequest), " ", 2)
+	if len(s) != 2 || s[0] != spnego.HTTPHeaderAuthResponseValueKey {
+		return messages.APReq{}, errors.New("no negotiate authorization header")
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return messages.APReq{}, fmt.Errorf("decode negotiate header: %w", err)
+	}
+	// Либо SPNEGO-обёртка с KRB5 внутри, либо «голый» KRB5-токен
+	mech := b
+	var st spnego.SPNEGOToken
+	if st.Unmarshal(b) == nil && st.Init {
+		mech = st.NegTokenInit.MechTokenBytes
+	}
+	var k5 spnego.KRB5Token
+	if err := k5.Unmarshal(mech); err != nil {
+		return messages.APReq{}, fmt.Errorf("unmarshal krb5 token: %w", err)
+	}
+	if !k5.IsAPReq() {
+		return messages.APReq{}, errors.New("krb5 token is not AP_REQ")
+	}
+	return k5.APReq, nil
+}
+
+// etypeName — полное имя enctype (aes256-cts-hmac-sha1-96): у одного id в
+// ETypesByName несколько псевдонимов, берём самый длинный, чтобы в журнале
+// один ключ всегда назывался одинаково.
+func etypeName(id int32) string {
+	best := ""
+	for name, v := range etypeID.ETypesByName {
+		if v == id && (len(name) > len(best) || len(name) == len(best) && name < best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return fmt.Sprintf("%d", id)
+	}
+	return best
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// serviceKeytab — keytab сервиса: spn@EX.COM с ключом aes256 под kvno.
+func serviceKeytab(t *testing.T, kvno uint8, spns ...string) *keytab.Keytab {
+	t.Helper()
+	kt := keytab.New()
+	for _, spn := range spns {
+		if err := kt.AddEntry(spn, "EX.COM", "svcpw", time.Now(), kvno, 18); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kt
+}
+
+// apReqToken — KRB5-токен AP_REQ alice@EX.COM с билетом на spn, выписанным ключом из kt.
+func apReqToken(t *testing.T, kt *keytab.Keytab, spn string, kvno int) []byte {
+	t.Helper()
+	now := time.Now()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "alice")
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+	tkt, key, err := messages.NewTicket(cname, "EX.COM", sname, "EX.COM", types.NewKrbFlags(), kt, 18, kvno, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewWithPassword("alice", "EX.COM", "pw", config.New())
+	tok, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, []int{gssapi.ContextFlagInteg}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tok.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// spnegoAPReq — apReqToken в обёртке SPNEGO NegTokenInit.
+func spnegoAPReq(t *testing.T, kt *keytab.Keytab, spn string, kvno int) []byte {
+	t.Helper()
+	st := spnego.SPNEGOToken{Init: true}
+	st.NegTokenInit.MechTypes = append(st.NegTokenInit.MechTypes, gssapi.OIDKRB5.OID())
+	st.NegTokenInit.MechTokenBytes = apReqToken(t, kt, spn, kvno)
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestUsedKeytabEntry(t *testing.T) {
+	kt := serviceKeytab(t, 3, "HTTP/app.ex.com")
+	kt.AddEntry("HTTP/app.ex.com", "EX.COM", "oldpw", time.Now(), 2, 18)
+
+	for name, tok := range map[string][]byte{
+		"spnego":   spnegoAPReq(t, kt, "HTTP/app.ex.com", 3),
+		"raw krb5": apReqToken(t, kt, "HTTP/app.ex.com", 3),
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", negotiate(tok))
+		e, err := UsedKeytabEntry(r, kt)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if e != (KeytabEntry{Principal: "HTTP/app.ex.com@EX.COM", KVNO: 3, EType: "aes256-cts-hmac-sha1-96"}) {
+			t.Fatalf("%s: entry = %+v", name, e)
+		}
+	}
+
+	// Билет под kvno, которого в keytab нет (ключи уже сменили)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", negotiate(spnegoAPReq(t, serviceKeytab(t, 7, "HTTP/app.ex.com"), "HTTP/app.ex.com", 7)))
+	if _, err := UsedKeytabEntry(r, kt); err == nil {
+		t.Fatal("ticket with an unknown kvno matched a keytab entry")
+	}
+	if _, err := UsedKeytabEntry(httptest.NewRequest(http.MethodGet, "/", nil), kt); err == nil {
+		t.Fatal("request without Negotiate matched a keytab entry")
+	}
+}
+
+func TestKeytabAuditLogsEntry(t *testing.T) {
+	kt := serviceKeytab(t, 3, "HTTP/app.ex.com")
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	reached := false
+	h := KeytabAudit(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true }), kt)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", negotiate(spnegoAPReq(t, kt, "HTTP/app.ex.com", 3)))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !reached {
+		t.Fatal("audit must not block the request")
+	}
+	if want := "principal=HTTP/app.ex.com@EX.COM kvno=3 enctype=aes256-cts-hmac-sha1-96"; !strings.Contains(logged.String(), want) {
+		t.Fatalf("log = %q, want %q", logged.String(), want)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jcmturner/goidentity/v6"
+)
+
+var accessLog = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+type principalSlotKey struct{}
+
+// principalSlot заполняется изнутри SPNEGO (см. CapturePrincipal): сама
+// identity живёт в контексте запроса, который SPNEGO создаёт для next,
+// и снаружи её не видно.
+type principalSlot struct{ name string }
+
+// Logging пишет JSON-строку на каждый запрос: метод, путь, статус, длительность
+// и принципал. Ставится снаружи SPNEGO, чтобы попадали и его 401.
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		slot := &principalSlot{}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), principalSlotKey{}, slot))
+
+		next.ServeHTTP(sw, r)
+
+		if slot.name == "" {
+			if id := goidentity.FromHTTPRequestContext(r); id != nil {
+				slot.name = id.UserName() + "@" + id.Domain()
+			}
+		}
+		accessLog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("principal", slot.name),
+			slog.String("remote", r.RemoteAddr),
+			slog.String("client_ip", ClientIPFromContext(r.Context())),
+		)
+	})
+}
+
+// CapturePrincipal передаёт принципал аутентифицированного запроса в Logging.
+// Ставится ВНУТРИ SPNEGOKRB5Authenticate, до хэндлеров — так принципал
+// попадает в лог, даже если хэндлер сразу ответил 4xx.
+func CapturePrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slot, ok := r.Context().Value(principalSlotKey{}).(*principalSlot); ok {
+			if id := goidentity.FromHTTPRequestContext(r); id != nil {
+				slot.name = id.UserName() + "@" + id.Domain()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusWriter запоминает код ответа. Unwrap нужен http.ResponseController
+// (Flush, дедлайны записи при потоковой выгрузке).
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// OID механизма NTLMSSP — для понятного сообщения об отказе.
+const oidNTLM = "1.3.6.1.4.1.311.2.2.10"
+
+// KerberosOnly отклоняет попытки аутентификации не через Kerberos: схему
+// "NTLM", «голый» NTLMSSP в Negotiate и NegTokenInit, где предпочтительный
+// механизм не KRB5. Ответ — 401 с WWW-Authenticate: Negotiate, чтобы клиент
+// повторил с Kerberos, а не откатился на NTLM. Ставится СНАРУЖИ SPNEGO.
+func KerberosOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkKerberosMech(r.Header.Get(spnego.HTTPHeaderAuthRequest)); err != nil {
+			log.Printf("spnego: %s: %v", r.RemoteAddr, err)
+			w.Header().Set(spnego.HTTPHeaderAuthResponse, spnego.HTTPHeaderAuthResponseValueKey)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkKerberosMech разбирает заголовок Authorization. Пустой заголовок и
+// чужие схемы (не NTLM) пропускаются — с ними разберётся SPNEGO.
+func checkKerberosMech(header string) error {
+	scheme, value, _ := strings.Cut(header, " ")
+	switch {
+	case strings.EqualFold(scheme, "NTLM"):
+		return errors.New("NTLM authentication is not accepted, use Kerberos (Negotiate)")
+	case scheme != spnego.HTTPHeaderAuthResponseValueKey:
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil // битый токен отклонит SPNEGO
+	}
+	if bytes.HasPrefix(b, []byte("NTLMSSP\x00")) {
+		return errors.New("NTLM token in Negotiate is not accepted, only Kerberos")
+	}
+	var st spnego.SPNEGOToken
+	if st.Unmarshal(b) != nil || !st.Init || len(st.NegTokenInit.MechTypes) == 0 {
+		return nil // «голый» KRB5-токен или NegTokenResp
+	}
+	mech := st.NegTokenInit.MechTypes[0]
+	if mech.Equal(gssapi.OIDKRB5.OID()) || mech.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+		return nil
+	}
+	name := mech.String()
+	if name == oidNTLM {
+		name = "NTLM (" + name + ")"
+	}
+	return fmt.Errorf("SPNEGO mechanism %s is not accepted, only Kerberos", name)
+}
+
+// LimitNegotiate отклоняет Authorization длиннее max байт (base64 вместе со
+// схемой) с 431 — до base64 и ASN.1 в KerberosOnly и gokrb5. Билет с большим
+// PAC (пользователь AD во многих группах) занимает десятки килобайт, так что
+// порог не должен быть меньше MaxTokenSize клиентов. max <= 0 — без проверки.
+// Ставится СНАРУЖИ SPNEGO и KerberosOnly.
+func LimitNegotiate(next http.Handler, max int) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := len(r.Header.Get(spnego.HTTPHeaderAuthRequest)); n > max {
+			log.Printf("spnego: %s: authorization header of %d bytes exceeds %d", r.RemoteAddr, n, max)
+			http.Error(w, fmt.Sprintf("authorization header exceeds %d bytes", max), http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
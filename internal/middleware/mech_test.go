@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+func TestLimitNegotiate(t *testing.T) {
+	const max = 64
+	reached := false
+	h := LimitNegotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}), max)
+
+	atLimit := "Negotiate " + strings.Repeat("A", max-len("Negotiate "))
+	for _, tc := range []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"no header", "", http.StatusOK},
+		{"at limit", atLimit, http.StatusOK},
+		{"oversize", atLimit + "A", http.StatusRequestHeaderFieldsTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reached = false
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d", w.Code, tc.status)
+			}
+			if reached != (tc.status == http.StatusOK) {
+				t.Fatalf("next reached = %v with status %d", reached, w.Code)
+			}
+		})
+	}
+}
+
+func TestLimitNegotiateDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	h := LimitNegotiate(next, 0)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Negotiate "+strings.Repeat("A", 1<<16))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d with limit disabled", w.Code)
+	}
+}
+
+// negotiate — заголовок Authorization: Negotiate с токеном b.
+func negotiate(b []byte) string {
+	return "Negotiate " + base64.StdEncoding.EncodeToString(b)
+}
+
+// spnegoInit — NegTokenInit с механизмами mechs (первый — предпочтительный).
+func spnegoInit(t *testing.T, mechs ...[]int) []byte {
+	t.Helper()
+	st := spnego.SPNEGOToken{Init: true}
+	for _, m := range mechs {
+		oid := gssapi.OIDKRB5.OID()
+		st.NegTokenInit.MechTypes = append(st.NegTokenInit.MechTypes, append(oid[:0:0], m...))
+	}
+	st.NegTokenInit.MechTokenBytes = []byte{0x60, 0x00}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKerberosOnly(t *testing.T) {
+	var (
+		krb5   = []int{1, 2, 840, 113554, 1, 2, 2}
+		msKrb5 = []int{1, 2, 840, 48018, 1, 2, 2}
+		ntlm   = []int{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+	)
+	// «Голый» KRB5: GSS-токен с OID KRB5, а не SPNEGO
+	rawKRB5 := append([]byte{0x60, 0x0b, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x12, 0x01, 0x02, 0x02}, 0x01, 0x00)
+
+	reached := false
+	h := KerberosOnly(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true }))
+	for _, tc := range []struct {
+		name   string
+		header string
+		reject string
+	}{
+		{"no header", "", ""},
+		{"basic", "Basic YWxpY2U6eA==", ""},
+		{"NTLM scheme", "NTLM TlRMTVNTUAABAAAA", "NTLM authentication"},
+		{"NTLMSSP in Negotiate", negotiate([]byte("NTLMSSP\x00\x01\x00\x00\x00")), "NTLM token"},
+		{"SPNEGO KRB5", negotiate(spnegoInit(t, krb5, ntlm)), ""},
+		{"SPNEGO MS KRB5", negotiate(spnegoInit(t, msKrb5, krb5)), ""},
+		{"SPNEGO NTLM first", negotiate(spnegoInit(t, ntlm, krb5)), "NTLM (1.3.6.1.4.1.311.2.2.10)"},
+		{"raw KRB5", negotiate(rawKRB5), ""},
+		{"bad base64", "Negotiate !!!", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reached = false
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if tc.reject == "" {
+				if !reached || w.Code != http.StatusOK {
+					t.Fatalf("status = %d, reached = %v, want passed through", w.Code, reached)
+				}
+				return
+			}
+			if reached || w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tc.reject) {
+				t.Fatalf("status = %d, body = %q, want 401 with %q", w.Code, w.Body, tc.reject)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "Negotiate" {
+				t.Fatalf("WWW-Authenticate = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover перехватывает панику хэндлера: пишет в лог её значение и стек и
+// отвечает 500 с общим JSON-телом (как handlers.fail с кодом INTERNAL), без
+// подробностей для клиента. Если ответ уже начат, 500 не отправить — соединение
+// обрывается (http.ErrAbortHandler), чтобы клиент не принял обрывок за ответ.
+// Ставится снаружи SPNEGO, но внутри Logging: так в лог доступа попадает 500.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			accessLog.LogAttrs(r.Context(), slog.LevelError, "panic",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("panic", fmt.Sprint(v)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if sw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"code": "INTERNAL", "message": "internal server error"})
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
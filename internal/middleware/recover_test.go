@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureAccessLog пишет accessLog в буфер до конца теста.
+func captureAccessLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := accessLog
+	accessLog = slog.New(slog.NewJSONHandler(&buf, nil))
+	t.Cleanup(func() { accessLog = prev })
+	return &buf
+}
+
+func TestRecover(t *testing.T) {
+	logged := captureAccessLog(t)
+	h := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("secret detail")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user_show", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != "INTERNAL" {
+		t.Fatalf("body = %s (%v)", w.Body, err)
+	}
+	// Подробности — только в лог, клиенту нет
+	if strings.Contains(w.Body.String(), "secret detail") {
+		t.Fatalf("panic value leaked to the client: %s", w.Body)
+	}
+	var entry struct {
+		Msg   string `json:"msg"`
+		Path  string `json:"path"`
+		Panic string `json:"panic"`
+		Stack string `json:"stack"`
+	}
+	if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+		t.Fatalf("log %q: %v", logged, err)
+	}
+	if entry.Msg != "panic" || entry.Path != "/user_show" || entry.Panic != "secret detail" || !strings.Contains(entry.Stack, "recover_test.go") {
+		t.Fatalf("log entry = %+v", entry)
+	}
+}
+
+// Ответ уже начат — 500 не дописывается, соединение обрывается
+func TestRecoverAfterWrite(t *testing.T) {
+	captureAccessLog(t)
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"partial":`))
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", v)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != `{"partial":` {
+			t.Fatalf("response = %d %q", w.Code, w.Body)
+		}
+	}()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	t.Fatal("no panic after a partial response")
+}
+
+func TestRecoverPassesAbortHandler(t *testing.T) {
+	logged := captureAccessLog(t)
+	h := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("recovered %v", v)
+		}
+		if logged.Len() != 0 {
+			t.Fatalf("abort logged as a panic: %s", logged)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Router — обёртка над http.ServeMux, в которой методы маршрута объявляются явно.
+// На несовпадающий метод отвечает 405 с корректным заголовком Allow, одинаково
+// для всех маршрутов. HEAD разрешён везде, где разрешён GET.
+type Router struct {
+	mux *http.ServeMux
+}
+
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Handle регистрирует h на path для перечисленных методов.
+func (rt *Router) Handle(path string, h http.Handler, methods ...string) {
+	allowed := slices.Clone(methods)
+	if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	allow := strings.Join(allowed, ", ")
+
+	rt.mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(allowed, r.Method) {
+			w.Header().Set("Allow", allow)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+}
+
+func (rt *Router) HandleFunc(path string, h http.HandlerFunc, methods ...string) {
+	rt.Handle(path, h, methods...)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
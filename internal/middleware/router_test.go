@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterMethods(t *testing.T) {
+	rt := NewRouter()
+	rt.HandleFunc("/user_show", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("show")) }, http.MethodGet)
+	rt.HandleFunc("/user_add", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) }, http.MethodPost)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		allow        string
+	}{
+		{http.MethodGet, "/user_show", http.StatusOK, ""},
+		{http.MethodHead, "/user_show", http.StatusOK, ""},
+		{http.MethodPost, "/user_show", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodDelete, "/user_show", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPost, "/user_add", http.StatusCreated, ""},
+		{http.MethodGet, "/user_add", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodHead, "/user_add", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodGet, "/missing", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status || w.Header().Get("Allow") != tc.allow {
+			t.Errorf("%s %s: status = %d, Allow = %q; want %d, %q", tc.method, tc.path, w.Code, w.Header().Get("Allow"), tc.status, tc.allow)
+		}
+	}
+}
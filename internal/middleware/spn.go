@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// AcceptSPNs пропускает только запросы с билетом на один из spns ("HTTP/host"
+// или "HTTP/host@REALM"). gokrb5 подбирает ключ по sname билета, так что
+// SPNEGO принимает любой SPN из keytab; здесь список сужается до настроенного.
+// Ставится ВНУТРИ SPNEGOKRB5Authenticate, как и KeytabAudit.
+func AcceptSPNs(next http.Handler, spns []string) http.Handler {
+	type accepted struct{ name, realm string }
+	var allow []accepted
+	for _, s := range spns {
+		pn, realm := types.ParseSPNString(s)
+		allow = append(allow, accepted{name: strings.ToLower(pn.PrincipalNameString()), realm: realm})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tkt, err := ticketFromRequest(r)
+		if err != nil {
+			// Билета в заголовке нет (например, сессия SPNEGO уже установлена) — решает SPNEGO
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := strings.ToLower(tkt.SName.PrincipalNameString())
+		for _, a := range allow {
+			if a.name == name && (a.realm == "" || a.realm == tkt.Realm) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		log.Printf("spn: %s: ticket for %s@%s is not in the accepted SPN list", r.RemoteAddr, name, tkt.Realm)
+		http.Error(w, "ticket service principal is not accepted", http.StatusUnauthorized)
+	})
+}
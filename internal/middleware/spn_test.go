@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptSPNs(t *testing.T) {
+	kt := serviceKeytab(t, 1, "HTTP/app.ex.com", "HTTP/alias.ex.com", "HTTP/other.ex.com")
+	for _, tc := range []struct {
+		name   string
+		spns   []string
+		ticket string // "" — без заголовка Negotiate
+		ok     bool
+	}{
+		{"primary", []string{"HTTP/app.ex.com", "HTTP/alias.ex.com"}, "HTTP/app.ex.com", true},
+		{"alias", []string{"HTTP/app.ex.com", "HTTP/alias.ex.com"}, "HTTP/alias.ex.com", true},
+		{"in keytab but not accepted", []string{"HTTP/app.ex.com", "HTTP/alias.ex.com"}, "HTTP/other.ex.com", false},
+		{"host case", []string{"HTTP/APP.Ex.Com"}, "HTTP/app.ex.com", true},
+		{"same realm", []string{"HTTP/app.ex.com@EX.COM"}, "HTTP/app.ex.com", true},
+		{"other realm", []string{"HTTP/app.ex.com@OTHER.COM"}, "HTTP/app.ex.com", false},
+		{"no ticket", []string{"HTTP/app.ex.com"}, "", true},
+	} {
+		reached := false
+		h := AcceptSPNs(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true }), tc.spns)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.ticket != "" {
+			r.Header.Set("Authorization", negotiate(spnegoAPReq(t, kt, tc.ticket, 1)))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if reached != tc.ok || !tc.ok && w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: reached = %v, status = %d", tc.name, reached, w.Code)
+		}
+	}
+}
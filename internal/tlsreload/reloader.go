@@ -0,0 +1,96 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader отдаёт сертификат через tls.Config.GetCertificate и перечитывает
+// cert/key с диска, когда файлы меняются (например, после продления cert-manager).
+// Новые соединения получают новый сертификат, уже открытые не рвутся.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// New загружает пару cert/key; ошибка здесь — ошибка старта.
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch раз в interval проверяет время изменения файлов и перечитывает пару.
+// Если новая пара битая (например, записана наполовину), остаётся старый сертификат.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mt, err := r.latestModTime()
+			if err != nil {
+				log.Printf("tls reload: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := mt.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("tls reload: keeping previous certificate: %v", err)
+				continue
+			}
+			log.Printf("tls reload: certificate reloaded from %s", r.certFile)
+		}
+	}
+}
+
+func (r *Reloader) reload() error {
+	mt, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, mt
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		st, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
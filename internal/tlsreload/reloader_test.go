@@ -0,0 +1,123 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair пишет самоподписанную пару с CN=cn и временем изменения mtime.
+func writePair(t *testing.T, certFile, keyFile, cn string, mtime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), mtime)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), mtime)
+}
+
+func writeFile(t *testing.T, path string, b []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedCN(t *testing.T, r *Reloader) string {
+	t.Helper()
+	c, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+// waitCN ждёт, пока Watch подхватит сертификат cn.
+func waitCN(t *testing.T, r *Reloader, cn string) {
+	t.Helper()
+	for i := 0; i < 200 && servedCN(t, r) != cn; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := servedCN(t, r); got != cn {
+		t.Fatalf("served CN = %q, want %q", got, cn)
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+	writePair(t, certFile, keyFile, "first", start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := servedCN(t, r); cn != "first" {
+		t.Fatalf("served CN = %q", cn)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 5*time.Millisecond)
+
+	// Продление: новые файлы подхватываются без перезапуска
+	writePair(t, certFile, keyFile, "renewed", start.Add(time.Second))
+	waitCN(t, r, "renewed")
+
+	// Наполовину записанный сертификат — остаётся прежний
+	writeFile(t, certFile, []byte("-----BEGIN CERTIFICATE-----\n"), start.Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if cn := servedCN(t, r); cn != "renewed" {
+		t.Fatalf("served CN after a broken write = %q, want the previous one", cn)
+	}
+
+	// Дописанная пара после битой всё равно подхватывается
+	writePair(t, certFile, keyFile, "fixed", start.Add(3*time.Second))
+	waitCN(t, r, "fixed")
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if _, err := New(certFile, keyFile); err == nil {
+		t.Fatal("missing files accepted")
+	}
+	writePair(t, certFile, keyFile, "a", time.Now())
+	other := filepath.Join(dir, "other.key")
+	writePair(t, filepath.Join(dir, "other.crt"), other, "b", time.Now())
+	if _, err := New(certFile, other); err == nil {
+		t.Fatal("mismatched key accepted")
+	}
+}
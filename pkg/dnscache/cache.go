@@ -0,0 +1,90 @@
+// Package dnscache — короткоживущий кэш DNS для дайлеров исходящих соединений.
+package dnscache
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver кэширует LookupHost на ttl, а неудачные ответы — на negTTL,
+// чтобы недоступный DNS не дёргали на каждый запрос.
+type Resolver struct {
+	ttl, negTTL time.Duration
+	lookup      func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// New создаёт кэш поверх net.DefaultResolver.
+func New(ttl, negTTL time.Duration) *Resolver {
+	return &Resolver{
+		ttl:     ttl,
+		negTTL:  negTTL,
+		lookup:  net.DefaultResolver.LookupHost,
+		entries: map[string]entry{},
+	}
+}
+
+// LookupHost возвращает адреса host из кэша или резолвит заново.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	now := time.Now()
+	r.mu.Lock()
+	e, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.addrs, e.err
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if ctx.Err() != nil {
+		// Отмена запроса — не свойство имени, не кэшируем
+		return addrs, err
+	}
+	e = entry{addrs: addrs, err: err, expires: now.Add(r.ttl)}
+	if err != nil {
+		e.expires = now.Add(r.negTTL)
+	}
+	r.mu.Lock()
+	r.entries[host] = e
+	r.mu.Unlock()
+	return addrs, err
+}
+
+// DialContext — замена net.Dialer.DialContext: имя резолвится через кэш,
+// адреса перебираются по очереди, начиная со случайного.
+func (r *Resolver) DialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return d.DialContext(ctx, network, addr)
+		}
+		ips, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		start := rand.IntN(len(ips))
+		var lastErr error
+		for i := range ips {
+			ip := ips[(start+i)%len(ips)]
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,117 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// countingLookup отвечает answers[host] (nil — ошибкой) и считает вызовы.
+func countingLookup(r *Resolver, answers map[string][]string) *int {
+	n := 0
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		n++
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if addrs, ok := answers[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return &n
+}
+
+func TestLookupHostCaches(t *testing.T) {
+	r := New(50*time.Millisecond, time.Hour)
+	n := countingLookup(r, map[string][]string{"ipa.ex.com": {"10.0.0.1"}})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if addrs, err := r.LookupHost(ctx, "ipa.ex.com"); err != nil || addrs[0] != "10.0.0.1" {
+			t.Fatalf("LookupHost = %v, %v", addrs, err)
+		}
+	}
+	if *n != 1 {
+		t.Fatalf("lookups within ttl = %d, want 1", *n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	r.LookupHost(ctx, "ipa.ex.com")
+	if *n != 2 {
+		t.Fatalf("lookups after ttl = %d, want 2", *n)
+	}
+
+	// Отрицательный ответ живёт negTTL
+	for i := 0; i < 3; i++ {
+		if _, err := r.LookupHost(ctx, "missing.ex.com"); err == nil {
+			t.Fatal("missing host resolved")
+		}
+	}
+	if *n != 3 {
+		t.Fatalf("lookups of a missing host = %d, want 1 more", *n-2)
+	}
+}
+
+func TestLookupHostSkipsCancelled(t *testing.T) {
+	r := New(time.Hour, time.Hour)
+	n := countingLookup(r, map[string][]string{"ipa.ex.com": {"10.0.0.1"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.LookupHost(ctx, "ipa.ex.com"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	// Отмена одного запроса не отравляет кэш для следующих
+	if addrs, err := r.LookupHost(context.Background(), "ipa.ex.com"); err != nil || len(addrs) != 1 || *n != 2 {
+		t.Fatalf("LookupHost = %v, %v after %d lookups", addrs, err, *n)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	r := New(time.Hour, time.Hour)
+	n := countingLookup(r, map[string][]string{"ipa.ex.com": {"127.0.0.1"}, "empty.ex.com": {}})
+	dial := r.DialContext(&net.Dialer{Timeout: time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		c, err := dial(ctx, "tcp", net.JoinHostPort("ipa.ex.com", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	}
+	// IP-адрес не резолвится
+	c, err := dial(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if *n != 1 {
+		t.Fatalf("lookups = %d, want 1", *n)
+	}
+
+	var dnsErr *net.DNSError
+	if _, err := dial(ctx, "tcp", net.JoinHostPort("missing.ex.com", port)); !errors.As(err, &dnsErr) {
+		t.Fatalf("missing host: err = %v", err)
+	}
+	if _, err := dial(ctx, "tcp", net.JoinHostPort("empty.ex.com", port)); !errors.As(err, &dnsErr) {
+		t.Fatalf("host without addresses: err = %v", err)
+	}
+}
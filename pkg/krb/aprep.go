@@ -0,0 +1,33 @@
+package krb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrAPRepMismatch — AP_REP не подтверждает наш аутентификатор: сервер не знает
+// сессионного ключа билета, то есть это не тот сервис, которому выдан билет.
+var ErrAPRepMismatch = errors.New("AP_REP does not match the authenticator (server not verified)")
+
+// VerifyAPRep проверяет взаимную аутентификацию (RFC 4120 3.2.5): EncAPRepPart
+// расшифровывается сессионным ключом, а ctime/cusec в нём должны совпасть
+// с отправленным аутентификатором. Возвращает расшифрованную часть (subkey, seq).
+func VerifyAPRep(rep messages.APRep, sessionKey types.EncryptionKey, auth types.Authenticator) (messages.EncAPRepPart, error) {
+	var enc messages.EncAPRepPart
+	b, err := crypto.DecryptEncPart(rep.EncPart, sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return enc, fmt.Errorf("decrypt AP_REP: %w", err)
+	}
+	if err := enc.Unmarshal(b); err != nil {
+		return enc, fmt.Errorf("unmarshal AP_REP: %w", err)
+	}
+	if !enc.CTime.Equal(auth.CTime) || enc.Cusec != auth.Cusec {
+		return enc, ErrAPRepMismatch
+	}
+	return enc, nil
+}
@@ -0,0 +1,143 @@
+package krb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+// CCacheSource отдаёт кэш билетов. По умолчанию это файл (FILE:), но развёртывание
+// может подключить keyring, KCM или память через RegisterCCacheType.
+type CCacheSource interface {
+	Load(ctx context.Context) (*credentials.CCache, error)
+}
+
+// ErrCCacheIncomplete — файл ccache пуст или обрывается посередине: обычно
+// фронтенд ещё дописывает делегированные креды.
+var ErrCCacheIncomplete = errors.New("ccache is incomplete")
+
+// FileCCache — ccache в файле (формат MIT, версия 4).
+type FileCCache string
+
+// Load при недописанном файле повторяет чтение по политике SetCCacheGraceRetry.
+func (p FileCCache) Load(ctx context.Context) (*credentials.CCache, error) {
+	cc, err := loadCCacheFile(string(p))
+	policy := ccacheRetry.Load()
+	if policy == nil {
+		return cc, err
+	}
+	for attempt := 0; attempt < policy.attempts && errors.Is(err, ErrCCacheIncomplete); attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(policy.backoff << attempt):
+		}
+		cc, err = loadCCacheFile(string(p))
+	}
+	return cc, err
+}
+
+// loadCCacheFile — credentials.LoadCCache, который на обрезанном файле не
+// паникует (парсер gokrb5 читает за концом буфера), а возвращает ErrCCacheIncomplete.
+func loadCCacheFile(path string) (cc *credentials.CCache, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrCCacheIncomplete)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			cc, err = nil, fmt.Errorf("%s: %w (%v)", path, ErrCCacheIncomplete, r)
+		}
+	}()
+	cc = new(credentials.CCache)
+	// Ёмкость ровно по длине: иначе парсер молча читает нули из запаса
+	// ёмкости за концом файла и принимает обрезанный ccache за целый
+	if err := cc.Unmarshal(b[:len(b):len(b)]); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+type graceRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+var ccacheRetry atomic.Pointer[graceRetry]
+
+// SetCCacheGraceRetry включает до attempts повторных чтений файлового ccache
+// с экспоненциальным бэкоффом от backoff, пока файл недописан
+// (ErrCCacheIncomplete). attempts <= 0 отключает повторы.
+func SetCCacheGraceRetry(attempts int, backoff time.Duration) {
+	if attempts <= 0 {
+		ccacheRetry.Store(nil)
+		return
+	}
+	ccacheRetry.Store(&graceRetry{attempts: attempts, backoff: backoff})
+}
+
+// StaticCCache — уже разобранный ccache в памяти.
+type StaticCCache struct {
+	CC *credentials.CCache
+}
+
+func (s StaticCCache) Load(context.Context) (*credentials.CCache, error) {
+	return s.CC, nil
+}
+
+var (
+	ccacheTypesMu sync.RWMutex
+	ccacheTypes   = map[string]func(residual string) (CCacheSource, error){}
+)
+
+// RegisterCCacheType подключает тип ccache (например "KCM" или "KEYRING"):
+// имена вида "TYPE:residual" будут открываться через open.
+func RegisterCCacheType(typ string, open func(residual string) (CCacheSource, error)) {
+	ccacheTypesMu.Lock()
+	defer ccacheTypesMu.Unlock()
+	ccacheTypes[strings.ToUpper(typ)] = open
+}
+
+// HasCCacheType сообщает, зарегистрирован ли тип ccache.
+func HasCCacheType(typ string) bool {
+	ccacheTypesMu.RLock()
+	defer ccacheTypesMu.RUnlock()
+	return ccacheTypes[strings.ToUpper(typ)] != nil
+}
+
+// ResolveCCache превращает имя ccache ("FILE:/p", "/p", "C:\p", "TYPE:x") в источник.
+func ResolveCCache(name string) (CCacheSource, error) {
+	typ, rest, found := strings.Cut(name, ":")
+	if !found || len(typ) == 1 { // без типа или буква диска
+		return FileCCache(name), nil
+	}
+	if strings.EqualFold(typ, "FILE") {
+		return FileCCache(rest), nil
+	}
+	ccacheTypesMu.RLock()
+	open := ccacheTypes[strings.ToUpper(typ)]
+	ccacheTypesMu.RUnlock()
+	if open == nil {
+		return nil, UnsupportedCCacheType(typ)
+	}
+	return open(rest)
+}
+
+// LoadCCache загружает ccache по имени через соответствующий источник.
+func LoadCCache(ctx context.Context, name string) (*credentials.CCache, error) {
+	src, err := ResolveCCache(name)
+	if err != nil {
+		return nil, err
+	}
+	return src.Load(ctx)
+}
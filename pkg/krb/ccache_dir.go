@@ -0,0 +1,71 @@
+package krb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+// ErrUnsupportedCCacheType — тип ccache, который этот процесс прочитать не
+// может (KCM, KEYRING и т.п. без подключённого через RegisterCCacheType источника).
+var ErrUnsupportedCCacheType = errors.New("unsupported ccache type")
+
+// Типы MIT krb5, которых нет в gokrb5: билеты живут в демоне (KCM, sssd-kcm)
+// или в ядре (KEYRING), а не в файле — открывать их как файл бессмысленно.
+var memoryCCacheTypes = map[string]bool{"KCM": true, "KEYRING": true, "MEMORY": true, "MSLSA": true, "API": true}
+
+// UnsupportedCCacheType — ошибка для типа без источника; для KCM/KEYRING
+// и прочих «памятных» типов — с подсказкой, что делать.
+func UnsupportedCCacheType(typ string) error {
+	typ = strings.ToUpper(typ)
+	if memoryCCacheTypes[typ] {
+		return fmt.Errorf("%w %q: gokrb5 reads only file-based ccaches; have the frontend store delegated credentials as FILE: or DIR: (mod_auth_gssapi GssapiDelegCcacheDir) or register a loader with krb.RegisterCCacheType", ErrUnsupportedCCacheType, typ)
+	}
+	return fmt.Errorf("%w %q", ErrUnsupportedCCacheType, typ)
+}
+
+// DirCCache — коллекция DIR: каталог с файлами tkt*, основной из которых
+// назван в файле "primary". "DIR::/dir/tktXYZ" указывает на конкретный файл.
+type DirCCache string
+
+func (d DirCCache) Load(ctx context.Context) (*credentials.CCache, error) {
+	path, err := d.primary()
+	if err != nil {
+		return nil, err
+	}
+	return FileCCache(path).Load(ctx)
+}
+
+func (d DirCCache) primary() (string, error) {
+	residual := string(d)
+	if file, ok := strings.CutPrefix(residual, ":"); ok {
+		return file, nil
+	}
+	b, err := os.ReadFile(filepath.Join(residual, "primary"))
+	if errors.Is(err, os.ErrNotExist) {
+		// как в MIT: без primary основным считается "tkt"
+		return filepath.Join(residual, "tkt"), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("DIR ccache %s: %w", residual, err)
+	}
+	name := strings.TrimSpace(string(b))
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("DIR ccache %s: bad primary entry %q", residual, name)
+	}
+	return filepath.Join(residual, name), nil
+}
+
+func init() {
+	RegisterCCacheType("DIR", func(residual string) (CCacheSource, error) {
+		if residual == "" || residual == ":" {
+			return nil, errors.New("empty path in DIR ccache name")
+		}
+		return DirCCache(residual), nil
+	})
+}
@@ -0,0 +1,148 @@
+package krb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// writeCCacheFile пишет ccache с TGT user@EX.COM и возвращает путь.
+func writeCCacheFile(t *testing.T, user string) string {
+	t.Helper()
+	tgt := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/EX.COM")
+	now := time.Now()
+	cred := &messages.KRBCred{Tickets: []messages.Ticket{{
+		TktVNO: 5, Realm: "EX.COM", SName: tgt,
+		EncPart: types.EncryptedData{EType: 18, KVNO: 1, Cipher: []byte("ticket")},
+	}}}
+	cred.DecryptedEncPart.TicketInfo = []messages.KrbCredInfo{{
+		Key:    types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+		PRealm: "EX.COM", PName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user),
+		AuthTime: now, StartTime: now, EndTime: now.Add(time.Hour),
+		SRealm: "EX.COM", SName: tgt,
+	}}
+	path := filepath.Join(t.TempDir(), "krb5cc_"+user)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteCCache(f, cred); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveCCache(t *testing.T) {
+	for name, want := range map[string]CCacheSource{
+		"/tmp/krb5cc_1":      FileCCache("/tmp/krb5cc_1"),
+		"FILE:/tmp/krb5cc_1": FileCCache("/tmp/krb5cc_1"),
+		"file:/tmp/krb5cc_1": FileCCache("/tmp/krb5cc_1"),
+		`C:\krb5cc_1`:        FileCCache(`C:\krb5cc_1`),
+	} {
+		got, err := ResolveCCache(name)
+		if err != nil || got != want {
+			t.Errorf("ResolveCCache(%q) = %#v, %v; want %#v", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"KCM:1000", "NOSUCH:x"} {
+		if _, err := ResolveCCache(name); !errors.Is(err, ErrUnsupportedCCacheType) {
+			t.Errorf("ResolveCCache(%q) err = %v", name, err)
+		}
+	}
+}
+
+func TestRegisterCCacheType(t *testing.T) {
+	cc, err := FileCCache(writeCCacheFile(t, "alice")).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var residual string
+	RegisterCCacheType("testmem", func(r string) (CCacheSource, error) {
+		residual = r
+		return StaticCCache{CC: cc}, nil
+	})
+	if !HasCCacheType("TESTMEM") {
+		t.Fatal("registered type not found")
+	}
+
+	got, err := LoadCCache(context.Background(), "TestMem:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != cc || residual != "alice" {
+		t.Fatalf("loaded %p (want %p), residual %q", got, cc, residual)
+	}
+	if p := got.GetClientPrincipalName().PrincipalNameString(); p != "alice" {
+		t.Fatalf("principal = %q", p)
+	}
+}
+
+func TestLoadTruncatedCCache(t *testing.T) {
+	path := writeCCacheFile(t, "alice")
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Обрыв внутри заголовка и внутри единственной записи
+	for _, n := range []int{0, 1, 20, len(full) / 2, len(full) - 1} {
+		if err := os.WriteFile(path, full[:n], 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FileCCache(path).Load(context.Background()); !errors.Is(err, ErrCCacheIncomplete) {
+			t.Errorf("%d of %d bytes: err = %v", n, len(full), err)
+		}
+	}
+}
+
+func TestFileCCacheGraceRetry(t *testing.T) {
+	full, err := os.ReadFile(writeCCacheFile(t, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "krb5cc_alice")
+	if err := os.WriteFile(path, full[:len(full)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	SetCCacheGraceRetry(3, 50*time.Millisecond)
+	t.Cleanup(func() { SetCCacheGraceRetry(0, 0) })
+
+	// Фронтенд дописывает ccache после первой попытки чтения
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tmp := filepath.Join(dir, "krb5cc_alice.tmp")
+		if os.WriteFile(tmp, full, 0o600) == nil {
+			os.Rename(tmp, path)
+		}
+	}()
+	cc, err := FileCCache(path).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cc.GetClientPrincipalName().PrincipalNameString(); p != "alice" || len(cc.Credentials) != 1 {
+		t.Fatalf("principal = %q, %d credentials", p, len(cc.Credentials))
+	}
+
+	// Так и не дописанный файл — ошибка после повторов, отмена их прерывает
+	if err := os.WriteFile(path, full[:len(full)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	SetCCacheGraceRetry(2, time.Millisecond)
+	if _, err := FileCCache(path).Load(context.Background()); !errors.Is(err, ErrCCacheIncomplete) {
+		t.Fatalf("after retries: err = %v", err)
+	}
+	SetCCacheGraceRetry(3, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := FileCCache(path).Load(ctx); !errors.Is(err, ErrCCacheIncomplete) {
+		t.Fatalf("cancelled: err = %v", err)
+	}
+}
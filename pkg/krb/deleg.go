@@ -0,0 +1,143 @@
+package krb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrNoDelegation — клиент не передал TGT в AP_REQ (флаг Deleg не выставлен:
+// браузер не доверяет хосту для делегирования или у SPN нет ok-as-delegate).
+var ErrNoDelegation = errors.New("client did not delegate credentials")
+
+// Флаг Deleg в контрольной сумме GSS (RFC 4121, 4.1.1)
+const gssChecksumDeleg = 1
+
+// ExtractDelegation достаёт делегированные креды (KRB-CRED) из AP_REQ,
+// уже принятого SPNEGO: расшифровывает билет ключом из kt, аутентификатор —
+// сессионным ключом и читает KRB-CRED из контрольной суммы 0x8003.
+func ExtractDelegation(apReq *messages.APReq, kt *keytab.Keytab) (*messages.KRBCred, error) {
+	tkt := apReq.Ticket
+	if err := tkt.DecryptEncPart(kt, nil); err != nil {
+		return nil, fmt.Errorf("decrypt ticket: %w", err)
+	}
+	sessionKey := tkt.DecryptedEncPart.Key
+	if err := apReq.DecryptAuthenticator(sessionKey); err != nil {
+		return nil, fmt.Errorf("decrypt authenticator: %w", err)
+	}
+	auth := apReq.Authenticator
+	if auth.Cksum.CksumType != chksumtype.GSSAPI {
+		return nil, ErrNoDelegation
+	}
+	// Lgth(4) | Bnd(16) | Flags(4) | DlgOpt(2) | Dlgth(2) | KRB-CRED — little-endian
+	c := auth.Cksum.Checksum
+	if len(c) < 24 || binary.LittleEndian.Uint32(c[20:24])&gssChecksumDeleg == 0 {
+		return nil, ErrNoDelegation
+	}
+	if len(c) < 28 {
+		return nil, errors.New("delegation: truncated authenticator checksum")
+	}
+	n := int(binary.LittleEndian.Uint16(c[26:28]))
+	if len(c) < 28+n {
+		return nil, errors.New("delegation: truncated KRB-CRED in authenticator checksum")
+	}
+	var cred messages.KRBCred
+	if err := cred.Unmarshal(c[28 : 28+n]); err != nil {
+		return nil, fmt.Errorf("delegation: %w", err)
+	}
+	if err := decryptKRBCred(&cred, auth.SubKey, sessionKey); err != nil {
+		return nil, err
+	}
+	if len(cred.Tickets) == 0 || len(cred.Tickets) != len(cred.DecryptedEncPart.TicketInfo) {
+		return nil, errors.New("delegation: KRB-CRED without tickets")
+	}
+	return &cred, nil
+}
+
+// decryptKRBCred: MIT шифрует KRB-CRED сессионным ключом, часть реализаций —
+// подключом аутентификатора, а некоторые шлют его с etype 0 (без шифрования).
+func decryptKRBCred(cred *messages.KRBCred, subKey, sessionKey types.EncryptionKey) error {
+	if cred.EncPart.EType == 0 {
+		return cred.DecryptedEncPart.Unmarshal(cred.EncPart.Cipher)
+	}
+	var err error
+	for _, k := range []types.EncryptionKey{subKey, sessionKey} {
+		if len(k.KeyValue) == 0 {
+			continue
+		}
+		if err = cred.DecryptEncPart(k); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("delegation: %w", err)
+}
+
+// WriteCCache пишет креды из KRB-CRED в формате файлового ccache MIT (v4),
+// который читают krb.LoadCCache, gokrb5 и libkrb5.
+func WriteCCache(w io.Writer, cred *messages.KRBCred) error {
+	infos := cred.DecryptedEncPart.TicketInfo
+	if len(infos) == 0 {
+		return errors.New("ccache: no credentials")
+	}
+	var b bytes.Buffer
+	be := func(v any) { binary.Write(&b, binary.BigEndian, v) }
+	data := func(p []byte) {
+		be(uint32(len(p)))
+		b.Write(p)
+	}
+	principal := func(realm string, name types.PrincipalName) {
+		be(uint32(name.NameType))
+		be(uint32(len(name.NameString)))
+		data([]byte(realm))
+		for _, s := range name.NameString {
+			data([]byte(s))
+		}
+	}
+	unix := func(t time.Time) {
+		if t.IsZero() {
+			be(uint32(0))
+			return
+		}
+		be(uint32(t.Unix()))
+	}
+
+	be(uint16(0x0504)) // версия 4
+	be(uint16(0))      // без полей заголовка
+	principal(infos[0].PRealm, infos[0].PName)
+	for i, info := range infos {
+		tkt, err := cred.Tickets[i].Marshal()
+		if err != nil {
+			return fmt.Errorf("ccache: marshal ticket: %w", err)
+		}
+		principal(info.PRealm, info.PName)
+		principal(info.SRealm, info.SName)
+		be(uint16(info.Key.KeyType))
+		data(info.Key.KeyValue)
+		unix(info.AuthTime)
+		unix(info.StartTime)
+		unix(info.EndTime)
+		unix(info.RenewTill)
+		b.WriteByte(0) // is_skey
+		var flags [4]byte
+		copy(flags[:], info.Flags.Bytes)
+		b.Write(flags[:])
+		be(uint32(len(info.CAddr)))
+		for _, a := range info.CAddr {
+			be(uint16(a.AddrType))
+			data(a.Address)
+		}
+		be(uint32(0)) // authdata
+		data(tkt)
+		data(nil) // second_ticket
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,52 @@
+package krb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// KeytabHasSPN сообщает, есть ли в kt запись для spn ("HTTP/host" или "HTTP/host@REALM").
+func KeytabHasSPN(kt *keytab.Keytab, spn string) bool {
+	pn, realm := types.ParseSPNString(spn)
+	want := strings.Join(pn.NameString, "/")
+	for _, e := range kt.Entries {
+		if (realm == "" || e.Principal.Realm == realm) &&
+			strings.Join(e.Principal.Components, "/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateKeytabSPN проверяет, что spn задан в виде "service/host" (можно с
+// "@REALM") и что в kt есть для него ключ. Ошибка перечисляет принципалы
+// keytab — без этого SPNEGO потом молча отклоняет каждый запрос.
+func ValidateKeytabSPN(kt *keytab.Keytab, spn string) error {
+	if strings.TrimSpace(spn) == "" {
+		return errors.New("spn is empty")
+	}
+	pn, _ := types.ParseSPNString(spn)
+	if len(pn.NameString) != 2 || pn.NameString[0] == "" || pn.NameString[1] == "" {
+		return fmt.Errorf("spn %q is not in service/host form", spn)
+	}
+	if KeytabHasSPN(kt, spn) {
+		return nil
+	}
+	seen := map[string]bool{}
+	var have []string
+	for _, e := range kt.Entries {
+		p := strings.Join(e.Principal.Components, "/") + "@" + e.Principal.Realm
+		if !seen[p] {
+			seen[p] = true
+			have = append(have, p)
+		}
+	}
+	if len(have) == 0 {
+		return fmt.Errorf("keytab has no entries, want %s", spn)
+	}
+	return fmt.Errorf("keytab has no entry for %s (have: %s)", spn, strings.Join(have, ", "))
+}
@@ -0,0 +1,50 @@
+package krb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+func testKeytab(t *testing.T, principals ...string) *keytab.Keytab {
+	t.Helper()
+	kt := keytab.New()
+	for _, p := range principals {
+		if err := kt.AddEntry(p, "EX.COM", "secret", time.Now(), 1, 18); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kt
+}
+
+func TestValidateKeytabSPN(t *testing.T) {
+	kt := testKeytab(t, "HTTP/web.ex.com", "host/web.ex.com")
+	for _, tc := range []struct {
+		name string
+		kt   *keytab.Keytab
+		spn  string
+		want string // "" — ошибки нет
+	}{
+		{"match", kt, "HTTP/web.ex.com", ""},
+		{"match with realm", kt, "HTTP/web.ex.com@EX.COM", ""},
+		{"other realm", kt, "HTTP/web.ex.com@OTHER.COM", "no entry for HTTP/web.ex.com@OTHER.COM"},
+		{"missing", kt, "HTTP/api.ex.com", "have: HTTP/web.ex.com@EX.COM, host/web.ex.com@EX.COM"},
+		{"empty keytab", testKeytab(t), "HTTP/web.ex.com", "keytab has no entries"},
+		{"empty", kt, " ", "spn is empty"},
+		{"no host", kt, "HTTP", "not in service/host form"},
+		{"empty host", kt, "HTTP/", "not in service/host form"},
+		{"too many parts", kt, "HTTP/web.ex.com/extra", "not in service/host form"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateKeytabSPN(tc.kt, tc.spn)
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package krb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+)
+
+// CheckDomainRealm проверяет, что каждый host сопоставлен в [domain_realm]
+// (точным именем или суффиксом ".domain") с realm, описанным в [realms].
+// Несопоставленный host gokrb5 молча отнесёт к default_realm — отсюда
+// непонятные ошибки при получении билета, поэтому о нём тоже сообщаем.
+func CheckDomainRealm(c *config.Config, hosts ...string) []error {
+	known := map[string]bool{}
+	for _, r := range c.Realms {
+		known[r.Realm] = true
+	}
+
+	var errs []error
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		host := CanonicalHost(h)
+		realm, ok := mappedRealm(c.DomainRealm, host)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("host %s has no domain_realm mapping (falls back to default_realm %q)", host, c.LibDefaults.DefaultRealm))
+		case !known[realm]:
+			errs = append(errs, fmt.Errorf("host %s maps to realm %s which is not in [realms]", host, realm))
+		}
+	}
+	return errs
+}
+
+// mappedRealm повторяет порядок поиска из krb5: точное имя, затем самый длинный суффикс.
+func mappedRealm(m config.DomainRealm, host string) (string, bool) {
+	if r, ok := m[host]; ok {
+		return r, true
+	}
+	for d := host; ; {
+		i := strings.Index(d, ".")
+		if i < 0 {
+			return "", false
+		}
+		d = d[i+1:]
+		if r, ok := m["."+d]; ok {
+			return r, true
+		}
+		if r, ok := m[d]; ok {
+			return r, true
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package krb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+)
+
+const realmKrb5Conf = `[libdefaults]
+ default_realm = EX.COM
+[realms]
+ EX.COM = {
+  kdc = kdc.ex.com
+ }
+ AD.EX.COM = {
+  kdc = dc.ad.ex.com
+ }
+[domain_realm]
+ .ex.com = EX.COM
+ .ad.ex.com = AD.EX.COM
+ legacy.ex.com = OLD.EX.COM
+`
+
+func TestCheckDomainRealm(t *testing.T) {
+	c, err := config.NewFromString(realmKrb5Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		host string
+		want string // "" — сопоставлен
+	}{
+		{"db.ex.com", ""},
+		{"DB.EX.COM.", ""},
+		{"sql.ad.ex.com", ""},
+		{"ex.com", "no domain_realm mapping"}, // ".ex.com" — только поддомены
+		{"", ""},
+		{"db.other.org", `no domain_realm mapping (falls back to default_realm "EX.COM")`},
+		{"legacy.ex.com", "maps to realm OLD.EX.COM which is not in [realms]"},
+	} {
+		errs := CheckDomainRealm(c, tc.host)
+		switch {
+		case tc.want == "" && len(errs) != 0:
+			t.Errorf("%q: %v", tc.host, errs)
+		case tc.want != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), tc.want)):
+			t.Errorf("%q: errs = %v, want %q", tc.host, errs, tc.want)
+		}
+	}
+	if errs := CheckDomainRealm(c, "db.other.org", "db.ex.com", "ipa.other.org"); len(errs) != 2 {
+		t.Fatalf("errs = %v, want one per unmapped host", errs)
+	}
+}
+
+func TestMappedRealmLongestSuffix(t *testing.T) {
+	m := config.DomainRealm{".ex.com": "EX.COM", ".ad.ex.com": "AD.EX.COM"}
+	if r, ok := mappedRealm(m, "sql.ad.ex.com"); !ok || r != "AD.EX.COM" {
+		t.Fatalf("realm = %q, %v", r, ok)
+	}
+}
@@ -0,0 +1,50 @@
+package krb
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+var canonicalizeDNS atomic.Bool
+
+// SetCanonicalizeDNS включает приведение хоста к FQDN через DNS (как
+// dns_canonicalize_hostname в MIT krb5) для всех SPN, собираемых ServiceSPN.
+func SetCanonicalizeDNS(on bool) {
+	canonicalizeDNS.Store(on)
+}
+
+// ServiceSPN собирает SPN вида service/host с тем же приведением хоста, что и при
+// запросе билета, чтобы в ошибках фигурировало ровно то имя, что ушло в KDC.
+func ServiceSPN(service, host string) string {
+	if canonicalizeDNS.Load() {
+		host = CanonicalHostDNS(host)
+	}
+	return service + "/" + CanonicalHost(host)
+}
+
+func CanonicalHost(h string) string {
+	return strings.TrimSuffix(strings.ToLower(h), ".")
+}
+
+// CanonicalHostDNS разворачивает псевдоним в каноническое имя: сначала CNAME,
+// затем обратная зона по первому адресу. KDC хранят в SPN именно его, так что
+// "pg-vip" превращается в "pg01.example.com". При любой ошибке DNS остаётся
+// исходное имя; IP-адрес не трогаем.
+func CanonicalHostDNS(h string) string {
+	if net.ParseIP(h) != nil {
+		return h
+	}
+	name := h
+	if cname, err := net.LookupCNAME(h); err == nil && cname != "" {
+		name = CanonicalHost(cname)
+	}
+	addrs, err := net.LookupHost(name)
+	if err != nil || len(addrs) == 0 {
+		return name
+	}
+	if ptr, err := net.LookupAddr(addrs[0]); err == nil && len(ptr) > 0 {
+		return CanonicalHost(ptr[0])
+	}
+	return name
+}
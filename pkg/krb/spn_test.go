@@ -0,0 +1,25 @@
+package krb
+
+import "testing"
+
+func TestServiceSPN(t *testing.T) {
+	SetCanonicalizeDNS(false)
+	for host, want := range map[string]string{
+		"db.ex.com":  "postgres/db.ex.com",
+		"DB.Ex.COM":  "postgres/db.ex.com",
+		"db.ex.com.": "postgres/db.ex.com",
+		"10.0.0.1":   "postgres/10.0.0.1",
+	} {
+		if got := ServiceSPN("postgres", host); got != want {
+			t.Errorf("ServiceSPN(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestCanonicalHostDNSKeepsIP(t *testing.T) {
+	for _, ip := range []string{"10.0.0.1", "::1"} {
+		if got := CanonicalHostDNS(ip); got != ip {
+			t.Errorf("CanonicalHostDNS(%q) = %q", ip, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package krb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TicketCache хранит сервисные билеты между запросами, чтобы не ходить в KDC
+// (TGS-REQ) за билетом к тому же SPN для того же принципала.
+type TicketCache interface {
+	Get(principal, spn string) (messages.Ticket, types.EncryptionKey, bool)
+	Put(principal, spn string, tkt messages.Ticket, key types.EncryptionKey, end time.Time)
+}
+
+// NoTicketCache ничего не хранит — каждый билет запрашивается заново.
+type NoTicketCache struct{}
+
+func (NoTicketCache) Get(string, string) (messages.Ticket, types.EncryptionKey, bool) {
+	return messages.Ticket{}, types.EncryptionKey{}, false
+}
+
+func (NoTicketCache) Put(string, string, messages.Ticket, types.EncryptionKey, time.Time) {}
+
+type cachedTicket struct {
+	tkt messages.Ticket
+	key types.EncryptionKey
+	end time.Time
+}
+
+// MemoryTicketCache — кэш в памяти процесса. Билет отдаётся, пока до его
+// конца остаётся больше skew: иначе он может истечь по дороге к серверу.
+type MemoryTicketCache struct {
+	mu      sync.RWMutex
+	skew    time.Duration
+	entries map[string]cachedTicket
+}
+
+func NewMemoryTicketCache(skew time.Duration) *MemoryTicketCache {
+	return &MemoryTicketCache{skew: skew, entries: map[string]cachedTicket{}}
+}
+
+func (c *MemoryTicketCache) Get(principal, spn string) (messages.Ticket, types.EncryptionKey, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[principal+"\x00"+spn]
+	c.mu.RUnlock()
+	if !ok || !time.Now().Add(c.skew).Before(e.end) {
+		return messages.Ticket{}, types.EncryptionKey{}, false
+	}
+	return e.tkt, e.key, true
+}
+
+func (c *MemoryTicketCache) Put(principal, spn string, tkt messages.Ticket, key types.EncryptionKey, end time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// Заодно выбрасываем истёкшие, чтобы кэш не рос на ушедших пользователях
+	for k, e := range c.entries {
+		if !now.Before(e.end) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[principal+"\x00"+spn] = cachedTicket{tkt: tkt, key: key, end: end}
+}
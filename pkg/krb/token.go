@@ -0,0 +1,114 @@
+package krb
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// MaxChannelBindingLen — верхняя граница на application data в channel bindings.
+const MaxChannelBindingLen = 4096
+
+// Прикладные channel bindings, подмешиваемые во все AP_REQ процесса (nil — без привязки).
+var channelBinding atomic.Pointer[[]byte]
+
+// ParseChannelBinding декодирует base64 из конфигурации и проверяет размер.
+func ParseChannelBinding(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("channel binding: %w", err)
+	}
+	if len(b) > MaxChannelBindingLen {
+		return nil, fmt.Errorf("channel binding: %d bytes, max %d", len(b), MaxChannelBindingLen)
+	}
+	return b, nil
+}
+
+// SetChannelBinding задаёт application data для channel bindings в AP_REQ к Postgres и IPA.
+func SetChannelBinding(b []byte) {
+	if len(b) == 0 {
+		channelBinding.Store(nil)
+		return
+	}
+	cp := append([]byte(nil), b...)
+	channelBinding.Store(&cp)
+}
+
+// NewAPREQToken — аналог spnego.NewKRB5TokenAPREQ, который учитывает channel bindings.
+// В gokrb5 поле Bnd контрольной суммы аутентификатора всегда нулевое, поэтому
+// при заданных bindings аутентификатор собираем сами (RFC 4121 4.1.1).
+func NewAPREQToken(cl *client.Client, tkt messages.Ticket, key types.EncryptionKey, flags []int) (spnego.KRB5Token, error) {
+	return NewAPREQTokenAt(cl, tkt, key, flags, 0)
+}
+
+// NewAPREQTokenAt — NewAPREQToken с временем аутентификатора, сдвинутым на
+// skew: повтор после KRB_AP_ERR_SKEW по часам сервера из KRB-ERROR.
+func NewAPREQTokenAt(cl *client.Client, tkt messages.Ticket, key types.EncryptionKey, flags []int, skew time.Duration) (spnego.KRB5Token, error) {
+	tok, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, flags, nil)
+	if err != nil {
+		return tok, err
+	}
+	var appData []byte
+	if cb := channelBinding.Load(); cb != nil {
+		appData = *cb
+	} else if skew == 0 {
+		return tok, nil
+	}
+	auth, err := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	if err != nil {
+		return tok, fmt.Errorf("new authenticator: %w", err)
+	}
+	auth.CTime = auth.CTime.Add(skew)
+	auth.Cksum = types.Checksum{
+		CksumType: chksumtype.GSSAPI,
+		Checksum:  authenticatorChksum(flags, appData),
+	}
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		return tok, fmt.Errorf("new AP_REQ: %w", err)
+	}
+	tok.APReq = apReq
+	return tok, nil
+}
+
+// authenticatorChksum — контрольная сумма GSS: Lgth(4) | Bnd(16) | Flags(4) [| Deleg];
+// appData nil — без channel bindings.
+func authenticatorChksum(flags []int, appData []byte) []byte {
+	a := make([]byte, 24)
+	binary.LittleEndian.PutUint32(a[:4], 16)
+	if appData != nil {
+		// без bindings Bnd нулевой, как у gokrb5
+		copy(a[4:20], channelBindingsHash(appData))
+	}
+	for _, f := range flags {
+		if f == gssapi.ContextFlagDeleg {
+			a = append(a, make([]byte, 28-len(a))...)
+		}
+		v := binary.LittleEndian.Uint32(a[20:24])
+		binary.LittleEndian.PutUint32(a[20:24], v|uint32(f))
+	}
+	return a
+}
+
+// channelBindingsHash — MD5 от gss_channel_bindings_struct без адресов:
+// initiator addrtype/len, acceptor addrtype/len (все нули), затем len+application data.
+func channelBindingsHash(appData []byte) []byte {
+	b := make([]byte, 20, 20+len(appData))
+	binary.LittleEndian.PutUint32(b[16:20], uint32(len(appData)))
+	b = append(b, appData...)
+	h := md5.Sum(b)
+	return h[:]
+}
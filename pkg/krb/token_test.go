@@ -0,0 +1,96 @@
+package krb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// apReqAuthenticator строит AP_REQ alice@EX.COM к HTTP/web.ex.com и
+// возвращает расшифрованный аутентификатор.
+func apReqAuthenticator(t *testing.T, skew time.Duration) types.Authenticator {
+	t.Helper()
+	kt := testKeytab(t, "HTTP/web.ex.com")
+	now := time.Now()
+	tkt, key, err := messages.NewTicket(
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "alice"), "EX.COM",
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/web.ex.com"), "EX.COM",
+		types.NewKrbFlags(), kt, 18, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewWithPassword("alice", "EX.COM", "pw", config.New())
+	tok, err := NewAPREQTokenAt(cl, tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual}, skew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tok.APReq.DecryptAuthenticator(key); err != nil {
+		t.Fatal(err)
+	}
+	return tok.APReq.Authenticator
+}
+
+func TestAPREQChannelBinding(t *testing.T) {
+	defer SetChannelBinding(nil)
+	flags := []byte{byte(gssapi.ContextFlagInteg | gssapi.ContextFlagMutual), 0, 0, 0}
+
+	// Без bindings поле Bnd нулевое, как у gokrb5
+	SetChannelBinding(nil)
+	sum := apReqAuthenticator(t, 0).Cksum.Checksum
+	if !bytes.Equal(sum[4:20], make([]byte, 16)) || !bytes.Equal(sum[20:24], flags) {
+		t.Fatalf("checksum without bindings = %x", sum)
+	}
+
+	// RFC 4121 4.1.1.2: MD5 от адресов (нули) и length-prefixed application data
+	app := []byte("tls-server-end-point:abc")
+	SetChannelBinding(app)
+	st := append(make([]byte, 16), byte(len(app)), 0, 0, 0)
+	want := md5.Sum(append(st, app...))
+	sum = apReqAuthenticator(t, 0).Cksum.Checksum
+	if !bytes.Equal(sum[4:20], want[:]) {
+		t.Fatalf("Bnd = %x, want %x", sum[4:20], want)
+	}
+	if !bytes.Equal(sum[20:24], flags) {
+		t.Fatalf("flags = %x, want %x", sum[20:24], flags)
+	}
+
+	// Заданный буфер копируется: правка вызывающего не меняет bindings
+	app[0] = 'X'
+	if sum = apReqAuthenticator(t, 0).Cksum.Checksum; !bytes.Equal(sum[4:20], want[:]) {
+		t.Fatal("channel binding changed after the caller's buffer was modified")
+	}
+}
+
+func TestAPREQSkew(t *testing.T) {
+	SetChannelBinding(nil)
+	auth := apReqAuthenticator(t, -time.Hour)
+	if d := time.Since(auth.CTime); d < 59*time.Minute || d > 61*time.Minute {
+		t.Fatalf("authenticator time is %v behind, want an hour", d)
+	}
+}
+
+func TestParseChannelBinding(t *testing.T) {
+	if b, err := ParseChannelBinding(""); b != nil || err != nil {
+		t.Fatalf("empty: %x, %v", b, err)
+	}
+	if b, err := ParseChannelBinding(base64.StdEncoding.EncodeToString([]byte("app"))); err != nil || string(b) != "app" {
+		t.Fatalf("app: %q, %v", b, err)
+	}
+	if _, err := ParseChannelBinding("not base64!"); err == nil {
+		t.Fatal("invalid base64 accepted")
+	}
+	big := base64.StdEncoding.EncodeToString(make([]byte, MaxChannelBindingLen+1))
+	if _, err := ParseChannelBinding(big); err == nil || !strings.Contains(err.Error(), "max 4096") {
+		t.Fatalf("oversized: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package pgx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Привязка к бэкенду: в рамках одной логической операции (обычно HTTP-запроса)
+// все вызовы QueryAsUser/ExecAsUser/... под тем же DSN и ccache идут через одно
+// соединение — тот же сервер multi-host DSN и тот же PID бэкенда, так что
+// чтение видит только что сделанную запись.
+type affinity struct {
+	mu     sync.Mutex
+	key    string
+	conn   *pgx.Conn
+	busy   bool // соединение занято вызовом (до его release)
+	closed bool
+}
+
+type affinityKey struct{}
+
+// WithAffinity включает привязку для ctx. release закрывает удержанное
+// соединение и должен быть вызван по окончании операции.
+func WithAffinity(ctx context.Context) (context.Context, func()) {
+	a := &affinity{}
+	release := func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.closed = true
+		// Занятое соединение закроет unpin вызова, который его держит
+		if !a.busy && a.conn != nil {
+			closeConn(context.Background(), a.conn)
+			a.conn = nil
+		}
+	}
+	return context.WithValue(ctx, affinityKey{}, a), release
+}
+
+// acquireConn — соединение для одного вызова и функция его освобождения.
+// Без привязки в ctx (или для другого DSN/ccache) — см. connectUnpinned; с
+// привязкой — удержанное, занятое на время вызова. Пока оно занято
+// (вложенный вызов с тем же ctx внутри WithTxAsUser или QueryAsUserStream,
+// параллельная горутина), остальные вызовы получают отдельное соединение, а
+// не ждут его.
+func acquireConn(ctx context.Context, dsn, ccachePath, krb5Conf string) (*pgx.Conn, func(), error) {
+	a, _ := ctx.Value(affinityKey{}).(*affinity)
+	key := dsn + spnRouteSep + ccachePath + spnRouteSep + krb5Conf
+	if a != nil {
+		a.mu.Lock()
+		free := !a.closed && !a.busy && (a.key == "" || a.key == key)
+		a.busy = a.busy || free
+		a.mu.Unlock()
+		if !free {
+			a = nil
+		}
+	}
+	if a == nil {
+		return connectUnpinned(ctx, dsn, ccachePath, krb5Conf)
+	}
+
+	// busy: до unpin соединение принадлежит только этому вызову
+	if a.conn != nil && a.conn.IsClosed() {
+		untrackConn(a.conn.PgConn())
+		a.conn = nil
+	}
+	if a.conn == nil {
+		conn, err := connectAsUser(ctx, dsn, ccachePath, krb5Conf)
+		if err != nil {
+			a.unpin()
+			return nil, nil, err
+		}
+		a.mu.Lock()
+		a.conn, a.key = conn, key
+		a.mu.Unlock()
+	}
+	return a.conn, a.unpin, nil
+}
+
+// unpin освобождает удержанное соединение; после release оно закрывается.
+func (a *affinity) unpin() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.busy = false
+	if a.closed && a.conn != nil {
+		closeConn(context.Background(), a.conn)
+		a.conn = nil
+	}
+}
@@ -0,0 +1,84 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// withTimeout проваливает тест, если fn не вернулась (взаимная блокировка).
+func withTimeout(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock: call did not return")
+	}
+}
+
+func TestAffinityReusesConnection(t *testing.T) {
+	srv := useFakePG(t)
+	ctx, release := WithAffinity(context.Background())
+	defer release()
+
+	for _, sql := range []string{"insert one", "select one"} {
+		if _, err := ExecAsUser(ctx, fakeDSN, "/tmp/krb5cc_alice", "", sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.connCount(); n != 1 {
+		t.Fatalf("%d connections, want 1", n)
+	}
+}
+
+func TestAffinityNestedCallInTx(t *testing.T) {
+	srv := useFakePG(t)
+	ctx, release := WithAffinity(context.Background())
+	defer release()
+
+	withTimeout(t, func() {
+		err := WithTxAsUser(ctx, fakeDSN, "/tmp/krb5cc_alice", "", func(tx pgx.Tx) error {
+			_, err := ExecAsUser(ctx, fakeDSN, "/tmp/krb5cc_alice", "", "update nested")
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	// Вложенный вызов — на отдельном соединении, транзакция — на удержанном
+	if tx, nested := srv.connOf("begin"), srv.connOf("update nested"); tx == 0 || nested == 0 || tx == nested {
+		t.Fatalf("tx on conn %d, nested call on conn %d", tx, nested)
+	}
+	// После выхода из транзакции удержанное соединение снова доступно
+	if _, err := ExecAsUser(ctx, fakeDSN, "/tmp/krb5cc_alice", "", "select after"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := srv.connOf("select after"), srv.connOf("begin"); got != want {
+		t.Fatalf("call after tx on conn %d, want pinned conn %d", got, want)
+	}
+}
+
+func TestAffinityReleaseWhileBusy(t *testing.T) {
+	useFakePG(t)
+	ctx, release := WithAffinity(context.Background())
+
+	conn, unpin, err := acquireConn(ctx, fakeDSN, "/tmp/krb5cc_alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTimeout(t, release)
+	if conn.IsClosed() {
+		t.Fatal("release closed a connection still in use")
+	}
+	unpin()
+	if !conn.IsClosed() {
+		t.Fatal("connection left open after release and unpin")
+	}
+}
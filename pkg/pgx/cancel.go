@@ -0,0 +1,57 @@
+package pgx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Открытые соединения под пользователями — чтобы при остановке можно было
+// отменить их запросы на сервере, а не бросать бэкенды работать вхолостую.
+var active = struct {
+	sync.Mutex
+	conns map[*pgconn.PgConn]struct{}
+}{conns: map[*pgconn.PgConn]struct{}{}}
+
+func trackConn(c *pgconn.PgConn) {
+	active.Lock()
+	active.conns[c] = struct{}{}
+	active.Unlock()
+}
+
+func untrackConn(c *pgconn.PgConn) {
+	active.Lock()
+	delete(active.conns, c)
+	active.Unlock()
+}
+
+// closeConn закрывает одиночное соединение из connectAsUser.
+func closeConn(ctx context.Context, conn *pgx.Conn) {
+	untrackConn(conn.PgConn())
+	conn.Close(ctx)
+}
+
+// CancelActiveQueries шлёт CancelRequest для всех открытых соединений и
+// возвращает их число. Вызывается при остановке, когда истёк срок ожидания
+// текущих запросов: бэкенды прерывают запросы, хэндлеры получают ошибку 57014.
+func CancelActiveQueries(ctx context.Context) int {
+	active.Lock()
+	conns := make([]*pgconn.PgConn, 0, len(active.conns))
+	for c := range active.conns {
+		conns = append(conns, c)
+	}
+	active.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *pgconn.PgConn) {
+			defer wg.Done()
+			c.CancelRequest(ctx)
+		}(c)
+	}
+	wg.Wait()
+	return len(conns)
+}
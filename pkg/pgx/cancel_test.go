@@ -0,0 +1,44 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestCancelActiveQueries(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	srv := useFakePG(t)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "SLEEP")
+		done <- err
+	}()
+	for i := 0; i < 500 && srv.sleeping() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.sleeping() != 1 {
+		t.Fatal("query did not start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if n := CancelActiveQueries(ctx); n < 1 {
+		t.Fatalf("cancelled %d connections", n)
+	}
+	// Запрос прерван на сервере, хэндлер получает 57014
+	select {
+	case err := <-done:
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "57014" {
+			t.Fatalf("err = %v, want 57014", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query still running after cancel")
+	}
+}
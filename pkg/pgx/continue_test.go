@@ -0,0 +1,162 @@
+package pgx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// startExchange — провайдер alice и её первый AP_REQ к testSPN.
+func startExchange(t *testing.T) (*keytab.Keytab, *gssFromCCache, []byte) {
+	t.Helper()
+	kt := testKeytab(t)
+	g, err := NewGSSFromCCache(writeUserCCache(t, kt, "alice"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := g.GetInitTokenFromSPN(testSPN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kt, g.(*gssFromCCache), tok
+}
+
+// krbErrorToken — KRB-ERROR сервера с его временем stime: в GSS-обёртке
+// (tokID 03 00) или голый, как его шлют некоторые акцепторы.
+func krbErrorToken(t *testing.T, code int32, stime time.Time, wrapped bool) []byte {
+	t.Helper()
+	e := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, testSPN), testRealm, code, "")
+	e.STime, e.Susec = stime.UTC().Truncate(time.Second), stime.Nanosecond()/1000
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrapped {
+		return gssToken([]byte{0x03, 0x00}, b)
+	}
+	return b
+}
+
+// marshalNegTokenResp заворачивает токен механизма в ответ SPNEGO.
+func marshalNegTokenResp(t *testing.T, resp spnego.NegTokenResp) []byte {
+	t.Helper()
+	resp.SupportedMech = gssapi.OIDKRB5.OID()
+	b, err := resp.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestContinueVerifiesAPRep(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	_, key, auth := acceptAPReq(t, kt, tok)
+	done, next, err := g.Continue(apRepToken(t, key, auth))
+	if err != nil || !done || next != nil {
+		t.Fatalf("Continue(AP_REP) = %v, %x, %v; want done", done, next, err)
+	}
+	// Контекст установлен: следующий токен сервера — ошибка
+	if _, _, err := g.Continue(apRepToken(t, key, auth)); err == nil {
+		t.Fatal("token after the context was established accepted")
+	}
+}
+
+func TestContinueRejectsForgedAPRep(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	_, key, auth := acceptAPReq(t, kt, tok)
+	// AP_REP не на наш аутентификатор — подставной сервер
+	auth.CTime = auth.CTime.Add(-time.Minute)
+	if _, _, err := g.Continue(apRepToken(t, key, auth)); err == nil || !strings.Contains(err.Error(), "mutual authentication failed") {
+		t.Fatalf("forged AP_REP: err = %v", err)
+	}
+}
+
+func TestContinueRetriesOnSkew(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		wrapped bool
+	}{
+		{"gss token", true},
+		{"bare KRB-ERROR", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kt, g, tok := startExchange(t)
+			acceptAPReq(t, kt, tok)
+
+			// Часы сервера на 10 минут впереди
+			server := time.Now().Add(10 * time.Minute)
+			done, next, err := g.Continue(krbErrorToken(t, errorcode.KRB_AP_ERR_SKEW, server, tc.wrapped))
+			if err != nil || done || next == nil {
+				t.Fatalf("Continue(SKEW) = %v, %x, %v; want next AP_REQ", done, next, err)
+			}
+			_, key, auth := acceptAPReq(t, kt, next)
+			if d := auth.CTime.Sub(server); d < -5*time.Second || d > 5*time.Second {
+				t.Fatalf("retry authenticator time %v is %v off the server clock", auth.CTime, d)
+			}
+
+			done, _, err = g.Continue(apRepToken(t, key, auth))
+			if err != nil || !done {
+				t.Fatalf("Continue(AP_REP) after retry = %v, %v", done, err)
+			}
+		})
+	}
+}
+
+func TestContinueReportsOtherKRBErrors(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	acceptAPReq(t, kt, tok)
+	_, _, err := g.Continue(krbErrorToken(t, errorcode.KRB_AP_ERR_MODIFIED, time.Now(), true))
+	var se *KRBServerError
+	if !errors.As(err, &se) || se.Code != errorcode.KRB_AP_ERR_MODIFIED || se.SPN != testSPN {
+		t.Fatalf("err = %v, want KRBServerError KRB_AP_ERR_MODIFIED for %s", err, testSPN)
+	}
+}
+
+func TestContinueCapsLegs(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	acceptAPReq(t, kt, tok)
+	skew := krbErrorToken(t, errorcode.KRB_AP_ERR_SKEW, time.Now().Add(10*time.Minute), true)
+
+	// Акцептор, который всё время отвечает SKEW, получает новый AP_REQ до
+	// maxGSSLegs-го шага, а на нём — ошибку
+	for leg := 1; leg < maxGSSLegs; leg++ {
+		if _, next, err := g.Continue(skew); err != nil || next == nil {
+			t.Fatalf("leg %d: next = %x, err = %v", leg, next, err)
+		}
+	}
+	_, next, err := g.Continue(skew)
+	var se *KRBServerError
+	if !errors.As(err, &se) || se.Code != errorcode.KRB_AP_ERR_SKEW || next != nil {
+		t.Fatalf("leg %d: next = %x, err = %v; want KRB_AP_ERR_SKEW", maxGSSLegs, next, err)
+	}
+	if _, _, err := g.Continue(skew); err == nil || !strings.Contains(err.Error(), "legs") {
+		t.Fatalf("leg past the cap: err = %v", err)
+	}
+}
+
+func TestContinueUnwrapsNegTokenResp(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	_, key, auth := acceptAPReq(t, kt, tok)
+	resp := marshalNegTokenResp(t, spnego.NegTokenResp{
+		NegState:      0, // accept-completed
+		ResponseToken: apRepToken(t, key, auth),
+	})
+	if done, _, err := g.Continue(resp); err != nil || !done {
+		t.Fatalf("Continue(NegTokenResp) = %v, %v", done, err)
+	}
+
+	_, g, _ = startExchange(t)
+	reject := marshalNegTokenResp(t, spnego.NegTokenResp{NegState: 2}) // reject
+	if _, _, err := g.Continue(reject); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("Continue(reject) err = %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package pgx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultKrbSrvName — имя сервиса в SPN Postgres, если в DSN нет krbsrvname.
+const DefaultKrbSrvName = "postgres"
+
+// DSNOptions — параметры строки подключения keyword=value. Пустые строки и
+// нулевые числа в DSN не попадают (действует значение libpq по умолчанию).
+type DSNOptions struct {
+	Host           string
+	Port           int
+	User           string
+	DBName         string
+	SSLMode        string
+	KrbSrvName     string
+	ConnectTimeout int // секунды
+}
+
+// BuildDSN собирает DSN в формате keyword=value, экранируя значения по
+// правилам libpq: пустые значения и значения с пробелами берутся в одинарные
+// кавычки, ' и \ экранируются обратной косой чертой.
+func BuildDSN(opts DSNOptions) string {
+	var b strings.Builder
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(quoteDSNValue(value))
+	}
+	add("host", opts.Host)
+	if opts.Port > 0 {
+		add("port", strconv.Itoa(opts.Port))
+	}
+	add("user", opts.User)
+	add("dbname", opts.DBName)
+	add("sslmode", opts.SSLMode)
+	add("krbsrvname", opts.KrbSrvName)
+	if opts.ConnectTimeout > 0 {
+		add("connect_timeout", strconv.Itoa(opts.ConnectTimeout))
+	}
+	return b.String()
+}
+
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\r\v\f'\\=") {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range v {
+		if r == '\'' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package pgx
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestBuildDSN(t *testing.T) {
+	got := BuildDSN(DSNOptions{Host: "db.ex.com", Port: 5433, User: "alice", DBName: "app", SSLMode: "require", KrbSrvName: DefaultKrbSrvName, ConnectTimeout: 5})
+	if want := "host=db.ex.com port=5433 user=alice dbname=app sslmode=require krbsrvname=postgres connect_timeout=5"; got != want {
+		t.Fatalf("BuildDSN = %q, want %q", got, want)
+	}
+	// Пустые и нулевые параметры не попадают в DSN
+	if got := BuildDSN(DSNOptions{Host: "db.ex.com"}); got != "host=db.ex.com" {
+		t.Fatalf("BuildDSN = %q", got)
+	}
+}
+
+// Любое имя пользователя доходит до pgconn как есть и не добавляет параметров
+func TestBuildDSNQuoting(t *testing.T) {
+	for _, user := range []string{
+		"alice",
+		"john smith",
+		"o'brien",
+		`back\slash`,
+		"x dbname=postgres",
+		"a=b",
+		"'",
+		"tab\tuser",
+	} {
+		dsn := BuildDSN(DSNOptions{Host: "db.ex.com", User: user, DBName: "app", SSLMode: "disable"})
+		cfg, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			t.Errorf("%q: ParseConfig(%s): %v", user, dsn, err)
+			continue
+		}
+		if cfg.User != user || cfg.Database != "app" {
+			t.Errorf("%q: DSN %s parsed as user %q, dbname %q", user, dsn, cfg.User, cfg.Database)
+		}
+	}
+}
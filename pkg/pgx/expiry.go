@@ -0,0 +1,63 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+// ErrCredentialsExpired — TGT в делегированном ccache уже истёк; поможет только
+// повторный вход пользователя, поэтому хэндлерам стоит отвечать 401, а не 500.
+var ErrCredentialsExpired = errors.New("delegated credentials expired")
+
+// CCacheValid загружает ccache и возвращает конец срока его TGT. Если срок
+// уже прошёл — ошибка оборачивает ErrCredentialsExpired и содержит время истечения.
+func CCacheValid(ccachePath string) (time.Time, error) {
+	end, err := ccacheExpiry(context.Background(), ccachePath)
+	if err != nil {
+		return end, err
+	}
+	return end, checkNotExpired(end)
+}
+
+// CCacheExpiry — CCacheValid для уже загруженного ccache.
+func CCacheExpiry(cc *credentials.CCache) (time.Time, error) {
+	end, err := tgtEndTime(cc)
+	if err != nil {
+		return end, err
+	}
+	return end, checkNotExpired(end)
+}
+
+func checkNotExpired(end time.Time) error {
+	if !time.Now().Before(end) {
+		return fmt.Errorf("%w at %s", ErrCredentialsExpired, end.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// tgtEndTime — конец срока TGT (без TGT — самого раннего билета в ccache).
+func tgtEndTime(cc *credentials.CCache) (time.Time, error) {
+	var tgt, earliest time.Time
+	for _, c := range cc.GetEntries() {
+		if len(c.Server.PrincipalName.NameString) > 0 && c.Server.PrincipalName.NameString[0] == "krbtgt" {
+			if tgt.IsZero() || c.EndTime.Before(tgt) {
+				tgt = c.EndTime
+			}
+		}
+		if earliest.IsZero() || c.EndTime.Before(earliest) {
+			earliest = c.EndTime
+		}
+	}
+	switch {
+	case !tgt.IsZero():
+		return tgt, nil
+	case !earliest.IsZero():
+		return earliest, nil
+	default:
+		return time.Time{}, errors.New("ccache has no credentials")
+	}
+}
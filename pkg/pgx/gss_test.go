@@ -0,0 +1,141 @@
+package pgx
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// Стенд без KDC: билеты выписываются ключами из keytab стенда и кладутся в
+// ccache, а «сервер» расшифровывает AP_REQ тем же keytab и отвечает AP_REP.
+const (
+	testRealm = "EX.COM"
+	testSPN   = "postgres/db.ex.com"
+)
+
+func testKeytab(t *testing.T) *keytab.Keytab {
+	t.Helper()
+	kt := keytab.New()
+	for _, p := range []string{testSPN, "krbtgt/" + testRealm} {
+		if err := kt.AddEntry(p, testRealm, "svcpw", time.Now(), 1, 18); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kt
+}
+
+// writeUserCCache пишет ccache user@EX.COM с TGT и билетом на testSPN.
+func writeUserCCache(t *testing.T, kt *keytab.Keytab, user string) string {
+	t.Helper()
+	now := time.Now().Truncate(time.Second)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user)
+	cred := &messages.KRBCred{}
+	for _, spn := range []string{"krbtgt/" + testRealm, testSPN} {
+		sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+		tkt, key, err := messages.NewTicket(cname, testRealm, sname, testRealm, types.NewKrbFlags(), kt, 18, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cred.Tickets = append(cred.Tickets, tkt)
+		cred.DecryptedEncPart.TicketInfo = append(cred.DecryptedEncPart.TicketInfo, messages.KrbCredInfo{
+			Key: key, PRealm: testRealm, PName: cname,
+			AuthTime: now, StartTime: now, EndTime: now.Add(time.Hour),
+			SRealm: testRealm, SName: sname,
+		})
+	}
+	path := filepath.Join(t.TempDir(), "krb5cc_"+user)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := krb.WriteCCache(f, cred); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// acceptAPReq — сторона сервера: расшифровывает AP_REQ и возвращает имя
+// клиента, сессионный ключ и аутентификатор.
+func acceptAPReq(t *testing.T, kt *keytab.Keytab, token []byte) (string, types.EncryptionKey, types.Authenticator) {
+	t.Helper()
+	cname, key, auth, err := acceptToken(kt, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cname, key, auth
+}
+
+func acceptToken(kt *keytab.Keytab, token []byte) (string, types.EncryptionKey, types.Authenticator, error) {
+	var tok spnego.KRB5Token
+	if err := tok.Unmarshal(token); err != nil {
+		return "", types.EncryptionKey{}, types.Authenticator{}, fmt.Errorf("unmarshal AP_REQ: %w", err)
+	}
+	if !tok.IsAPReq() {
+		return "", types.EncryptionKey{}, types.Authenticator{}, errors.New("init token is not an AP_REQ")
+	}
+	req := tok.APReq
+	if err := req.Ticket.DecryptEncPart(kt, nil); err != nil {
+		return "", types.EncryptionKey{}, types.Authenticator{}, fmt.Errorf("decrypt ticket: %w", err)
+	}
+	key := req.Ticket.DecryptedEncPart.Key
+	if err := req.DecryptAuthenticator(key); err != nil {
+		return "", types.EncryptionKey{}, types.Authenticator{}, fmt.Errorf("decrypt authenticator: %w", err)
+	}
+	return req.Ticket.DecryptedEncPart.CName.PrincipalNameString(), key, req.Authenticator, nil
+}
+
+// gssToken оборачивает сообщение Kerberos в GSS-токен (RFC 1964) с tokID.
+func gssToken(tokID []byte, msg []byte) []byte {
+	oid, _ := asn1.Marshal(asn1.ObjectIdentifier(gssapi.OIDKRB5.OID()))
+	b := append(append(oid, tokID...), msg...)
+	return asn1tools.AddASNAppTag(b, 0)
+}
+
+// apRepToken — ответ сервера на аутентификатор auth.
+func apRepToken(t *testing.T, key types.EncryptionKey, auth types.Authenticator) []byte {
+	t.Helper()
+	b, err := apRep(key, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func apRep(key types.EncryptionKey, auth types.Authenticator) ([]byte, error) {
+	part := struct {
+		CTime time.Time `asn1:"generalized,explicit,tag:0"`
+		Cusec int       `asn1:"explicit,tag:1"`
+	}{auth.CTime.UTC(), auth.Cusec}
+	plain, err := asn1.Marshal(part)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(plain, asnAppTag.EncAPRepPart), key, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := asn1.Marshal(messages.APRep{PVNO: 5, MsgType: msgtype.KRB_AP_REP, EncPart: enc})
+	if err != nil {
+		return nil, err
+	}
+	return gssToken([]byte{0x02, 0x00}, asn1tools.AddASNAppTag(rep, asnAppTag.APREP)), nil
+}
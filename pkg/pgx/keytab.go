@@ -0,0 +1,229 @@
+package pgx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// Повтор неудавшегося фонового логина — не ждать следующего планового срока.
+const keytabRenewRetry = time.Minute
+
+// Сколько живёт клиент после подмены: обмены, начатые на нём, ещё строят
+// AP_REQ (повтор на KRB_AP_ERR_SKEW), поэтому Destroy откладывается.
+const keytabRetireGrace = time.Minute
+
+// KeytabGSS — источник GSS-обменов сервисного принципала из keytab. TGT заново
+// получается в фоне раньше, чем истечёт; общий у соединений только клиент,
+// состояние обмена у каждого соединения своё (NewGSS). Соединение получает
+// провайдер через Route; Close останавливает обновление.
+type KeytabGSS struct {
+	mu    sync.Mutex
+	cl    *client.Client
+	proto gssFromCCache // флаги и canonicalizeDNS для новых обменов
+	login func() (*client.Client, error)
+	id    uint64
+
+	every     time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Провайдеры из NewKeytabGSS по id — routedGSS находит их по маршруту в KerberosSpn.
+var (
+	keytabRoutes sync.Map // uint64 -> *KeytabGSS
+	keytabSeq    atomic.Uint64
+)
+
+// NewGSSFromKeytab — провайдер для фоновых задач, которые ходят в Postgres
+// фиксированным сервисным принципалом ("svc/host@REALM" или "user"; без realm
+// берётся default_realm). Логинится сразу, дальше ведёт себя как
+// NewGSSFromCCache: один обмен, провайдер на каждое соединение. Пулу, которому
+// нужен общий TGT с фоновым обновлением, — NewKeytabGSS.
+// opts — настройки клиента gokrb5; остальное задаёт NewGSSFromKeytabWith.
+func NewGSSFromKeytab(keytabPath, principal, krb5ConfPath string, opts ...func(*client.Settings)) (pgconn.GSS, error) {
+	return NewGSSFromKeytabWith(keytabPath, principal, krb5ConfPath, WithClientSettings(opts...))
+}
+
+// NewGSSFromKeytabWith — NewGSSFromKeytab с опциями GSSOption.
+func NewGSSFromKeytabWith(keytabPath, principal, krb5ConfPath string, opts ...GSSOption) (pgconn.GSS, error) {
+	o := newGSSOptions(opts)
+	login, _, err := keytabLogin(keytabPath, principal, krb5ConfPath, o)
+	if err != nil {
+		return nil, err
+	}
+	cl, err := login()
+	if err != nil {
+		return nil, err
+	}
+	return &gssFromCCache{cl: cl, flags: o.flags, canonicalizeDNS: o.canonicalizeDNS}, nil
+}
+
+// NewKeytabGSS — общий для всех соединений источник обменов сервисного
+// принципала: логинится сразу и обновляет TGT в фоне. pgconn.GSS хранит
+// состояние одного обмена (ключ и аутентификатор AP_REQ для проверки AP_REP),
+// поэтому сам KeytabGSS не pgconn.GSS: соединение получает свой обмен через
+// Route (или NewGSS). Закрывается Close.
+func NewKeytabGSS(keytabPath, principal, krb5ConfPath string, opts ...GSSOption) (*KeytabGSS, error) {
+	o := newGSSOptions(opts)
+	login, cfg, err := keytabLogin(keytabPath, principal, krb5ConfPath, o)
+	if err != nil {
+		return nil, err
+	}
+	every := o.renewInterval
+	if every <= 0 {
+		every = cfg.LibDefaults.TicketLifetime * 3 / 4
+	}
+	if every <= 0 {
+		every = time.Hour
+	}
+	return newKeytabGSS(login, every, gssFromCCache{flags: o.flags, canonicalizeDNS: o.canonicalizeDNS})
+}
+
+// keytabLogin — логин principal по keytab: каждый вызов возвращает новый клиент с TGT.
+func keytabLogin(keytabPath, principal, krb5ConfPath string, o gssOptions) (func() (*client.Client, error), *config.Config, error) {
+	kt, err := keytab.Load(keytabPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load keytab: %w", err)
+	}
+	cfg, err := loadKrb5Conf(krb5ConfPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, realm, found := strings.Cut(principal, "@")
+	if !found {
+		realm = cfg.LibDefaults.DefaultRealm
+	}
+	return func() (*client.Client, error) {
+		cl := client.NewWithKeytab(name, realm, kt, cfg, o.settings...)
+		if err := cl.Login(); err != nil {
+			return nil, fmt.Errorf("login as %s@%s: %w", name, realm, err)
+		}
+		return cl, nil
+	}, cfg, nil
+}
+
+func newKeytabGSS(login func() (*client.Client, error), every time.Duration, proto gssFromCCache) (*KeytabGSS, error) {
+	cl, err := login()
+	if err != nil {
+		return nil, err
+	}
+	k := &KeytabGSS{
+		cl:    cl,
+		proto: proto,
+		login: login,
+		id:    keytabSeq.Add(1),
+		every: every,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	keytabRoutes.Store(k.id, k)
+	go k.renewLoop()
+	return k, nil
+}
+
+func (k *KeytabGSS) renewLoop() {
+	defer close(k.done)
+	t := time.NewTimer(k.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-t.C:
+			next := k.every
+			if err := k.renew(); err != nil {
+				next = min(keytabRenewRetry, k.every)
+			}
+			t.Reset(next)
+		}
+	}
+}
+
+// renew логинится новым клиентом вне блокировки и подменяет старый.
+func (k *KeytabGSS) renew() error {
+	cl, err := k.login()
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	old := k.cl
+	k.cl = cl
+	k.mu.Unlock()
+	time.AfterFunc(keytabRetireGrace, old.Destroy)
+	return nil
+}
+
+func (k *KeytabGSS) client() *client.Client {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.cl
+}
+
+// Close останавливает фоновое обновление TGT и снимает маршрут. Повторный
+// вызов безопасен.
+func (k *KeytabGSS) Close() error {
+	k.closeOnce.Do(func() {
+		keytabRoutes.Delete(k.id)
+		close(k.stop)
+		<-k.done
+	})
+	return nil
+}
+
+// NewGSS — новый обмен на текущем клиенте. По сигнатуре это фабрика
+// pgconn.RegisterGSSProvider, но глобальную фабрику занимает routedGSS —
+// соединения получают провайдер через Route.
+func (k *KeytabGSS) NewGSS() (pgconn.GSS, error) {
+	g := &keytabExchange{k: k, gssFromCCache: k.proto}
+	g.cl = k.client()
+	return g, nil
+}
+
+// Route прописывает в cfg, что соединение проходит GSS под этим провайдером.
+func (k *KeytabGSS) Route(cfg *pgconn.Config) {
+	registerRoutedGSS()
+	cfg.KerberosSpn = spnRoute{spn: connSPN(cfg), keytab: k.id}.String()
+}
+
+// keytabByID — открытый провайдер из маршрута соединения.
+func keytabByID(id uint64) (*KeytabGSS, error) {
+	k, ok := keytabRoutes.Load(id)
+	if !ok {
+		return nil, errors.New("kerberos: keytab provider is closed")
+	}
+	return k.(*KeytabGSS), nil
+}
+
+// keytabExchange — один обмен GSS соединения. При отказе KDC (например, TGT
+// истёк раньше планового обновления — KDC выдал билет короче ticket_lifetime)
+// обновляет TGT провайдера и повторяет один раз.
+type keytabExchange struct {
+	k *KeytabGSS
+	gssFromCCache
+}
+
+func (g *keytabExchange) GetInitToken(host, service string) ([]byte, error) {
+	return g.GetInitTokenFromSPN(g.spnFor(host, service))
+}
+
+func (g *keytabExchange) GetInitTokenFromSPN(spn string) ([]byte, error) {
+	b, err := g.gssFromCCache.GetInitTokenFromSPN(spn)
+	if err == nil {
+		return b, nil
+	}
+	if rerr := g.k.renew(); rerr != nil {
+		return nil, fmt.Errorf("%w (renew: %v)", err, rerr)
+	}
+	g.cl = g.k.client()
+	return g.gssFromCCache.GetInitTokenFromSPN(spn)
+}
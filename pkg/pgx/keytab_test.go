@@ -0,0 +1,117 @@
+package pgx
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Сигнатуры конструкторов до GSSOption — часть API пакета.
+var (
+	_ func(string, string, ...func(*client.Settings)) (pgconn.GSS, error)         = NewGSSFromCCache
+	_ func(string, string, string, ...func(*client.Settings)) (pgconn.GSS, error) = NewGSSFromKeytab
+)
+
+func testKeytabGSS(t *testing.T, login func() (*client.Client, error)) *KeytabGSS {
+	t.Helper()
+	k, err := newKeytabGSS(login, time.Hour, gssFromCCache{flags: defaultContextFlags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { k.Close() })
+	return k
+}
+
+func TestKeytabGSSConcurrentConnects(t *testing.T) {
+	kt := testKeytab(t)
+	path := writeUserCCache(t, kt, "svc")
+	k := testKeytabGSS(t, func() (*client.Client, error) { return clientFromCCache(path, "", false) })
+
+	// Обмены перемежаются: все соединения сначала шлют AP_REQ, потом получают
+	// AP_REP — общий на провайдер обмен проверил бы AP_REP чужим ключом
+	const conns = 8
+	var ready, start sync.WaitGroup
+	ready.Add(conns)
+	start.Add(1)
+	errs := make(chan error, conns)
+	for range conns {
+		go func() {
+			g, _ := k.NewGSS()
+			tok, err := g.GetInitTokenFromSPN(testSPN)
+			ready.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+			start.Wait()
+			_, key, auth := acceptAPReq(t, kt, tok)
+			done, _, err := g.Continue(apRepToken(t, key, auth))
+			if err == nil && !done {
+				t.Error("context not established after AP_REP")
+			}
+			errs <- err
+		}()
+	}
+	ready.Wait()
+	start.Done()
+	for range conns {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestKeytabGSSRoute(t *testing.T) {
+	kt := testKeytab(t)
+	path := writeUserCCache(t, kt, "svc")
+	k := testKeytabGSS(t, func() (*client.Client, error) { return clientFromCCache(path, "", false) })
+
+	cfg := &pgconn.Config{Host: "db.ex.com"}
+	k.Route(cfg)
+	g := &routedGSS{}
+	tok, err := g.GetInitTokenFromSPN(cfg.KerberosSpn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cname, _, _ := acceptAPReq(t, kt, tok); cname != "svc" {
+		t.Fatalf("client %q, want svc", cname)
+	}
+
+	k.Close()
+	if _, err := (&routedGSS{}).GetInitTokenFromSPN(cfg.KerberosSpn); err == nil {
+		t.Fatal("route to a closed provider accepted")
+	}
+}
+
+func TestKeytabGSSRenewKeepsExchange(t *testing.T) {
+	kt := testKeytab(t)
+	path := writeUserCCache(t, kt, "svc")
+	k := testKeytabGSS(t, func() (*client.Client, error) { return clientFromCCache(path, "", false) })
+
+	g, _ := k.NewGSS()
+	tok, err := g.GetInitTokenFromSPN(testSPN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Подмена клиента посреди обмена не ломает начатый обмен
+	if err := k.renew(); err != nil {
+		t.Fatal(err)
+	}
+	_, key, auth := acceptAPReq(t, kt, tok)
+	if done, _, err := g.Continue(apRepToken(t, key, auth)); err != nil || !done {
+		t.Fatalf("Continue after renew: done=%v err=%v", done, err)
+	}
+}
+
+func TestNewGSSFromKeytabErrors(t *testing.T) {
+	if _, err := NewGSSFromKeytab(filepath.Join(t.TempDir(), "missing.keytab"), "svc", ""); err == nil {
+		t.Fatal("missing keytab accepted")
+	}
+	if _, err := NewKeytabGSS(filepath.Join(t.TempDir(), "missing.keytab"), "svc", ""); err == nil {
+		t.Fatal("missing keytab accepted")
+	}
+}
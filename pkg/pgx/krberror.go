@@ -0,0 +1,53 @@
+package pgx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// KRBServerError — Postgres (акцептор GSS) отверг AP_REQ и прислал KRB-ERROR.
+// Code и Name — код Kerberos (KRB_AP_ERR_MODIFIED, KDC_ERR_S_PRINCIPAL_UNKNOWN…),
+// Text — e-text сервера, если он есть. errors.As на messages.KRBError тоже работает.
+type KRBServerError struct {
+	Code int32
+	Name string
+	Text string
+	SPN  string
+	krb  messages.KRBError
+}
+
+func newKRBServerError(k messages.KRBError, spn string) *KRBServerError {
+	// Lookup отдаёт "(41) KRB_AP_ERR_MODIFIED Message stream modified"
+	name := fmt.Sprintf("UNKNOWN_%d", k.ErrorCode)
+	if f := strings.Fields(errorcode.Lookup(k.ErrorCode)); len(f) > 1 && strings.HasPrefix(f[0], "(") {
+		name = f[1]
+	}
+	return &KRBServerError{Code: k.ErrorCode, Name: name, Text: k.EText, SPN: spn, krb: k}
+}
+
+func (e *KRBServerError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "kerberos: server rejected AP_REQ for %s: %s (code %d)", e.SPN, e.Name, e.Code)
+	if e.Text != "" {
+		b.WriteString(": " + e.Text)
+	}
+	if hint := krbErrorHints[e.Code]; hint != "" {
+		b.WriteString("; " + hint)
+	}
+	return b.String()
+}
+
+func (e *KRBServerError) Unwrap() error { return e.krb }
+
+// Подсказки к частым отказам акцептора — что проверить на стороне Postgres
+var krbErrorHints = map[int32]string{
+	errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN: "check krbsrvname and that the server keytab has this SPN",
+	errorcode.KRB_AP_ERR_MODIFIED:         "server keytab key does not match the KDC (kvno/SPN mismatch)",
+	errorcode.KRB_AP_ERR_BADKEYVER:        "server keytab is missing the current kvno",
+	errorcode.KRB_AP_ERR_NOKEY:            "server keytab has no key of the ticket's enctype",
+	errorcode.KRB_AP_ERR_SKEW:             "clock skew between this host and the server is too large",
+	errorcode.KRB_AP_ERR_NOT_US:           "ticket was issued for a different service principal",
+}
@@ -0,0 +1,55 @@
+package pgx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func TestKRBServerError(t *testing.T) {
+	k := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, testSPN), testRealm, errorcode.KRB_AP_ERR_BADKEYVER, "")
+	k.EText = "kvno 3 not found"
+	err := error(newKRBServerError(k, testSPN))
+
+	want := "kerberos: server rejected AP_REQ for " + testSPN + ": KRB_AP_ERR_BADKEYVER (code 44): kvno 3 not found; server keytab is missing the current kvno"
+	if err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+	var krbErr messages.KRBError
+	if !errors.As(err, &krbErr) || krbErr.ErrorCode != errorcode.KRB_AP_ERR_BADKEYVER {
+		t.Fatalf("errors.As(messages.KRBError) = %+v", krbErr)
+	}
+
+	// Неизвестный код — без подсказки, имя по номеру
+	e := newKRBServerError(messages.KRBError{ErrorCode: 999}, testSPN)
+	if e.Name != "UNKNOWN_999" || strings.Contains(e.Error(), ";") {
+		t.Fatalf("unknown code: %q", e.Error())
+	}
+}
+
+// Истёкший билет от сервера по-прежнему повод взять новый
+func TestKRBServerErrorRetryable(t *testing.T) {
+	expired := newKRBServerError(messages.KRBError{ErrorCode: errorcode.KRB_AP_ERR_TKT_EXPIRED}, testSPN)
+	if !isAuthRetryable(expired) {
+		t.Fatal("expired ticket is not retryable")
+	}
+	if isAuthRetryable(newKRBServerError(messages.KRBError{ErrorCode: errorcode.KRB_AP_ERR_MODIFIED}, testSPN)) {
+		t.Fatal("KRB_AP_ERR_MODIFIED is retryable")
+	}
+}
+
+func TestContinueDecodesBareKRBError(t *testing.T) {
+	kt, g, tok := startExchange(t)
+	acceptAPReq(t, kt, tok)
+	_, _, err := g.Continue(krbErrorToken(t, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, time.Now(), false))
+	var se *KRBServerError
+	if !errors.As(err, &se) || se.Name != "KDC_ERR_S_PRINCIPAL_UNKNOWN" || !strings.Contains(err.Error(), "check krbsrvname") {
+		t.Fatalf("err = %v, want a decoded KDC_ERR_S_PRINCIPAL_UNKNOWN", err)
+	}
+}
@@ -0,0 +1,28 @@
+package pgx
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QueryObserver получает длительность каждой операции под пользователем:
+// op — "query", "exec", "tx", "describe" или "explain", err — её итог (включая ошибку соединения).
+type QueryObserver func(op string, d time.Duration, err error)
+
+var queryObserver atomic.Pointer[QueryObserver]
+
+// SetQueryObserver подключает наблюдателя (метрики и т.п.); nil отключает.
+func SetQueryObserver(fn QueryObserver) {
+	if fn == nil {
+		queryObserver.Store(nil)
+		return
+	}
+	queryObserver.Store(&fn)
+}
+
+// observe вызывается через defer с указателем на именованную ошибку результата.
+func observe(op string, start time.Time, err *error) {
+	if fn := queryObserver.Load(); fn != nil {
+		(*fn)(op, time.Since(start), *err)
+	}
+}
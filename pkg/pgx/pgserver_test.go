@@ -0,0 +1,261 @@
+package pgx
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// fakePG — сервер Postgres в памяти: принимает любой логин (с kt — только
+// через GSS, и принципал должен совпасть с пользователем из startup) и
+// отвечает на простые запросы (Exec без аргументов) пустым CommandComplete.
+// Запрос SLEEP ждёт CancelRequest для своего соединения и отвечает 57014.
+type fakePG struct {
+	kt *keytab.Keytab
+
+	mu      sync.Mutex
+	conns   int
+	queries []fakeQuery
+	logins  []string // принципалы, прошедшие GSS
+	spns    []string // KerberosSpn каждой попытки подключения
+	// Ошибки, которые по одной получат следующие подключения вместо логина
+	fail []*pgproto3.ErrorResponse
+	// Каналы отмены по ProcessID (номеру соединения)
+	cancels map[uint32]chan struct{}
+}
+
+// fakeQuery — запрос и номер соединения (с 1), на котором он пришёл.
+type fakeQuery struct {
+	conn int
+	sql  string
+}
+
+// useFakePG подменяет connectConfig и newPool на подключение к fakePG до
+// конца теста.
+func useFakePG(t *testing.T) *fakePG {
+	t.Helper()
+	srv := &fakePG{}
+	prevConnect, prevPool := connectConfig, newPool
+	connectConfig = func(ctx context.Context, cfg *pgx.ConnConfig) (*pgx.Conn, error) {
+		srv.route(cfg)
+		return pgx.ConnectConfig(ctx, cfg)
+	}
+	newPool = func(ctx context.Context, pc *pgxpool.Config) (*pgxpool.Pool, error) {
+		before := pc.BeforeConnect
+		pc.BeforeConnect = func(ctx context.Context, cfg *pgx.ConnConfig) error {
+			if before != nil {
+				if err := before(ctx, cfg); err != nil {
+					return err
+				}
+			}
+			srv.route(cfg)
+			return nil
+		}
+		return pgxpool.NewWithConfig(ctx, pc)
+	}
+	t.Cleanup(func() { connectConfig, newPool = prevConnect, prevPool })
+	return srv
+}
+
+// route направляет подключение cfg на fakePG и запоминает его KerberosSpn.
+func (s *fakePG) route(cfg *pgx.ConnConfig) {
+	cfg.LookupFunc = func(context.Context, string) ([]string, error) { return []string{"127.0.0.1"}, nil }
+	cfg.DialFunc = s.dial
+	cfg.TLSConfig, cfg.Fallbacks = nil, nil
+	s.mu.Lock()
+	s.spns = append(s.spns, cfg.KerberosSpn)
+	s.mu.Unlock()
+}
+
+// failNext — следующие подключения по одному получат errs (FATAL) вместо логина.
+func (s *fakePG) failNext(errs ...*pgproto3.ErrorResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = append(s.fail, errs...)
+}
+
+// attempts — маршруты KerberosSpn попыток подключения по порядку.
+func (s *fakePG) attempts() []spnRoute {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]spnRoute, 0, len(s.spns))
+	for _, spn := range s.spns {
+		r, _ := parseSPNRoute(spn)
+		out = append(out, r)
+	}
+	return out
+}
+
+const fakeDSN = "host=db.ex.com user=alice dbname=app sslmode=disable"
+
+func (s *fakePG) dial(context.Context, string, string) (net.Conn, error) {
+	client, server := net.Pipe()
+	s.mu.Lock()
+	s.conns++
+	id := s.conns
+	s.mu.Unlock()
+	go s.serve(id, server)
+	return client, nil
+}
+
+func (s *fakePG) serve(id int, c net.Conn) {
+	defer c.Close()
+	be := pgproto3.NewBackend(c, c)
+	msg, err := be.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	if cr, ok := msg.(*pgproto3.CancelRequest); ok {
+		s.cancel(cr.ProcessID)
+		return
+	}
+	s.mu.Lock()
+	var fail *pgproto3.ErrorResponse
+	if len(s.fail) > 0 {
+		fail, s.fail = s.fail[0], s.fail[1:]
+	}
+	s.mu.Unlock()
+	if fail != nil {
+		fail.Severity = "FATAL"
+		be.Send(fail)
+		be.Flush()
+		return
+	}
+	if s.kt != nil {
+		startup, _ := msg.(*pgproto3.StartupMessage)
+		if startup == nil || !s.gssAuth(be, startup.Parameters["user"]) {
+			return
+		}
+	}
+	cancelled := s.cancelChan(uint32(id))
+	be.Send(&pgproto3.AuthenticationOk{})
+	be.Send(&pgproto3.BackendKeyData{ProcessID: uint32(id)})
+	be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if be.Flush() != nil {
+		return
+	}
+	for {
+		msg, err := be.Receive()
+		if err != nil {
+			return
+		}
+		switch m := msg.(type) {
+		case *pgproto3.Query:
+			s.mu.Lock()
+			s.queries = append(s.queries, fakeQuery{id, m.String})
+			s.mu.Unlock()
+			tag, _, _ := strings.Cut(strings.ToUpper(m.String), " ")
+			if tag == "SLEEP" {
+				<-cancelled
+				be.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "57014", Message: "canceling statement due to user request"})
+			} else {
+				be.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+			}
+			be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if be.Flush() != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// gssAuth проводит обмен GSS: AP_REQ клиента должен быть выписан на user.
+func (s *fakePG) gssAuth(be *pgproto3.Backend, user string) bool {
+	fail := func(msg string) bool {
+		be.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28000", Message: msg})
+		be.Flush()
+		return false
+	}
+	be.Send(&pgproto3.AuthenticationGSS{})
+	if be.Flush() != nil {
+		return false
+	}
+	be.SetAuthType(pgproto3.AuthTypeGSS)
+	msg, err := be.Receive()
+	if err != nil {
+		return false
+	}
+	resp, ok := msg.(*pgproto3.GSSResponse)
+	if !ok {
+		return fail("expected GSSResponse")
+	}
+	cname, key, auth, err := acceptToken(s.kt, resp.Data)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if cname != user {
+		return fail("GSSAPI authentication failed for user \"" + user + "\" (principal " + cname + ")")
+	}
+	rep, err := apRep(key, auth)
+	if err != nil {
+		return fail(err.Error())
+	}
+	s.mu.Lock()
+	s.logins = append(s.logins, cname)
+	s.mu.Unlock()
+	be.Send(&pgproto3.AuthenticationGSSContinue{Data: rep})
+	return be.Flush() == nil
+}
+
+func (s *fakePG) cancelChan(pid uint32) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancels == nil {
+		s.cancels = map[uint32]chan struct{}{}
+	}
+	ch := make(chan struct{})
+	s.cancels[pid] = ch
+	return ch
+}
+
+// cancel — CancelRequest для соединения pid (повторный ничего не делает).
+func (s *fakePG) cancel(pid uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.cancels[pid]; ok {
+		close(ch)
+		delete(s.cancels, pid)
+	}
+}
+
+// sleeping — число соединений, на которых сейчас выполняется SLEEP.
+func (s *fakePG) sleeping() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range s.queries {
+		if q.sql == "SLEEP" {
+			if _, waiting := s.cancels[uint32(q.conn)]; waiting {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *fakePG) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// connOf — соединение, на котором пришёл запрос sql (0 — не приходил).
+func (s *fakePG) connOf(sql string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.queries {
+		if q.sql == sql {
+			return q.conn
+		}
+	}
+	return 0
+}
@@ -2,12 +2,12 @@ package pgx
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,108 +17,424 @@ import (
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+
+	"go-http-pgsql-krb5/pkg/krb"
+	"go-http-pgsql-krb5/pkg/redact"
 )
 
-var gssProviderMu sync.Mutex
+// Часовой пояс, в который приводятся time.Time из результатов (nil — как вернул сервер).
+var resultLocation atomic.Pointer[time.Location]
+
+// SetResultTimezone задаёт часовой пояс для значений time.Time в результатах запросов,
+// например "UTC" или "Europe/Moscow". Пустая строка отключает нормализацию.
+func SetResultTimezone(name string) error {
+	if name == "" {
+		resultLocation.Store(nil)
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("load timezone %q: %w", name, err)
+	}
+	resultLocation.Store(loc)
+	return nil
+}
+
+func normalizeTimes(vals []any) {
+	loc := resultLocation.Load()
+	if loc == nil {
+		return
+	}
+	for i, v := range vals {
+		if t, ok := v.(time.Time); ok {
+			vals[i] = t.In(loc)
+		}
+	}
+}
 
 // ---- GSS провайдер, построенный на gokrb5 + ccache ----
 
+var registerGSSOnce sync.Once
+
+// registerRoutedGSS регистрирует в pgconn фабрику routedGSS (один раз на
+// процесс); креды соединения едут в его KerberosSpn, см. spnRoute.
+func registerRoutedGSS() {
+	registerGSSOnce.Do(func() {
+		pgconn.RegisterGSSProvider(func() (pgconn.GSS, error) { return &routedGSS{}, nil })
+	})
+}
+
+// routedGSS создаётся pgconn на каждое соединение и выбирает ccache по KerberosSpn.
+type routedGSS struct {
+	inner pgconn.GSS
+}
+
+func (g *routedGSS) GetInitToken(host, service string) ([]byte, error) {
+	return nil, errNoRoute
+}
+
+func (g *routedGSS) GetInitTokenFromSPN(routed string) ([]byte, error) {
+	r, err := parseSPNRoute(routed)
+	if err != nil {
+		return nil, err
+	}
+	if r.keytab != 0 {
+		k, err := keytabByID(r.keytab)
+		if err != nil {
+			return nil, err
+		}
+		inner, err := k.NewGSS()
+		if err != nil {
+			return nil, err
+		}
+		g.inner = inner
+		return inner.GetInitTokenFromSPN(r.spn)
+	}
+	opts := []GSSOption{WithClientSettings(
+		// полезные тюнинги клиента:
+		client.AssumePreAuthentication(true),
+		client.DisablePAFXFAST(false),
+	)}
+	if r.fresh {
+		opts = append(opts, WithFreshServiceTicket())
+	}
+	inner, err := NewGSSFromCCacheWith(r.ccache, r.krb5Conf, opts...)
+	if err != nil {
+		return nil, err
+	}
+	g.inner = inner
+	return inner.GetInitTokenFromSPN(r.spn)
+}
+
+func (g *routedGSS) Continue(inToken []byte) (bool, []byte, error) {
+	if g.inner == nil {
+		return false, nil, errors.New("kerberos: Continue before init token")
+	}
+	return g.inner.Continue(inToken)
+}
+
 type gssFromCCache struct {
-	cl *client.Client
+	cl    *client.Client
+	flags []int
+	// nil — как настроено глобально через krb.SetCanonicalizeDNS
+	canonicalizeDNS *bool
+
+	// Билет, сессионный ключ и аутентификатор последнего AP_REQ — для проверки
+	// AP_REP и для повторного AP_REQ в следующем шаге обмена
+	tkt  messages.Ticket
+	key  types.EncryptionKey
+	auth types.Authenticator
+	spn  string
+
+	// Шагов Continue в текущем обмене; done — контекст установлен
+	legs int
+	done bool
+}
+
+// maxGSSLegs — предел шагов Continue на один обмен: лишний шаг означает
+// зацикленного или подставного акцептора.
+const maxGSSLegs = 3
+
+// INTEG/CONF обычно достаточно; MUTUAL — чтобы сервер подтвердил себя AP_REP
+var defaultContextFlags = []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagMutual}
+
+// GSSOption настраивает провайдер из NewGSSFromCCacheWith, NewGSSFromKeytabWith
+// и NewKeytabGSS.
+type GSSOption func(*gssOptions)
+
+type gssOptions struct {
+	settings        []func(*client.Settings)
+	flags           []int
+	canonicalizeDNS *bool
+	renewInterval   time.Duration
+	freshTicket     bool
+}
+
+// WithClientSettings передаёт настройки клиенту gokrb5.
+func WithClientSettings(opts ...func(*client.Settings)) GSSOption {
+	return func(o *gssOptions) { o.settings = append(o.settings, opts...) }
+}
+
+// WithContextFlags заменяет флаги контекста GSS в контрольной сумме
+// аутентификатора AP_REQ (по умолчанию Integ|Conf|Mutual), например убирает
+// Conf. Делегировать так TGT нельзя: gokrb5 не кладёт в AP_REQ KRB_CRED, и
+// gssapi.ContextFlagDeleg сервер с gss_accept_delegation увидит без кредов.
+func WithContextFlags(flags ...int) GSSOption {
+	return func(o *gssOptions) { o.flags = append([]int(nil), flags...) }
+}
+
+// WithCanonicalizeDNS включает или выключает для этого провайдера приведение
+// хоста к FQDN через DNS при сборке SPN в GetInitToken ("pg-vip" →
+// "postgres/pg01.example.com"), независимо от krb.SetCanonicalizeDNS.
+func WithCanonicalizeDNS(on bool) GSSOption {
+	return func(o *gssOptions) { o.canonicalizeDNS = &on }
+}
+
+// WithRenewInterval задаёт, как часто провайдер из NewKeytabGSS заново
+// получает TGT (по умолчанию — 3/4 ticket_lifetime из krb5.conf).
+func WithRenewInterval(d time.Duration) GSSOption {
+	return func(o *gssOptions) { o.renewInterval = d }
+}
+
+// WithFreshServiceTicket игнорирует сервисные билеты, уже лежащие в ccache:
+// билет к серверу всегда запрашивается у KDC по TGT.
+func WithFreshServiceTicket() GSSOption {
+	return func(o *gssOptions) { o.freshTicket = true }
+}
+
+func newGSSOptions(opts []GSSOption) gssOptions {
+	o := gssOptions{flags: defaultContextFlags}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
+// NewGSSFromCCache — провайдер по ccache пользователя; opts — настройки
+// клиента gokrb5. Флаги контекста и прочее задаёт NewGSSFromCCacheWith.
 func NewGSSFromCCache(ccachePath, krb5ConfPath string, opts ...func(*client.Settings)) (pgconn.GSS, error) {
-	cc, err := credentials.LoadCCache(ccachePath)
+	return NewGSSFromCCacheWith(ccachePath, krb5ConfPath, WithClientSettings(opts...))
+}
+
+// NewGSSFromCCacheWith — NewGSSFromCCache с опциями GSSOption.
+func NewGSSFromCCacheWith(ccachePath, krb5ConfPath string, opts ...GSSOption) (pgconn.GSS, error) {
+	o := newGSSOptions(opts)
+	cl, err := clientFromCCache(ccachePath, krb5ConfPath, o.freshTicket, o.settings...)
+	if err != nil {
+		return nil, err
+	}
+	return &gssFromCCache{cl: cl, flags: o.flags, canonicalizeDNS: o.canonicalizeDNS}, nil
+}
+
+func clientFromCCache(ccachePath, krb5ConfPath string, fresh bool, opts ...func(*client.Settings)) (*client.Client, error) {
+	cc, err := krb.LoadCCache(context.Background(), ccachePath)
 	if err != nil {
 		return nil, fmt.Errorf("load ccache: %w", err)
 	}
-	var cfg *config.Config
-	if krb5ConfPath != "" {
-		cfg, err = config.Load(krb5ConfPath)
-		if err != nil {
-			return nil, fmt.Errorf("load krb5.conf: %w", err)
+	if fresh {
+		dropServiceTickets(cc)
+	}
+	// Истёкший TGT иначе всплывёт невнятной ошибкой из GetServiceTicket внутри connect
+	if end, err := tgtEndTime(cc); err == nil {
+		if err := checkNotExpired(end); err != nil {
+			return nil, err
 		}
-	} else {
-		cfg = config.New() // допустимо, если krb5.conf системный
+	}
+	cfg, err := loadKrb5Conf(krb5ConfPath)
+	if err != nil {
+		return nil, err
 	}
 	cl, err := client.NewFromCCache(cc, cfg, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("client from ccache: %w", err)
 	}
-	return &gssFromCCache{cl: cl}, nil
+	return cl, nil
+}
+
+// dropServiceTickets оставляет в загруженном ccache только TGT (krbtgt/...).
+func dropServiceTickets(cc *credentials.CCache) {
+	kept := cc.Credentials[:0]
+	for _, c := range cc.Credentials {
+		if names := c.Server.PrincipalName.NameString; len(names) > 0 && names[0] == "krbtgt" {
+			kept = append(kept, c)
+		}
+	}
+	cc.Credentials = kept
+}
+
+func loadKrb5Conf(path string) (*config.Config, error) {
+	if path == "" {
+		return config.New(), nil // допустимо, если krb5.conf системный
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("load krb5.conf: %w", err)
+	}
+	return cfg, nil
+}
+
+// CheckDelegatedTicket проверяет, что по делегированному ccache можно получить
+// сервисный билет для spn (например, "postgres/db.example.com"), ещё до подключения.
+func CheckDelegatedTicket(ccachePath, krb5ConfPath, spn string) error {
+	cl, err := clientFromCCache(ccachePath, krb5ConfPath, false, client.AssumePreAuthentication(true))
+	if err != nil {
+		return err
+	}
+	if _, _, err := cl.GetServiceTicket(spn); err != nil {
+		return fmt.Errorf("delegated credentials cannot obtain a ticket for %s: %w", spn, err)
+	}
+	return nil
 }
 
 func (g *gssFromCCache) GetInitToken(host, service string) ([]byte, error) {
-	spn := service + "/" + canonicalizeHost(host)
-	return g.GetInitTokenFromSPN(spn)
+	return g.GetInitTokenFromSPN(g.spnFor(host, service))
+}
+
+func (g *gssFromCCache) spnFor(host, service string) string {
+	if g.canonicalizeDNS == nil {
+		return krb.ServiceSPN(service, host)
+	}
+	if *g.canonicalizeDNS {
+		host = krb.CanonicalHostDNS(host)
+	}
+	return service + "/" + krb.CanonicalHost(host)
 }
 
 func (g *gssFromCCache) GetInitTokenFromSPN(spn string) ([]byte, error) {
 	// Получаем сервисный тикет и сессионный ключ для SPN
 	tkt, key, err := g.cl.GetServiceTicket(spn)
 	if err != nil {
+		// Чаще всего SPN зарегистрирован под другим сервисом — подсказываем krbsrvname
+		if strings.Contains(err.Error(), "KDC_ERR_S_PRINCIPAL_UNKNOWN") {
+			return nil, fmt.Errorf("get service ticket for %s (check krbsrvname in the DSN): %w", spn, err)
+		}
 		return nil, fmt.Errorf("get service ticket for %s: %w", spn, err)
 	}
-	// Собираем GSS-микротокен Kerberos (AP_REQ) с обязательными флагами
-	krbTok, err := spnego.NewKRB5TokenAPREQ(
-		g.cl, tkt, key,
-		[]int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagMutual}, // INTEG/CONF обычно достаточно
-		nil, // без спец. APOptions
-	)
+	g.tkt, g.key, g.spn, g.legs, g.done = tkt, key, spn, 0, false
+	return g.apReq(0)
+}
+
+// apReq собирает GSS-микротокен Kerberos (AP_REQ) с флагами контекста по
+// текущему билету; skew сдвигает время аутентификатора к часам сервера.
+func (g *gssFromCCache) apReq(skew time.Duration) ([]byte, error) {
+	krbTok, err := krb.NewAPREQTokenAt(g.cl, g.tkt, g.key, g.flags, skew)
+	if err != nil {
+		return nil, fmt.Errorf("build KRB5 token for %s: %w", g.spn, err)
+	}
+	// Аутентификатор уходит зашифрованным; расшифровываем свою же копию,
+	// чтобы сверить с ним ctime/cusec из AP_REP
+	if err := krbTok.APReq.DecryptAuthenticator(g.key); err != nil {
+		return nil, fmt.Errorf("decrypt own authenticator for %s: %w", g.spn, err)
+	}
+	g.auth = krbTok.APReq.Authenticator
+	b, err := krbTok.Marshal()
 	if err != nil {
-		return nil, fmt.Errorf("build KRB5 token: %w", err)
+		return nil, fmt.Errorf("marshal KRB5 token for %s: %w", g.spn, err)
 	}
-	return krbTok.Marshal()
+	return b, nil
 }
 
-// В Postgres обычно один раунд (AP_REQ). Если сервер пришлёт AP_REP, просто завершаем.
+// Continue — следующий шаг обмена GSS. Обычно он один: мы просим
+// ContextFlagMutual, сервер отвечает AP_REP, и его проверка защищает от
+// подставного Postgres. Следующий AP_REQ (false, токен, nil) уходит, если
+// акцептор продолжает обмен: на KRB_AP_ERR_SKEW — с временем по часам сервера
+// из KRB-ERROR (так делает Kerberos SSP в Windows). Ответ в обёртке SPNEGO
+// (NegTokenResp) разворачивается. Прочий KRB-ERROR (в GSS-обёртке или голый)
+// превращается в *KRBServerError с кодом, именем и e-text. Шагов не больше
+// maxGSSLegs; после установки контекста новые токены — ошибка.
 func (g *gssFromCCache) Continue(inToken []byte) (bool, []byte, error) {
+	if g.done {
+		return false, nil, errors.New("kerberos: unexpected server token after the context was established")
+	}
+	if g.legs++; g.legs > maxGSSLegs {
+		return false, nil, fmt.Errorf("kerberos: no context for %s after %d legs", g.spn, maxGSSLegs)
+	}
+	inToken, err := unwrapNegTokenResp(inToken)
+	if err != nil {
+		return false, nil, err
+	}
 	var tok spnego.KRB5Token
 	if err := tok.Unmarshal(inToken); err != nil {
-		// если пришло что-то нестандартное — считаем обмен завершенным
+		var krbErr messages.KRBError
+		if krbErr.Unmarshal(inToken) == nil {
+			return g.continueAfterError(krbErr)
+		}
+		return false, nil, fmt.Errorf("kerberos: unexpected server token: %w", err)
+	}
+	switch {
+	case tok.IsKRBError():
+		return g.continueAfterError(tok.KRBError)
+	case tok.IsAPRep():
+		if _, err := krb.VerifyAPRep(tok.APRep, g.key, g.auth); err != nil {
+			return false, nil, fmt.Errorf("kerberos: mutual authentication failed: %w", err)
+		}
+		g.done = true
 		return true, nil, nil
+	default:
+		return false, nil, errors.New("kerberos: server token is neither AP_REP nor KRB-ERROR")
 	}
-	// Нет ответа, либо AP_REP/KRB-ERROR — в обоих случаях новых токенов не шлём
-	return true, nil, nil
 }
 
-func canonicalizeHost(h string) string {
-	h = strings.TrimSuffix(strings.ToLower(h), ".")
-	// при желании можно добавить net.LookupCNAME/LookupHost, чтобы получить FQDN
-	return h
+// continueAfterError — следующий AP_REQ, если ошибку можно исправить в этом же
+// обмене (расхождение часов), иначе *KRBServerError. Сам PostgreSQL после
+// ошибки обмен не продолжает — для него это та же ошибка, что и раньше.
+func (g *gssFromCCache) continueAfterError(krbErr messages.KRBError) (bool, []byte, error) {
+	if krbErr.ErrorCode != errorcode.KRB_AP_ERR_SKEW || krbErr.STime.IsZero() || g.legs >= maxGSSLegs {
+		return false, nil, newKRBServerError(krbErr, g.spn)
+	}
+	server := krbErr.STime.Add(time.Duration(krbErr.Susec) * time.Microsecond)
+	next, err := g.apReq(time.Until(server))
+	if err != nil {
+		return false, nil, err
+	}
+	return false, next, nil
+}
+
+// unwrapNegTokenResp достаёт responseToken из ответа SPNEGO; прочие токены
+// возвращаются как есть.
+func unwrapNegTokenResp(b []byte) ([]byte, error) {
+	var st spnego.SPNEGOToken
+	if st.Unmarshal(b) != nil || !st.Resp {
+		return b, nil
+	}
+	switch st.NegTokenResp.State() {
+	case spnego.NegStateReject:
+		return nil, errors.New("kerberos: server rejected the SPNEGO negotiation")
+	case spnego.NegStateRequestMIC:
+		return nil, errors.New("kerberos: server requested an SPNEGO mechListMIC, which is not supported")
+	}
+	if len(st.NegTokenResp.ResponseToken) == 0 {
+		return nil, errors.New("kerberos: SPNEGO response without a mechanism token")
+	}
+	return st.NegTokenResp.ResponseToken, nil
 }
 
 // ---- Как использовать в хэндлере ----
 
 // Рекомендуемый вариант для E2E SSO: открывать ПРОСТОЕ соединение на запрос,
 // выполняем нужный SQL и закрываем — без пула (иначе перемешаете креды).
-func QueryAsUser(ctx context.Context, dsn string, ccachePath string, krb5Conf string, sql string, args ...any) (rows [][]any, _ error) {
-	// Регистрируем фабрику GSS, возвращающую провайдер из нужного ccache.
-	// Это глобальная регистрация в pgconn, поэтому создание соединения MUST быть
-	// синхронизировано, если у вас параллелизм. Проще — не использовать пул.
-	cfg, err := pgx.ParseConfig(dsn)
+func QueryAsUser(ctx context.Context, dsn string, ccachePath string, krb5Conf string, sql string, args ...any) (rows [][]any, err error) {
+	defer observe("query", time.Now(), &err)
+	// Креды едут в конфиге соединения (см. routeCredentials), так что
+	// параллельные запросы разных пользователей не мешают друг другу.
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
 	if err != nil {
 		return nil, err
 	}
-	// (опционально) указать TLS, таймауты, Dialer и т.п.
-	cfg.ConnectTimeout = 5 * time.Second
-	cfg.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: os.Getenv("PG_HOST")}
-	gssProviderMu.Lock()
-	pgconn.RegisterGSSProvider(func() (pgconn.GSS, error) {
-		return NewGSSFromCCache(ccachePath, krb5Conf,
-			// полезные тюнинги клиента:
-			client.AssumePreAuthentication(true),
-			client.DisablePAFXFAST(false),
-		)
-	})
+	defer release()
 
-	conn, err := pgx.ConnectConfig(ctx, cfg)
-	gssProviderMu.Unlock()
+	r, err := conn.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close(ctx)
+	defer r.Close()
+
+	var out [][]any
+	for r.Next() {
+		vals, err := r.Values()
+		if err != nil {
+			return nil, err
+		}
+		normalizeTimes(vals)
+		out = append(out, vals)
+	}
+	return out, r.Err()
+}
+
+// QueryAsUserNamed — как QueryAsUser, но каждая строка — map имя колонки → значение,
+// чтобы вызывающий не зависел от порядка колонок в SELECT.
+// При повторяющихся именах колонок побеждает последняя.
+func QueryAsUserNamed(ctx context.Context, dsn, ccachePath, krb5Conf, sql string, args ...any) (_ []map[string]any, err error) {
+	defer observe("query", time.Now(), &err)
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	r, err := conn.Query(ctx, sql, args...)
 	if err != nil {
@@ -126,40 +442,302 @@ func QueryAsUser(ctx context.Context, dsn string, ccachePath string, krb5Conf st
 	}
 	defer r.Close()
 
-	var out [][]any
+	fields := r.FieldDescriptions()
+	var out []map[string]any
 	for r.Next() {
 		vals, err := r.Values()
 		if err != nil {
 			return nil, err
 		}
-		out = append(out, vals)
+		normalizeTimes(vals)
+		row := make(map[string]any, len(fields))
+		for i, f := range fields {
+			row[f.Name] = vals[i]
+		}
+		out = append(out, row)
 	}
 	return out, r.Err()
 }
 
+// QueryAsUserStream выполняет запрос под делегированным пользователем и
+// отдаёт строки в fn по одной, не накапливая результат в памяти. columns —
+// имена колонок (одинаковые для всех вызовов). Ошибка fn прерывает чтение.
+func QueryAsUserStream(ctx context.Context, dsn, ccachePath, krb5Conf, sql string, fn func(columns []string, values []any) error, args ...any) (err error) {
+	defer observe("query", time.Now(), &err)
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	r, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fields := r.FieldDescriptions()
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+	for r.Next() {
+		vals, err := r.Values()
+		if err != nil {
+			return err
+		}
+		normalizeTimes(vals)
+		if err := fn(columns, vals); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// ExecAsUser выполняет INSERT/UPDATE/DELETE под делегированным пользователем
+// на отдельном соединении (как QueryAsUser) и возвращает число затронутых строк.
+func ExecAsUser(ctx context.Context, dsn, ccachePath, krb5Conf, sql string, args ...any) (_ int64, err error) {
+	defer observe("exec", time.Now(), &err)
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	tag, err := conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// connectAsUser открывает одиночное соединение под делегированными кредами из ccachePath.
+func connectAsUser(ctx context.Context, dsn, ccachePath, krb5Conf string) (*pgx.Conn, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, redact.Error(err, dsn, redact.DSN(dsn))
+	}
+	// Таймаут — SetConnectTimeout, TLS — SetTLSConfig
+	cfg.ConnectTimeout = time.Duration(connectTimeout.Load())
+	applyTLS(&cfg.Config)
+	applyStatementTimeout(&cfg.Config)
+
+	registerRoutedGSS()
+	if err := routeCredentials(&cfg.Config, ccachePath, krb5Conf); err != nil {
+		return nil, err
+	}
+
+	return connectWithRetry(ctx, func(ctx context.Context, fresh bool) (*pgx.Conn, error) {
+		if fresh {
+			routeFreshTicket(&cfg.Config)
+		}
+		conn, err := connectConfig(ctx, cfg)
+		if err == nil {
+			trackConn(conn.PgConn())
+		}
+		return conn, err
+	})
+}
+
+// connectWithRetry — подключение с повторами, общими для одиночных соединений
+// и пулов пользователей. Сервисный билет мог истечь между получением и AP_REQ:
+// на такой отказ (isAuthRetryable) connect один раз повторяется с fresh —
+// с новым билетом от KDC, без ожидания и без учёта в попытках. Пока сервер
+// стартует (57P03/57P01), повторы идут по SetStartupRetry.
+func connectWithRetry[T any](ctx context.Context, connect func(ctx context.Context, fresh bool) (T, error)) (T, error) {
+	policy := startupRetry.Load()
+	fresh := false
+	for attempt := 0; ; attempt++ {
+		c, err := connect(ctx, fresh)
+		if err != nil && !fresh && isAuthRetryable(err) {
+			fresh = true
+			attempt--
+			continue
+		}
+		if err == nil || policy == nil || attempt >= policy.attempts || !isServerStarting(err) {
+			return c, err
+		}
+		// Сервер поднимается/в recovery — ждём и пробуем снова (бэкофф удваивается)
+		select {
+		case <-ctx.Done():
+			return c, err
+		case <-time.After(policy.backoff << attempt):
+		}
+	}
+}
+
+// ---- Повтор подключения, пока Postgres стартует ----
+
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+}
+
+var startupRetry atomic.Pointer[retryPolicy]
+
+// SetStartupRetry включает до attempts повторов подключения с экспоненциальным
+// бэкоффом от backoff, если сервер отвечает 57P03 (cannot_connect_now) или
+// 57P01 (admin_shutdown). attempts <= 0 отключает повторы.
+func SetStartupRetry(attempts int, backoff time.Duration) {
+	if attempts <= 0 {
+		startupRetry.Store(nil)
+		return
+	}
+	startupRetry.Store(&retryPolicy{attempts: attempts, backoff: backoff})
+}
+
+func isServerStarting(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "57P03" || pgErr.Code == "57P01"
+}
+
+// isAuthRetryable — отказ в аутентификации, который может пройти с новым
+// сервисным билетом: KRB-ERROR об истёкшем/ещё не действующем билете от
+// сервера или 28000 «GSSAPI authentication failed» от Postgres (так он
+// сообщает о неудаче GSSAPI). Прочие 28000 (нет роли, нет записи в
+// pg_hba.conf), 28P01 (пароль), ошибки SQL и прав с новым билетом не
+// пройдут — их не повторяем.
+func isAuthRetryable(err error) bool {
+	var krbErr messages.KRBError
+	if errors.As(err, &krbErr) {
+		return krbErr.ErrorCode == errorcode.KRB_AP_ERR_TKT_EXPIRED || krbErr.ErrorCode == errorcode.KRB_AP_ERR_TKT_NYV
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "28000" && strings.Contains(pgErr.Message, "GSSAPI authentication failed")
+	}
+	return false
+}
+
+// ---- Проверка SQL без выполнения ----
+
+// Description — выведенные сервером типы параметров и колонок результата.
+type Description struct {
+	Params  []string     `json:"params"`
+	Columns []ColumnType `json:"columns"`
+}
+
+type ColumnType struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// DescribeAsUser готовит (PREPARE) запрос под делегированным пользователем и
+// возвращает типы параметров и колонок, ничего не выполняя. Ошибки синтаксиса
+// и прав доступа к объектам приходят так же, как при реальном запуске.
+func DescribeAsUser(ctx context.Context, dsn, ccachePath, krb5Conf, sql string) (_ *Description, err error) {
+	defer observe("describe", time.Now(), &err)
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sd, err := conn.Describe(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	typeName := func(oid uint32) string {
+		if t, ok := conn.TypeMap().TypeForOID(oid); ok {
+			return t.Name
+		}
+		return fmt.Sprintf("oid:%d", oid)
+	}
+	out := &Description{Params: []string{}, Columns: []ColumnType{}}
+	for _, oid := range sd.ParamOIDs {
+		out.Params = append(out.Params, typeName(oid))
+	}
+	for _, f := range sd.Fields {
+		out.Columns = append(out.Columns, ColumnType{Name: f.Name, Type: typeName(f.DataTypeOID)})
+	}
+	return out, nil
+}
+
+// ExplainAsUser возвращает план запроса в виде EXPLAIN (FORMAT JSON) под
+// делегированным пользователем. Без ANALYZE: сам запрос не выполняется.
+func ExplainAsUser(ctx context.Context, dsn, ccachePath, krb5Conf, sql string, args ...any) (_ []byte, err error) {
+	defer observe("explain", time.Now(), &err)
+	conn, release, err := runner.Connect(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var plan []byte
+	if err := conn.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+sql, args...).Scan(&plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
 // Если всё же критично использовать pgxpool, делайте ПУЛ НА ЗАПРОС:
 //   - MaxConns=1, MinConns=0, MaxConnLifetime ~ время жизни делегированного ccache (или меньше)
 //   - создавайте pool в хэндлере, используйте, закрывайте.
 //
 // Постоянный общий пул НЕподходит для E2E SSO — там смешаются пользователи.
+// MaxConnLifetime — SetMaxConnLifetime, но не дольше срока ccache.
 func PoolForUser(ctx context.Context, dsn, ccachePath, krb5Conf string) (*pgxpool.Pool, error) {
-	pc, err := pgxpool.ParseConfig(dsn)
+	expires, err := ccacheExpiry(ctx, ccachePath)
 	if err != nil {
 		return nil, err
 	}
-	pc.MaxConns = 1
+	lifetime := poolLifetime(time.Now(), expires)
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("%w at %s", ErrCredentialsExpired, expires.UTC().Format(time.RFC3339))
+	}
+	return newUserPool(ctx, dsn, ccachePath, krb5Conf, 1, lifetime)
+}
+
+func newUserPool(ctx context.Context, dsn, ccachePath, krb5Conf string, maxConns int32, lifetime time.Duration) (*pgxpool.Pool, error) {
+	pc, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, redact.Error(err, dsn, redact.DSN(dsn))
+	}
+	pc.MaxConns = maxConns
 	pc.MinConns = 0
-	pc.MaxConnLifetime = 30 * time.Second
-	pc.HealthCheckPeriod = 0
+	pc.MaxConnLifetime = lifetime
+	pc.ConnConfig.ConnectTimeout = time.Duration(connectTimeout.Load())
+	// 0 pgxpool не принимает (паника в NewTicker); проверка закрывает и
+	// соединения старше MaxConnLifetime — не реже, чем истекает ccache
+	pc.HealthCheckPeriod = min(lifetime, time.Minute)
 	pc.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
-		d := net.Dialer{Timeout: 5 * time.Second}
+		d := net.Dialer{Timeout: time.Duration(connectTimeout.Load())}
 		return d.DialContext(ctx, network, addr)
 	}
-	gssProviderMu.Lock()
-	pgconn.RegisterGSSProvider(func() (pgconn.GSS, error) {
-		return NewGSSFromCCache(ccachePath, krb5Conf)
+	pc.AfterConnect = func(_ context.Context, c *pgx.Conn) error {
+		trackConn(c.PgConn())
+		return nil
+	}
+	pc.BeforeClose = func(c *pgx.Conn) { untrackConn(c.PgConn()) }
+	// Повтор с новым билетом (acquirePooled) — через ctx: пул подключается сам
+	pc.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		if fresh, _ := ctx.Value(freshTicketKey{}).(bool); fresh {
+			routeFreshTicket(&cc.Config)
+		}
+		return nil
+	}
+	registerRoutedGSS()
+	applyTLS(&pc.ConnConfig.Config)
+	applyStatementTimeout(&pc.ConnConfig.Config)
+	if err := routeCredentials(&pc.ConnConfig.Config, ccachePath, krb5Conf); err != nil {
+		return nil, err
+	}
+	return newPool(ctx, pc)
+}
+
+type freshTicketKey struct{}
+
+// acquirePooled — соединение из пула пользователя с теми же повторами, что у
+// connectAsUser: новое соединение пул открывает внутри Acquire.
+func acquirePooled(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	return connectWithRetry(ctx, func(ctx context.Context, fresh bool) (*pgxpool.Conn, error) {
+		if fresh {
+			ctx = context.WithValue(ctx, freshTicketKey{}, true)
+		}
+		return pool.Acquire(ctx)
 	})
-	pool, err := pgxpool.NewWithConfig(ctx, pc)
-	gssProviderMu.Unlock()
-	return pool, err
 }
@@ -0,0 +1,187 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+func TestIsAuthRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"gss failed", &pgconn.PgError{Code: "28000", Message: `GSSAPI authentication failed for user "alice"`}, true},
+		{"ticket expired", fmt.Errorf("gss: %w", messages.KRBError{ErrorCode: errorcode.KRB_AP_ERR_TKT_EXPIRED}), true},
+		{"ticket not yet valid", messages.KRBError{ErrorCode: errorcode.KRB_AP_ERR_TKT_NYV}, true},
+		{"other krb error", messages.KRBError{ErrorCode: errorcode.KRB_AP_ERR_BAD_INTEGRITY}, false},
+		{"no role", &pgconn.PgError{Code: "28000", Message: `role "alice" does not exist`}, false},
+		{"no pg_hba entry", &pgconn.PgError{Code: "28000", Message: `no pg_hba.conf entry for host "10.0.0.1", user "alice", database "app"`}, false},
+		{"password", &pgconn.PgError{Code: "28P01", Message: `password authentication failed for user "alice"`}, false},
+		{"privilege", &pgconn.PgError{Code: "42501", Message: "permission denied for table t"}, false},
+	}
+	for _, c := range cases {
+		if got := isAuthRetryable(c.err); got != c.want {
+			t.Errorf("%s: isAuthRetryable = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConnectRetriesOnlyGSSFailures(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+
+	// Отказ GSSAPI — один повтор с новым билетом
+	srv := useFakePG(t)
+	srv.failNext(&pgproto3.ErrorResponse{Code: "28000", Message: `GSSAPI authentication failed for user "alice"`})
+	if _, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.attempts(); len(got) != 2 || got[0].fresh || !got[1].fresh {
+		t.Fatalf("attempts after GSS failure = %+v, want a second one with a fresh ticket", got)
+	}
+
+	// Роль, pg_hba.conf, пароль — новый билет не поможет
+	for _, fail := range []*pgproto3.ErrorResponse{
+		{Code: "28000", Message: `role "alice" does not exist`},
+		{Code: "28000", Message: `no pg_hba.conf entry for host "127.0.0.1", user "alice", database "app"`},
+		{Code: "28P01", Message: `password authentication failed for user "alice"`},
+	} {
+		srv := useFakePG(t)
+		srv.failNext(fail)
+		if _, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "select 1"); err == nil {
+			t.Fatalf("%s: connect succeeded", fail.Message)
+		}
+		if n := len(srv.attempts()); n != 1 {
+			t.Fatalf("%s: attempts = %d, want no retry", fail.Message, n)
+		}
+	}
+}
+
+// Новый билет запрашивается один раз: второй отказ GSSAPI уходит вызывающему
+func TestConnectFreshTicketRetryOnce(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	srv := useFakePG(t)
+	gssFailed := &pgproto3.ErrorResponse{Code: "28000", Message: `GSSAPI authentication failed for user "alice"`}
+	srv.failNext(gssFailed, gssFailed)
+
+	_, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "select 1")
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "28000" {
+		t.Fatalf("err = %v, want the second GSSAPI failure", err)
+	}
+	if got := srv.attempts(); len(got) != 2 || got[0].fresh || !got[1].fresh {
+		t.Fatalf("attempts = %+v, want one retry with a fresh ticket", got)
+	}
+}
+
+func TestCheckDelegatedTicket(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+
+	// Билет на testSPN уже в ccache — KDC не нужен
+	if err := CheckDelegatedTicket(ccache, "", testSPN); err != nil {
+		t.Fatal(err)
+	}
+	// На другой SPN билета нет, а KDC в пустом krb5.conf не найти
+	err := CheckDelegatedTicket(ccache, "", "postgres/other.ex.com")
+	if err == nil || !strings.Contains(err.Error(), "cannot obtain a ticket for postgres/other.ex.com") {
+		t.Fatalf("err = %v, want the SPN in the error", err)
+	}
+	if err := CheckDelegatedTicket(filepath.Join(t.TempDir(), "missing"), "", testSPN); err == nil {
+		t.Fatal("missing ccache accepted")
+	}
+}
+
+func TestInitTokenErrorNamesSPN(t *testing.T) {
+	kt := testKeytab(t)
+	g, err := NewGSSFromCCache(writeUserCCache(t, kt, "alice"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Хост приводится так же, как имя билета в ccache: регистр и точка в конце не мешают
+	if _, err := g.GetInitToken("DB.Ex.COM.", "postgres"); err != nil {
+		t.Fatal(err)
+	}
+	// В ошибке — SPN, ушедший в KDC, а не исходный хост
+	_, err = g.GetInitToken("Other.EX.COM.", "postgres")
+	if err == nil || !strings.Contains(err.Error(), "get service ticket for postgres/other.ex.com:") {
+		t.Fatalf("err = %v, want the canonical SPN", err)
+	}
+}
+
+// connectSeq — connect для connectWithRetry, возвращающий errs по очереди
+// (после них — успех); n считает попытки.
+func connectSeq(n *int, errs ...error) func(context.Context, bool) (int, error) {
+	return func(context.Context, bool) (int, error) {
+		*n++
+		if *n <= len(errs) {
+			return 0, errs[*n-1]
+		}
+		return *n, nil
+	}
+}
+
+func TestConnectStartupRetry(t *testing.T) {
+	starting := &pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}
+	shutdown := &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}
+	defer SetStartupRetry(0, 0)
+
+	// Повторы выключены — первая же ошибка
+	SetStartupRetry(0, 0)
+	n := 0
+	if _, err := connectWithRetry(context.Background(), connectSeq(&n, starting)); err != starting || n != 1 {
+		t.Fatalf("disabled: err = %v after %d attempts", err, n)
+	}
+
+	SetStartupRetry(2, time.Millisecond)
+	n = 0
+	if _, err := connectWithRetry(context.Background(), connectSeq(&n, starting, shutdown)); err != nil || n != 3 {
+		t.Fatalf("recovered: err = %v after %d attempts", err, n)
+	}
+	n = 0
+	if _, err := connectWithRetry(context.Background(), connectSeq(&n, starting, starting, starting)); err != starting || n != 3 {
+		t.Fatalf("exhausted: err = %v after %d attempts, want 3", err, n)
+	}
+	// Прочие ошибки не повторяются
+	denied := &pgconn.PgError{Code: "42501", Message: "permission denied for database app"}
+	n = 0
+	if _, err := connectWithRetry(context.Background(), connectSeq(&n, denied)); err != denied || n != 1 {
+		t.Fatalf("other error: err = %v after %d attempts", err, n)
+	}
+}
+
+func TestConnectStartupRetryStopsOnContext(t *testing.T) {
+	SetStartupRetry(5, time.Hour)
+	defer SetStartupRetry(0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	n := 0
+	_, err := connectWithRetry(ctx, connectSeq(&n, &pgconn.PgError{Code: "57P03"}))
+	if err == nil || n != 1 || time.Since(start) > 5*time.Second {
+		t.Fatalf("err = %v after %d attempts in %v", err, n, time.Since(start))
+	}
+}
+
+func TestConnectErrorRedactsDSN(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	// pgconn сам прячет только password; sslkey маскирует redact
+	_, err := ExecAsUser(context.Background(), "host=db.ex.com sslkey=/secret/client.key port=notaport", ccache, "", "select 1")
+	if err == nil || strings.Contains(err.Error(), "/secret/client.key") {
+		t.Fatalf("err = %v, want an error without the key path", err)
+	}
+}
@@ -0,0 +1,119 @@
+package pgx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// pgconn хранит одну глобальную фабрику GSS без аргументов, поэтому креды
+// конкретного соединения нельзя замкнуть в фабрике — параллельные запросы
+// перетёрли бы друг друга. Вместо этого фабрика регистрируется один раз, а
+// путь к ccache и krb5.conf едут в KerberosSpn конфига соединения:
+//
+//	spn \x00 ccache \x00 krb5conf [\x00 fresh]   делегированные креды
+//	spn \x00 keytab:<id>                         провайдер KeytabGSS (Route)
+//
+// NUL не встречается ни в SPN, ни в путях, поэтому разделитель однозначен;
+// поля с NUL отвергаются при сборке маршрута.
+const spnRouteSep = "\x00"
+
+const (
+	routeFresh  = "fresh"
+	routeKeytab = "keytab:"
+)
+
+// errNoRoute — соединение открыто мимо QueryAsUser/PoolForUser: в KerberosSpn
+// только SPN, кредов нет.
+var errNoRoute = errors.New("kerberos: connection has no delegated credentials (use QueryAsUser/PoolForUser)")
+
+// spnRoute — разобранный маршрут из KerberosSpn.
+type spnRoute struct {
+	spn      string
+	ccache   string
+	krb5Conf string
+	// fresh — не брать сервисный билет из ccache, а запросить новый у KDC
+	fresh bool
+	// keytab — id провайдера KeytabGSS вместо ccache (0 — нет)
+	keytab uint64
+}
+
+func (r spnRoute) String() string {
+	if r.keytab != 0 {
+		return r.spn + spnRouteSep + routeKeytab + strconv.FormatUint(r.keytab, 10)
+	}
+	s := r.spn + spnRouteSep + r.ccache + spnRouteSep + r.krb5Conf
+	if r.fresh {
+		s += spnRouteSep + routeFresh
+	}
+	return s
+}
+
+// parseSPNRoute разбирает KerberosSpn, собранный spnRoute.String.
+func parseSPNRoute(s string) (spnRoute, error) {
+	parts := strings.Split(s, spnRouteSep)
+	var r spnRoute
+	switch {
+	case len(parts) == 1:
+		return r, errNoRoute
+	case len(parts) == 2 && strings.HasPrefix(parts[1], routeKeytab):
+		id, err := strconv.ParseUint(strings.TrimPrefix(parts[1], routeKeytab), 10, 64)
+		if err != nil || id == 0 {
+			return r, fmt.Errorf("kerberos: malformed keytab route %q", parts[1])
+		}
+		r.keytab = id
+	case len(parts) == 3, len(parts) == 4 && parts[3] == routeFresh:
+		r.ccache, r.krb5Conf, r.fresh = parts[1], parts[2], len(parts) == 4
+		if r.ccache == "" {
+			return spnRoute{}, errors.New("kerberos: credentials route without a ccache")
+		}
+	default:
+		return r, fmt.Errorf("kerberos: malformed credentials route (%d fields)", len(parts))
+	}
+	r.spn = parts[0]
+	if r.spn == "" {
+		return spnRoute{}, errors.New("kerberos: credentials route without an SPN")
+	}
+	return r, nil
+}
+
+// routeCredentials прописывает в cfg креды, под которыми соединение пройдёт GSS.
+func routeCredentials(cfg *pgconn.Config, ccachePath, krb5Conf string) error {
+	r := spnRoute{spn: connSPN(cfg), ccache: ccachePath, krb5Conf: krb5Conf}
+	if r.ccache == "" {
+		return errors.New("kerberos: empty ccache path")
+	}
+	for _, f := range []string{r.spn, r.ccache, r.krb5Conf} {
+		if strings.Contains(f, spnRouteSep) {
+			return fmt.Errorf("kerberos: NUL byte in %q", f)
+		}
+	}
+	cfg.KerberosSpn = r.String()
+	return nil
+}
+
+// connSPN — SPN сервера соединения: явный krbspn или krbsrvname/хост.
+func connSPN(cfg *pgconn.Config) string {
+	if cfg.KerberosSpn != "" {
+		return cfg.KerberosSpn
+	}
+	service := DefaultKrbSrvName
+	if cfg.KerberosSrvName != "" {
+		service = cfg.KerberosSrvName
+	}
+	return krb.ServiceSPN(service, cfg.Host)
+}
+
+// routeFreshTicket помечает маршрут так, чтобы провайдер не брал сервисный
+// билет из ccache, а запросил новый у KDC (повтор после отказа в аутентификации).
+func routeFreshTicket(cfg *pgconn.Config) {
+	if r, err := parseSPNRoute(cfg.KerberosSpn); err == nil && r.keytab == 0 {
+		r.fresh = true
+		cfg.KerberosSpn = r.String()
+	}
+}
@@ -0,0 +1,134 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSPNRouteRoundTrip(t *testing.T) {
+	for _, r := range []spnRoute{
+		{spn: "postgres/db.ex.com", ccache: "/run/krb5cc_1000", krb5Conf: "/etc/krb5.conf"},
+		{spn: "postgres/db.ex.com", ccache: "/run/krb5cc_1000"}, // системный krb5.conf
+		{spn: "postgres/db.ex.com", ccache: "/run/krb5cc_1000", krb5Conf: "/etc/krb5.conf", fresh: true},
+		{spn: "postgres/db.ex.com@EX.COM", ccache: `C:\Users\alice\krb5cc`, krb5Conf: `C:\krb5.ini`},
+		{spn: "postgres/db.ex.com", ccache: "KCM:1000"},
+		{spn: "postgres/db.ex.com", ccache: "/tmp/keytab:1"}, // похоже на маршрут keytab, но три поля
+		{spn: "postgres/db.ex.com", keytab: 42},
+	} {
+		got, err := parseSPNRoute(r.String())
+		if err != nil {
+			t.Errorf("%+v: %v", r, err)
+			continue
+		}
+		if got != r {
+			t.Errorf("round trip: got %+v, want %+v", got, r)
+		}
+	}
+}
+
+func TestParseSPNRouteMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"postgres/db.ex.com", // SPN без кредов — соединение мимо QueryAsUser
+		"postgres/db.ex.com\x00/run/krb5cc_1000",
+		"postgres/db.ex.com\x00/run/krb5cc_1000\x00/etc/krb5.conf\x00stale",
+		"postgres/db.ex.com\x00/run/krb5cc_1000\x00/etc/krb5.conf\x00fresh\x00fresh",
+		"\x00/run/krb5cc_1000\x00/etc/krb5.conf",
+		"postgres/db.ex.com\x00\x00/etc/krb5.conf",
+		"postgres/db.ex.com\x00keytab:",
+		"postgres/db.ex.com\x00keytab:x1",
+		"postgres/db.ex.com\x00keytab:0",
+		"postgres/db.ex.com\x00keytab:-1",
+		"\x00keytab:1",
+	} {
+		if r, err := parseSPNRoute(s); err == nil {
+			t.Errorf("%q: parsed as %+v, want error", s, r)
+		}
+	}
+	if _, err := parseSPNRoute("postgres/db.ex.com"); err != errNoRoute {
+		t.Errorf("bare SPN: err = %v, want %v", err, errNoRoute)
+	}
+	if _, err := (&routedGSS{}).GetInitTokenFromSPN("postgres/db.ex.com\x00/run/cc"); err == nil {
+		t.Error("routedGSS accepted a malformed route")
+	}
+}
+
+func TestRouteCredentials(t *testing.T) {
+	cfg := &pgconn.Config{Host: "DB.ex.com"}
+	if err := routeCredentials(cfg, "/run/krb5cc_1000", "/etc/krb5.conf"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := parseSPNRoute(cfg.KerberosSpn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.spn != "postgres/db.ex.com" || r.ccache != "/run/krb5cc_1000" || r.krb5Conf != "/etc/krb5.conf" || r.fresh {
+		t.Fatalf("route = %+v", r)
+	}
+
+	routeFreshTicket(cfg)
+	routeFreshTicket(cfg) // повторно не дописывается
+	if r, err := parseSPNRoute(cfg.KerberosSpn); err != nil || !r.fresh || r.ccache != "/run/krb5cc_1000" {
+		t.Fatalf("fresh route = %+v, %v", r, err)
+	}
+
+	for _, tc := range []struct{ spn, ccache, conf string }{
+		{"", "/run/krb5cc\x00/etc/passwd", ""},
+		{"", "/run/krb5cc", "/etc/krb5.conf\x00fresh"},
+		{"postgres/db\x00x", "/run/krb5cc", ""},
+		{"", "", "/etc/krb5.conf"},
+	} {
+		cfg := &pgconn.Config{Host: "db.ex.com", KerberosSpn: tc.spn}
+		if err := routeCredentials(cfg, tc.ccache, tc.conf); err == nil {
+			t.Errorf("%q %q %q: routed to %q, want error", tc.spn, tc.ccache, tc.conf, cfg.KerberosSpn)
+		}
+	}
+}
+
+func TestConcurrentConnectsUseOwnCCache(t *testing.T) {
+	kt := testKeytab(t)
+	srv := useFakePG(t)
+	srv.kt = kt
+
+	users := []string{"alice", "bob"}
+	ccaches := map[string]string{}
+	for _, u := range users {
+		ccaches[u] = writeUserCCache(t, kt, u)
+	}
+	const rounds = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, len(users)*rounds)
+	for _, u := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Сервер пускает, только если принципал билета совпал с user в DSN
+			dsn := fmt.Sprintf("host=db.ex.com user=%s dbname=app sslmode=disable", u)
+			for range rounds {
+				conn, err := connectAsUser(context.Background(), dsn, ccaches[u], "")
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", u, err)
+					continue
+				}
+				closeConn(context.Background(), conn)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	logins := strings.Join(srv.logins, " ")
+	if n := strings.Count(logins, "alice"); n != rounds {
+		t.Errorf("alice logged in %d times, want %d", n, rounds)
+	}
+	if n := strings.Count(logins, "bob"); n != rounds {
+		t.Errorf("bob logged in %d times, want %d", n, rounds)
+	}
+}
@@ -0,0 +1,62 @@
+package pgx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Шов для тестов без живого Postgres: QueryAsUser/QueryAsUserNamed/
+// QueryAsUserStream/ExecAsUser/DescribeAsUser/ExplainAsUser получают
+// соединение через runner, а
+// connectAsUser подключается через connectConfig. Подмена — только в тестах
+// пакета, до запуска запросов.
+
+// queryConn — то, что помощникам нужно от соединения (см. pgxConn).
+type queryConn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	// Describe готовит безымянный statement: типы параметров и колонок
+	Describe(ctx context.Context, sql string) (*pgconn.StatementDescription, error)
+	TypeMap() *pgtype.Map
+}
+
+// pgxConn — *pgx.Conn как queryConn.
+type pgxConn struct {
+	*pgx.Conn
+}
+
+// Безымянный statement живёт до следующего Parse и не попадает в кэш pgx.
+func (c pgxConn) Describe(ctx context.Context, sql string) (*pgconn.StatementDescription, error) {
+	return c.PgConn().Prepare(ctx, "", sql, nil)
+}
+
+// queryRunner выдаёт соединение под делегированными кредами и функцию его
+// освобождения.
+type queryRunner interface {
+	Connect(ctx context.Context, dsn, ccachePath, krb5Conf string) (queryConn, func(), error)
+}
+
+// pgxRunner — настоящая реализация через acquireConn (с учётом WithAffinity).
+type pgxRunner struct{}
+
+func (pgxRunner) Connect(ctx context.Context, dsn, ccachePath, krb5Conf string) (queryConn, func(), error) {
+	conn, release, err := acquireConn(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pgxConn{conn}, release, nil
+}
+
+var runner queryRunner = pgxRunner{}
+
+// connectConfig — подключение в connectAsUser (повторы на 57P03 и с новым
+// билетом проверяются подменой).
+var connectConfig = pgx.ConnectConfig
+
+// newPool — создание пула пользователя (подключения пула проверяются подменой).
+var newPool = pgxpool.NewWithConfig
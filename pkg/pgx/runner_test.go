@@ -0,0 +1,361 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeRunner отдаёт fakeConn (или connErr) и считает освобождения.
+type fakeRunner struct {
+	conn     *fakeConn
+	connErr  error
+	released int
+}
+
+func (f *fakeRunner) Connect(context.Context, string, string, string) (queryConn, func(), error) {
+	if f.connErr != nil {
+		return nil, nil, f.connErr
+	}
+	return f.conn, func() { f.released++ }, nil
+}
+
+// useRunner подменяет runner до конца теста.
+func useRunner(t *testing.T, f *fakeRunner) *fakeRunner {
+	t.Helper()
+	if f.conn == nil {
+		f.conn = &fakeConn{}
+	}
+	prev := runner
+	runner = f
+	t.Cleanup(func() { runner = prev })
+	return f
+}
+
+// fakeConn — заготовленные ответы; sql последнего вызова сохраняется.
+type fakeConn struct {
+	rows     *fakeRows
+	queryErr error
+	tag      pgconn.CommandTag
+	execErr  error
+	row      fakeRow
+	desc     *pgconn.StatementDescription
+	descErr  error
+
+	sql string
+}
+
+func (c *fakeConn) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	c.sql = sql
+	if c.queryErr != nil {
+		return nil, c.queryErr
+	}
+	return c.rows, nil
+}
+
+func (c *fakeConn) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	c.sql = sql
+	return c.row
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.sql = sql
+	return c.tag, c.execErr
+}
+
+func (c *fakeConn) Describe(_ context.Context, sql string) (*pgconn.StatementDescription, error) {
+	c.sql = sql
+	return c.desc, c.descErr
+}
+
+func (c *fakeConn) TypeMap() *pgtype.Map { return pgtype.NewMap() }
+
+// fakeRows — строки vals с колонками names; на строке failAt Values
+// возвращает valuesErr, по окончании Err — err.
+type fakeRows struct {
+	names     []string
+	vals      [][]any
+	failAt    int
+	valuesErr error
+	err       error
+
+	i      int
+	closed bool
+}
+
+func newFakeRows(names []string, vals ...[]any) *fakeRows {
+	return &fakeRows{names: names, vals: vals, failAt: -1}
+}
+
+func (r *fakeRows) Close()                        { r.closed = true }
+func (r *fakeRows) Err() error                    { return r.err }
+func (r *fakeRows) CommandTag() pgconn.CommandTag { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) RawValues() [][]byte           { return nil }
+func (r *fakeRows) Conn() *pgx.Conn               { return nil }
+func (r *fakeRows) Scan(...any) error             { return errors.New("fakeRows: Scan not supported") }
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	out := make([]pgconn.FieldDescription, len(r.names))
+	for i, n := range r.names {
+		out[i].Name = n
+	}
+	return out
+}
+
+func (r *fakeRows) Next() bool {
+	if r.i >= len(r.vals) {
+		return false
+	}
+	r.i++
+	return true
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	if r.i-1 == r.failAt {
+		return nil, r.valuesErr
+	}
+	return append([]any(nil), r.vals[r.i-1]...), nil
+}
+
+// fakeRow — QueryRow: Scan кладёт plan в *[]byte или возвращает err.
+type fakeRow struct {
+	plan []byte
+	err  error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*[]byte) = r.plan
+	return nil
+}
+
+func TestQueryAsUser(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := newFakeRows([]string{"id", "at"}, []any{int32(1), at}, []any{int32(2), nil})
+	f := useRunner(t, &fakeRunner{conn: &fakeConn{rows: rows}})
+	if err := SetResultTimezone("Europe/Moscow"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetResultTimezone("")
+
+	got, err := QueryAsUser(context.Background(), fakeDSN, "/run/cc", "", "select id, at from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0][0] != int32(1) || got[1][1] != nil {
+		t.Fatalf("rows = %v", got)
+	}
+	if ts := got[0][1].(time.Time); ts.Location().String() != "Europe/Moscow" || !ts.Equal(at) {
+		t.Fatalf("time = %v, want %v in Europe/Moscow", ts, at)
+	}
+	if !rows.closed || f.released != 1 {
+		t.Fatalf("rows closed=%v, released=%d", rows.closed, f.released)
+	}
+}
+
+func TestQueryAsUserErrors(t *testing.T) {
+	boom := errors.New("boom")
+	for name, tc := range map[string]struct {
+		runner  fakeRunner
+		release int
+	}{
+		"connect": {fakeRunner{connErr: boom}, 0},
+		"query":   {fakeRunner{conn: &fakeConn{queryErr: boom}}, 1},
+		"values": {fakeRunner{conn: &fakeConn{rows: &fakeRows{
+			names: []string{"a"}, vals: [][]any{{1}, {2}}, failAt: 1, valuesErr: boom,
+		}}}, 1},
+		"rows.Err": {fakeRunner{conn: &fakeConn{rows: &fakeRows{
+			names: []string{"a"}, vals: [][]any{{1}}, failAt: -1, err: boom,
+		}}}, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := useRunner(t, &tc.runner)
+			var observed error
+			SetQueryObserver(func(op string, _ time.Duration, err error) { observed = err })
+			defer SetQueryObserver(nil)
+
+			if _, err := QueryAsUser(context.Background(), fakeDSN, "/run/cc", "", "select a"); !errors.Is(err, boom) {
+				t.Fatalf("err = %v, want %v", err, boom)
+			}
+			if !errors.Is(observed, boom) {
+				t.Fatalf("observer got %v", observed)
+			}
+			if f.released != tc.release {
+				t.Fatalf("released %d times, want %d", f.released, tc.release)
+			}
+		})
+	}
+}
+
+func TestQueryAsUserNamed(t *testing.T) {
+	rows := newFakeRows([]string{"id", "name", "name"}, []any{1, "a", "b"})
+	useRunner(t, &fakeRunner{conn: &fakeConn{rows: rows}})
+
+	got, err := QueryAsUserNamed(context.Background(), fakeDSN, "/run/cc", "", "select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// При повторяющихся именах побеждает последняя колонка
+	want := []map[string]any{{"id": 1, "name": "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestQueryAsUserStreamStopsOnCallbackError(t *testing.T) {
+	rows := newFakeRows([]string{"n"}, []any{1}, []any{2}, []any{3})
+	useRunner(t, &fakeRunner{conn: &fakeConn{rows: rows}})
+	stop := errors.New("stop")
+
+	var seen []any
+	err := QueryAsUserStream(context.Background(), fakeDSN, "/run/cc", "", "select n", func(cols []string, vals []any) error {
+		if !reflect.DeepEqual(cols, []string{"n"}) {
+			t.Errorf("columns = %v", cols)
+		}
+		seen = append(seen, vals[0])
+		if len(seen) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(seen) != 2 {
+		t.Fatalf("err=%v seen=%v, want stop after 2 rows", err, seen)
+	}
+}
+
+func TestExecAsUser(t *testing.T) {
+	useRunner(t, &fakeRunner{conn: &fakeConn{tag: pgconn.NewCommandTag("UPDATE 3")}})
+	n, err := ExecAsUser(context.Background(), fakeDSN, "/run/cc", "", "update t set a = 1")
+	if err != nil || n != 3 {
+		t.Fatalf("n=%d err=%v, want 3", n, err)
+	}
+
+	boom := errors.New("boom")
+	useRunner(t, &fakeRunner{conn: &fakeConn{execErr: boom}})
+	if _, err := ExecAsUser(context.Background(), fakeDSN, "/run/cc", "", "update"); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+}
+
+func TestDescribeAsUser(t *testing.T) {
+	desc := &pgconn.StatementDescription{
+		ParamOIDs: []uint32{pgtype.Int4OID, 999999},
+		Fields: []pgconn.FieldDescription{
+			{Name: "id", DataTypeOID: pgtype.Int8OID},
+			{Name: "at", DataTypeOID: pgtype.TimestamptzOID},
+		},
+	}
+	f := useRunner(t, &fakeRunner{conn: &fakeConn{desc: desc}})
+
+	got, err := DescribeAsUser(context.Background(), fakeDSN, "/run/cc", "", "select id, at from t where a = $1 and b = $2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Description{
+		Params:  []string{"int4", "oid:999999"},
+		Columns: []ColumnType{{"id", "int8"}, {"at", "timestamptz"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("description = %+v, want %+v", got, want)
+	}
+	if f.released != 1 {
+		t.Fatalf("released %d times", f.released)
+	}
+
+	// Без параметров и колонок — пустые массивы, а не null в JSON
+	useRunner(t, &fakeRunner{conn: &fakeConn{desc: &pgconn.StatementDescription{}}})
+	if got, err := DescribeAsUser(context.Background(), fakeDSN, "/run/cc", "", "listen x"); err != nil || got.Params == nil || got.Columns == nil {
+		t.Fatalf("empty description = %+v, %v", got, err)
+	}
+}
+
+func TestDescribeAsUserErrors(t *testing.T) {
+	boom := errors.New("boom")
+	useRunner(t, &fakeRunner{connErr: boom})
+	if _, err := DescribeAsUser(context.Background(), fakeDSN, "/run/cc", "", "select"); !errors.Is(err, boom) {
+		t.Fatalf("connect: err = %v", err)
+	}
+	pgErr := &pgconn.PgError{Code: "42601", Message: "syntax error"}
+	f := useRunner(t, &fakeRunner{conn: &fakeConn{descErr: pgErr}})
+	if _, err := DescribeAsUser(context.Background(), fakeDSN, "/run/cc", "", "selec"); !errors.Is(err, pgErr) {
+		t.Fatalf("prepare: err = %v", err)
+	}
+	if f.released != 1 {
+		t.Fatalf("released %d times after prepare error", f.released)
+	}
+}
+
+func TestExplainAsUser(t *testing.T) {
+	plan := []byte(`[{"Plan":{"Node Type":"Seq Scan"}}]`)
+	f := useRunner(t, &fakeRunner{conn: &fakeConn{row: fakeRow{plan: plan}}})
+
+	got, err := ExplainAsUser(context.Background(), fakeDSN, "/run/cc", "", "select * from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(plan) {
+		t.Fatalf("plan = %s", got)
+	}
+	if f.conn.sql != "EXPLAIN (FORMAT JSON) select * from t" {
+		t.Fatalf("sent %q", f.conn.sql)
+	}
+
+	boom := errors.New("boom")
+	useRunner(t, &fakeRunner{conn: &fakeConn{row: fakeRow{err: boom}}})
+	if _, err := ExplainAsUser(context.Background(), fakeDSN, "/run/cc", "", "select"); !errors.Is(err, boom) {
+		t.Fatalf("scan: err = %v", err)
+	}
+	useRunner(t, &fakeRunner{connErr: boom})
+	if _, err := ExplainAsUser(context.Background(), fakeDSN, "/run/cc", "", "select"); !errors.Is(err, boom) {
+		t.Fatalf("connect: err = %v", err)
+	}
+}
+
+func TestDescribeExplainObserved(t *testing.T) {
+	type obs struct {
+		op  string
+		err error
+	}
+	var got []obs
+	SetQueryObserver(func(op string, _ time.Duration, err error) { got = append(got, obs{op, err}) })
+	defer SetQueryObserver(nil)
+
+	boom := errors.New("boom")
+	useRunner(t, &fakeRunner{conn: &fakeConn{desc: &pgconn.StatementDescription{}}})
+	DescribeAsUser(context.Background(), fakeDSN, "/run/cc", "", "select")
+	useRunner(t, &fakeRunner{conn: &fakeConn{row: fakeRow{err: boom}}})
+	ExplainAsUser(context.Background(), fakeDSN, "/run/cc", "", "select")
+
+	want := []obs{{"describe", nil}, {"explain", boom}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("observed %+v, want %+v", got, want)
+	}
+}
+
+func TestSetResultTimezone(t *testing.T) {
+	defer SetResultTimezone("")
+	if err := SetResultTimezone("Mars/Olympus"); err == nil {
+		t.Fatal("unknown timezone accepted")
+	}
+
+	// Пустая строка — время как вернул сервер
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("srv", 3*3600))
+	SetResultTimezone("UTC")
+	SetResultTimezone("")
+	useRunner(t, &fakeRunner{conn: &fakeConn{rows: newFakeRows([]string{"at"}, []any{at})}})
+	got, err := QueryAsUser(context.Background(), fakeDSN, "/run/cc", "", "select at")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := got[0][0].(time.Time); ts.Location().String() != "srv" {
+		t.Fatalf("time = %v, want the server's zone", ts)
+	}
+}
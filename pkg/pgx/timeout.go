@@ -0,0 +1,74 @@
+package pgx
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	statementTimeout atomic.Int64
+	connectTimeout   atomic.Int64
+	maxConnLifetime  atomic.Int64
+)
+
+func init() {
+	connectTimeout.Store(int64(5 * time.Second))
+	maxConnLifetime.Store(int64(30 * time.Second))
+}
+
+// SetConnectTimeout задаёт предел подключения под пользователем (TCP, TLS,
+// GSS); по умолчанию 5s. d <= 0 не меняет значение.
+func SetConnectTimeout(d time.Duration) {
+	if d > 0 {
+		connectTimeout.Store(int64(d))
+	}
+}
+
+// SetMaxConnLifetime задаёт предел жизни соединения в пуле PoolForUser; по
+// умолчанию 30s. В любом случае соединение не живёт дольше делегированного
+// ccache. d <= 0 не меняет значение.
+func SetMaxConnLifetime(d time.Duration) {
+	if d > 0 {
+		maxConnLifetime.Store(int64(d))
+	}
+}
+
+// poolLifetime — MaxConnLifetime пула: не больше SetMaxConnLifetime и не
+// дольше, чем до конца срока ccache за вычетом ccacheExpirySkew. <= 0 — креды
+// уже (почти) истекли.
+func poolLifetime(now, ccacheExpires time.Time) time.Duration {
+	lifetime := time.Duration(maxConnLifetime.Load())
+	if left := ccacheExpires.Sub(now) - ccacheExpirySkew; left < lifetime {
+		lifetime = left
+	}
+	return lifetime
+}
+
+// SetStatementTimeout задаёт statement_timeout для соединений под
+// пользователями: сервер сам прервёт запрос (57014), даже если клиент про него
+// забыл и держит соединение с делегированными кредами. 0 — без предела.
+// Отмена ctx прерывает запрос и без этого: pgconn закрывает соединение и шлёт
+// серверу CancelRequest, так что бэкенд не остаётся работать.
+func SetStatementTimeout(d time.Duration) {
+	statementTimeout.Store(int64(d))
+}
+
+// applyStatementTimeout передаёт statement_timeout в стартовом пакете (как
+// SET сразу после подключения, но без лишнего обхода). statement_timeout,
+// заданный в самом DSN, не перекрывается.
+func applyStatementTimeout(cfg *pgconn.Config) {
+	d := time.Duration(statementTimeout.Load())
+	if d <= 0 {
+		return
+	}
+	if _, set := cfg.RuntimeParams["statement_timeout"]; set {
+		return
+	}
+	if cfg.RuntimeParams == nil {
+		cfg.RuntimeParams = map[string]string{}
+	}
+	cfg.RuntimeParams["statement_timeout"] = strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,96 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// useTimeouts восстанавливает таймауты подключения и жизни соединений после теста.
+func useTimeouts(t *testing.T) {
+	t.Helper()
+	prevConnect, prevLifetime := connectTimeout.Load(), maxConnLifetime.Load()
+	t.Cleanup(func() {
+		connectTimeout.Store(prevConnect)
+		maxConnLifetime.Store(prevLifetime)
+	})
+}
+
+func TestPoolLifetime(t *testing.T) {
+	useTimeouts(t)
+	SetMaxConnLifetime(30 * time.Second)
+	now := time.Now()
+	for left, want := range map[time.Duration]time.Duration{
+		time.Hour:                      30 * time.Second,
+		time.Minute + 20*time.Second:   20 * time.Second,
+		ccacheExpirySkew:               0,
+		ccacheExpirySkew - time.Second: -time.Second,
+	} {
+		if got := poolLifetime(now, now.Add(left)); got != want {
+			t.Errorf("ccache expires in %v: lifetime = %v, want %v", left, got, want)
+		}
+	}
+
+	// Неположительные значения не сбрасывают настройку
+	SetMaxConnLifetime(0)
+	SetConnectTimeout(-time.Second)
+	if maxConnLifetime.Load() != int64(30*time.Second) || connectTimeout.Load() <= 0 {
+		t.Fatalf("lifetime = %v, connect timeout = %v", time.Duration(maxConnLifetime.Load()), time.Duration(connectTimeout.Load()))
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	useTimeouts(t)
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	useFakePG(t)
+	SetConnectTimeout(7 * time.Second)
+
+	var got time.Duration
+	connect := connectConfig
+	connectConfig = func(ctx context.Context, cfg *pgx.ConnConfig) (*pgx.Conn, error) {
+		got = cfg.ConnectTimeout
+		return connect(ctx, cfg)
+	}
+	if _, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got != 7*time.Second {
+		t.Fatalf("ConnectTimeout = %v, want 7s", got)
+	}
+}
+
+// Соединение пула не переживает ccache, но и не живёт дольше настройки
+func TestPoolForUserLifetime(t *testing.T) {
+	useTimeouts(t)
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice") // истекает через час
+	useFakePG(t)
+
+	var got time.Duration
+	open := newPool
+	newPool = func(ctx context.Context, pc *pgxpool.Config) (*pgxpool.Pool, error) {
+		got = pc.MaxConnLifetime
+		return open(ctx, pc)
+	}
+	for _, tc := range []struct {
+		max      time.Duration
+		min, top time.Duration
+	}{
+		{30 * time.Second, 30 * time.Second, 30 * time.Second},
+		{2 * time.Hour, 57 * time.Minute, time.Hour - ccacheExpirySkew},
+	} {
+		SetMaxConnLifetime(tc.max)
+		pool, err := PoolForUser(context.Background(), fakeDSN, ccache, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Close()
+		if got < tc.min || got > tc.top {
+			t.Errorf("max %v: MaxConnLifetime = %v, want within [%v, %v]", tc.max, got, tc.min, tc.top)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package pgx
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type tlsSettings struct {
+	base       *tls.Config
+	serverName string
+}
+
+var pgTLS atomic.Pointer[tlsSettings]
+
+// SetTLSConfig задаёт шаблон TLS для соединений под пользователем (MinVersion,
+// RootCAs, сертификат клиента…); он клонируется на каждое соединение.
+// serverName, если не пуст, перекрывает имя сервера для проверки сертификата
+// (например, при подключении через пулер с другим именем); пустой — берётся
+// хост из DSN. base == nil — TLS 1.2+ с системными CA.
+func SetTLSConfig(base *tls.Config, serverName string) {
+	pgTLS.Store(&tlsSettings{base: base, serverName: serverName})
+}
+
+// applyTLS подставляет шаблон в соединения, для которых DSN требует TLS
+// (sslmode=disable и не-TLS запасной вариант prefer не трогаются). ServerName —
+// хост каждого адреса из DSN, включая запасные.
+func applyTLS(cfg *pgconn.Config) {
+	s := pgTLS.Load()
+	if s == nil {
+		s = &tlsSettings{}
+	}
+	build := func(host string) *tls.Config {
+		var t *tls.Config
+		if s.base != nil {
+			t = s.base.Clone()
+		} else {
+			t = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if t.ServerName == "" {
+			t.ServerName = host
+			if s.serverName != "" {
+				t.ServerName = s.serverName
+			}
+		}
+		return t
+	}
+	if cfg.TLSConfig != nil {
+		cfg.TLSConfig = build(cfg.Host)
+	}
+	for _, fb := range cfg.Fallbacks {
+		if fb.TLSConfig != nil {
+			fb.TLSConfig = build(fb.Host)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package pgx
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// tlsNames — ServerName основного адреса и запасных ("-" — без TLS).
+func tlsNames(t *testing.T, dsn string) []string {
+	t.Helper()
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyTLS(cfg)
+	name := func(c *tls.Config) string {
+		if c == nil {
+			return "-"
+		}
+		return c.ServerName
+	}
+	names := []string{name(cfg.TLSConfig)}
+	for _, fb := range cfg.Fallbacks {
+		names = append(names, name(fb.TLSConfig))
+	}
+	return names
+}
+
+func TestApplyTLSServerName(t *testing.T) {
+	defer pgTLS.Store(nil)
+	check := func(dsn string, want ...string) {
+		t.Helper()
+		got := tlsNames(t, dsn)
+		if len(got) != len(want) {
+			t.Fatalf("%s: server names %v, want %v", dsn, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: server names %v, want %v", dsn, got, want)
+			}
+		}
+	}
+
+	// Имя для проверки сертификата — хост каждого адреса DSN
+	check("host=db1.ex.com,db2.ex.com sslmode=verify-full", "db1.ex.com", "db2.ex.com")
+	// prefer: открытый запасной вариант остаётся открытым
+	check("host=db1.ex.com sslmode=prefer", "db1.ex.com", "-")
+	check("host=db1.ex.com sslmode=disable", "-")
+
+	SetTLSConfig(nil, "pgbouncer.ex.com")
+	check("host=db1.ex.com,db2.ex.com sslmode=verify-full", "pgbouncer.ex.com", "pgbouncer.ex.com")
+	check("host=db1.ex.com sslmode=disable", "-")
+}
+
+func TestApplyTLSTemplate(t *testing.T) {
+	defer pgTLS.Store(nil)
+	base := &tls.Config{MinVersion: tls.VersionTLS13}
+	SetTLSConfig(base, "")
+
+	cfg, err := pgconn.ParseConfig("host=db1.ex.com sslmode=verify-full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyTLS(cfg)
+	if cfg.TLSConfig == base || cfg.TLSConfig.MinVersion != tls.VersionTLS13 || cfg.TLSConfig.ServerName != "db1.ex.com" {
+		t.Fatalf("TLS config = %+v", cfg.TLSConfig)
+	}
+	// Шаблон клонируется, а не правится на месте
+	if base.ServerName != "" {
+		t.Fatalf("template ServerName = %q", base.ServerName)
+	}
+
+	// Без шаблона — TLS 1.2+
+	pgTLS.Store(nil)
+	cfg, _ = pgconn.ParseConfig("host=db1.ex.com sslmode=verify-full")
+	applyTLS(cfg)
+	if cfg.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("default MinVersion = %#x", cfg.TLSConfig.MinVersion)
+	}
+}
@@ -0,0 +1,23 @@
+package pgx
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithTxAsUser выполняет fn в одной транзакции на одном соединении под
+// делегированным пользователем (те же креды, что у QueryAsUser): COMMIT, если
+// fn вернула nil, иначе ROLLBACK и ошибка fn. Tx действительна только внутри
+// fn — сохранять её или передавать в горутины, живущие дольше fn, нельзя.
+func WithTxAsUser(ctx context.Context, dsn, ccachePath, krb5Conf string, fn func(pgx.Tx) error) (err error) {
+	defer observe("tx", time.Now(), &err)
+	conn, release, err := acquireConn(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return pgx.BeginFunc(ctx, conn, fn)
+}
@@ -0,0 +1,235 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+// Пул выбрасывается заранее, чтобы новые соединения не открывались билетом,
+// который истечёт посреди рукопожатия.
+const ccacheExpirySkew = time.Minute
+
+// UserPoolManager держит по маленькому пулу на тройку (principal, ccache, DSN).
+// Пулы НИКОГДА не делятся между принципалами: ключ включает и имя пользователя,
+// и путь к его делегированному ccache, а креды едут в конфиге соединения пула.
+// Пул закрывается, когда ccache подходит к концу срока или простаивает дольше idleTTL.
+type UserPoolManager struct {
+	krb5Conf string
+	maxConns int32
+	idleTTL  time.Duration
+
+	mu    sync.Mutex
+	pools map[userPoolKey]*userPool
+}
+
+type userPoolKey struct {
+	principal string
+	ccache    string
+	dsn       string
+}
+
+type userPool struct {
+	pool     *pgxpool.Pool
+	expires  time.Time
+	lastUsed time.Time
+}
+
+// NewUserPoolManager: maxConns — предел соединений одного пользователя,
+// idleTTL — сколько неиспользуемый пул живёт до закрытия.
+func NewUserPoolManager(krb5Conf string, maxConns int32, idleTTL time.Duration) *UserPoolManager {
+	if maxConns <= 0 {
+		maxConns = 2
+	}
+	return &UserPoolManager{
+		krb5Conf: krb5Conf,
+		maxConns: maxConns,
+		idleTTL:  idleTTL,
+		pools:    map[userPoolKey]*userPool{},
+	}
+}
+
+// GetPool возвращает пул пользователя principal или создаёт его по dsn и ccachePath.
+// Время жизни соединений пула не превышает срока делегированного билета.
+// ccache читается вне блокировки: медленный источник одного пользователя не
+// задерживает остальных.
+func (m *UserPoolManager) GetPool(ctx context.Context, principal, dsn, ccachePath string) (*pgxpool.Pool, error) {
+	key := userPoolKey{principal: principal, ccache: ccachePath, dsn: dsn}
+	if pool := m.cached(key, time.Now()); pool != nil {
+		return pool, nil
+	}
+
+	now := time.Now()
+	expires, err := ccacheExpiry(ctx, ccachePath)
+	if err != nil {
+		return nil, err
+	}
+	lifetime := expires.Sub(now) - ccacheExpirySkew
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("delegated credentials for %s expire at %s", principal, expires.Format(time.RFC3339))
+	}
+	pool, err := newUserPool(ctx, dsn, ccachePath, m.krb5Conf, m.maxConns, lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if p, ok := m.pools[key]; ok && now.Add(ccacheExpirySkew).Before(p.expires) {
+		// параллельный вызов успел раньше — его пул и берём
+		p.lastUsed = now
+		m.mu.Unlock()
+		pool.Close()
+		return p.pool, nil
+	}
+	m.pools[key] = &userPool{pool: pool, expires: expires, lastUsed: now}
+	m.mu.Unlock()
+	observePool(principal, true)
+	return pool, nil
+}
+
+// cached — живой пул по key; пул с истекающим ccache выбрасывается.
+func (m *UserPoolManager) cached(key userPoolKey, now time.Time) *pgxpool.Pool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.pools[key]
+	if !ok {
+		return nil
+	}
+	if now.Add(ccacheExpirySkew).Before(p.expires) {
+		p.lastUsed = now
+		return p.pool
+	}
+	delete(m.pools, key)
+	go p.pool.Close()
+	observePool(key.principal, false)
+	return nil
+}
+
+// Sweep закрывает пулы с истекающим ccache и простаивающие дольше idleTTL.
+func (m *UserPoolManager) Sweep() {
+	now := time.Now()
+	stale := map[userPoolKey]*pgxpool.Pool{}
+	m.mu.Lock()
+	for k, p := range m.pools {
+		expired := !now.Add(ccacheExpirySkew).Before(p.expires)
+		idle := m.idleTTL > 0 && now.Sub(p.lastUsed) > m.idleTTL
+		if expired || idle {
+			stale[k] = p.pool
+			delete(m.pools, k)
+		}
+	}
+	m.mu.Unlock()
+	// Close ждёт возврата соединений — вне блокировки
+	for k, p := range stale {
+		p.Close()
+		observePool(k.principal, false)
+	}
+}
+
+// Start периодически вызывает Sweep, пока ctx не отменён.
+func (m *UserPoolManager) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				m.Sweep()
+			}
+		}
+	}()
+}
+
+// Close закрывает все пулы.
+func (m *UserPoolManager) Close() {
+	m.mu.Lock()
+	pools := m.pools
+	m.pools = map[userPoolKey]*userPool{}
+	m.mu.Unlock()
+	for k, p := range pools {
+		p.pool.Close()
+		observePool(k.principal, false)
+	}
+}
+
+// ccacheExpiry — конец срока TGT в ccache name.
+func ccacheExpiry(ctx context.Context, name string) (time.Time, error) {
+	cc, err := krb.LoadCCache(ctx, name)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load ccache: %w", err)
+	}
+	return tgtEndTime(cc)
+}
+
+// PoolObserver узнаёт о пулах UserPoolManager: open — пул principal создан,
+// иначе закрыт (истёк ccache, простой, Close). У принципала может быть
+// несколько пулов — по одному на ccache и DSN.
+type PoolObserver func(principal string, open bool)
+
+var poolObserver atomic.Pointer[PoolObserver]
+
+// SetPoolObserver подключает наблюдателя (метрики и т.п.); nil отключает.
+func SetPoolObserver(fn PoolObserver) {
+	if fn == nil {
+		poolObserver.Store(nil)
+		return
+	}
+	poolObserver.Store(&fn)
+}
+
+func observePool(principal string, open bool) {
+	if fn := poolObserver.Load(); fn != nil {
+		(*fn)(principal, open)
+	}
+}
+
+// Пулы пользователей для QueryAsUser и прочих (nil — соединение на вызов).
+var userPools atomic.Pointer[UserPoolManager]
+
+// SetUserPools включает пулы m для вызовов, в ctx которых есть принципал
+// (WithPrincipal); nil выключает. Привязка WithAffinity важнее пула.
+func SetUserPools(m *UserPoolManager) {
+	userPools.Store(m)
+}
+
+type principalKey struct{}
+
+// WithPrincipal — ctx с принципалом, которому принадлежит ccache вызовов
+// (уже сверенным с аутентифицированным): по нему выбирается пул из SetUserPools.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// connectUnpinned — соединение вне привязки: из пула пользователя, если пулы
+// включены и принципал известен, иначе новое (закрывается при освобождении).
+func connectUnpinned(ctx context.Context, dsn, ccachePath, krb5Conf string) (*pgx.Conn, func(), error) {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	if m := userPools.Load(); m != nil && principal != "" {
+		pool, err := m.GetPool(ctx, principal, dsn, ccachePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := acquirePooled(ctx, pool)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c.Conn(), c.Release, nil
+	}
+	conn, err := connectAsUser(ctx, dsn, ccachePath, krb5Conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { closeConn(ctx, conn) }, nil
+}
@@ -0,0 +1,186 @@
+package pgx
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+
+	"go-http-pgsql-krb5/pkg/krb"
+)
+
+func TestUserPoolManagerTwoPrincipals(t *testing.T) {
+	kt := testKeytab(t)
+	ccaches := map[string]string{
+		"alice@EX.COM": writeUserCCache(t, kt, "alice"),
+		"bob@EX.COM":   writeUserCCache(t, kt, "bob"),
+	}
+	m := NewUserPoolManager("", 2, time.Minute)
+	defer m.Close()
+
+	var mu sync.Mutex
+	got := map[string]map[*pgxpool.Pool]bool{}
+	var wg sync.WaitGroup
+	for principal, ccache := range ccaches {
+		got[principal] = map[*pgxpool.Pool]bool{}
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pool, err := m.GetPool(context.Background(), principal, fakeDSN, ccache)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				got[principal][pool] = true
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	for principal, pools := range got {
+		if len(pools) != 1 {
+			t.Fatalf("%s: %d pools, want 1", principal, len(pools))
+		}
+		for pool := range pools {
+			// креды пула — ccache именно этого принципала
+			if spn := pool.Config().ConnConfig.KerberosSpn; !strings.Contains(spn, spnRouteSep+ccaches[principal]+spnRouteSep) {
+				t.Errorf("%s: pool routed to %q", principal, spn)
+			}
+			for other, otherPools := range got {
+				if other != principal && otherPools[pool] {
+					t.Errorf("%s and %s share a pool", principal, other)
+				}
+			}
+		}
+	}
+}
+
+// slowCCache блокирует Load до закрытия release.
+type slowCCache struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s slowCCache) Load(ctx context.Context) (*credentials.CCache, error) {
+	close(s.entered)
+	<-s.release
+	return nil, context.Canceled
+}
+
+func TestUserPoolManagerLoadsCCacheOutsideLock(t *testing.T) {
+	slow := slowCCache{entered: make(chan struct{}), release: make(chan struct{})}
+	krb.RegisterCCacheType("TESTSLOW", func(string) (krb.CCacheSource, error) { return slow, nil })
+	defer close(slow.release)
+
+	kt := testKeytab(t)
+	bob := writeUserCCache(t, kt, "bob")
+	m := NewUserPoolManager("", 2, time.Minute)
+	defer m.Close()
+
+	go m.GetPool(context.Background(), "alice@EX.COM", fakeDSN, "TESTSLOW:alice")
+	<-slow.entered
+	withTimeout(t, func() {
+		if _, err := m.GetPool(context.Background(), "bob@EX.COM", fakeDSN, bob); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestQueryUsesUserPoolForPrincipal(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	srv := useFakePG(t)
+	m := NewUserPoolManager("", 2, time.Minute)
+	defer m.Close()
+	SetUserPools(m)
+	defer SetUserPools(nil)
+
+	// Без принципала в ctx — одиночное соединение, пул не заводится
+	if _, err := ExecAsUser(context.Background(), fakeDSN, ccache, "", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.connCount() != 1 || len(m.pools) != 0 {
+		t.Fatalf("conns=%d pools=%d, want a plain connection", srv.connCount(), len(m.pools))
+	}
+
+	// С принципалом — пул пользователя
+	ctx := WithPrincipal(context.Background(), "alice@EX.COM")
+	if _, err := ExecAsUser(ctx, fakeDSN, ccache, "", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.connCount() != 2 || len(m.pools) != 1 {
+		t.Fatalf("conns=%d pools=%d, want the user's pool", srv.connCount(), len(m.pools))
+	}
+}
+
+func TestUserPoolConnectRetries(t *testing.T) {
+	kt := testKeytab(t)
+	ccache := writeUserCCache(t, kt, "alice")
+	srv := useFakePG(t)
+	SetStartupRetry(2, time.Millisecond)
+	defer SetStartupRetry(0, 0)
+	m := NewUserPoolManager("", 2, time.Minute)
+	defer m.Close()
+	SetUserPools(m)
+	defer SetUserPools(nil)
+
+	// Сервер ещё стартует, потом отвергает устаревший билет
+	srv.failNext(
+		&pgproto3.ErrorResponse{Code: "57P03", Message: "the database system is starting up"},
+		&pgproto3.ErrorResponse{Code: "28000", Message: `GSSAPI authentication failed for user "alice"`},
+	)
+	ctx := WithPrincipal(context.Background(), "alice@EX.COM")
+	if _, err := ExecAsUser(ctx, fakeDSN, ccache, "", "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	got := srv.attempts()
+	if len(got) != 3 {
+		t.Fatalf("pooled connect attempts = %d, want 3", len(got))
+	}
+	if got[0].fresh || got[1].fresh || !got[2].fresh {
+		t.Fatalf("fresh ticket per attempt = %v %v %v, want only after the auth failure", got[0].fresh, got[1].fresh, got[2].fresh)
+	}
+}
+
+func TestUserPoolManagerObserver(t *testing.T) {
+	kt := testKeytab(t)
+	alice := writeUserCCache(t, kt, "alice")
+	var mu sync.Mutex
+	open := map[string]int{}
+	SetPoolObserver(func(principal string, opened bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if opened {
+			open[principal]++
+		} else {
+			open[principal]--
+		}
+	})
+	defer SetPoolObserver(nil)
+
+	m := NewUserPoolManager("", 2, time.Nanosecond)
+	for range 3 {
+		if _, err := m.GetPool(context.Background(), "alice@EX.COM", fakeDSN, alice); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.GetPool(context.Background(), "alice@EX.COM", fakeDSN+" application_name=x", alice); err != nil {
+		t.Fatal(err)
+	}
+	if open["alice@EX.COM"] != 2 {
+		t.Fatalf("open pools = %d, want 2 (one per DSN)", open["alice@EX.COM"])
+	}
+	time.Sleep(time.Millisecond)
+	m.Sweep() // idleTTL истёк
+	if open["alice@EX.COM"] != 0 {
+		t.Fatalf("open pools = %d after sweep, want 0", open["alice@EX.COM"])
+	}
+}
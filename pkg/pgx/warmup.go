@@ -0,0 +1,97 @@
+package pgx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// sslRequestCode — код SSLRequest в протоколе Postgres (1234<<16 | 5679).
+const sslRequestCode = 80877103
+
+// WarmUp прогревает DNS, TCP и TLS ко всем серверам dsn (multi-host — к
+// каждому): подключается так же, как connectAsUser (порт, sslmode и шаблон
+// SetTLSConfig из DSN), проходит SSLRequest и рукопожатие TLS и закрывает
+// соединение, не доходя до StartupMessage и аутентификации. Ошибки серверов
+// возвращаются вместе; nil — все ответили.
+func WarmUp(ctx context.Context, dsn string) error {
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return err
+	}
+	applyTLS(cfg)
+
+	// С sslmode=prefer на хост две попытки (TLS и без) — прогреваем одну, с TLS
+	// если он есть
+	type target struct {
+		host string
+		port uint16
+		tls  *tls.Config
+	}
+	var targets []*target
+	seen := map[string]*target{}
+	add := func(host string, port uint16, t *tls.Config) {
+		key := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		if prev, ok := seen[key]; ok {
+			if prev.tls == nil {
+				prev.tls = t
+			}
+			return
+		}
+		seen[key] = &target{host, port, t}
+		targets = append(targets, seen[key])
+	}
+	add(cfg.Host, cfg.Port, cfg.TLSConfig)
+	for _, fb := range cfg.Fallbacks {
+		add(fb.Host, fb.Port, fb.TLSConfig)
+	}
+
+	var errs []error
+	for _, t := range targets {
+		if err := warmUpHost(ctx, cfg, t.host, t.port, t.tls); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", net.JoinHostPort(t.host, strconv.Itoa(int(t.port))), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func warmUpHost(ctx context.Context, cfg *pgconn.Config, host string, port uint16, tlsCfg *tls.Config) error {
+	network, addr := pgconn.NetworkAddress(host, port)
+	conn, err := cfg.DialFunc(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if tlsCfg == nil {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var req [8]byte
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], sslRequestCode)
+	if _, err := conn.Write(req[:]); err != nil {
+		return err
+	}
+	var resp [1]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return errors.New("server refused TLS")
+	}
+	tc := tls.Client(conn, tlsCfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	return tc.Close()
+}
@@ -0,0 +1,144 @@
+package pgx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tlsPG — сервер, отвечающий на SSLRequest (accept — 'S', иначе 'N') и
+// проходящий рукопожатие TLS с сертификатом httptest.
+type tlsPG struct {
+	ln         net.Listener
+	handshakes atomic.Int32
+}
+
+func newTLSPG(t *testing.T, accept bool) (*tlsPG, *x509.CertPool) {
+	t.Helper()
+	hs := httptest.NewUnstartedServer(nil)
+	hs.StartTLS()
+	t.Cleanup(hs.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(hs.Certificate())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &tlsPG{ln: ln}
+	srvCfg := &tls.Config{Certificates: hs.TLS.Certificates}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				var req [8]byte
+				if _, err := io.ReadFull(c, req[:]); err != nil || binary.BigEndian.Uint32(req[4:]) != sslRequestCode {
+					return
+				}
+				if !accept {
+					c.Write([]byte{'N'})
+					return
+				}
+				c.Write([]byte{'S'})
+				if tls.Server(c, srvCfg).Handshake() == nil {
+					s.handshakes.Add(1)
+				}
+			}()
+		}
+	}()
+	return s, pool
+}
+
+func (s *tlsPG) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+// waitHandshakes — число рукопожатий, завершённых сервером (он заканчивает
+// своё после клиента).
+func (s *tlsPG) waitHandshakes(want int32) int32 {
+	for i := 0; i < 100 && s.handshakes.Load() < want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s.handshakes.Load()
+}
+
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func TestWarmUpTLSHandshake(t *testing.T) {
+	srv, pool := newTLSPG(t, true)
+	SetTLSConfig(&tls.Config{RootCAs: pool}, "")
+	defer pgTLS.Store(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dsn := BuildDSN(DSNOptions{Host: "127.0.0.1", Port: srv.port(), DBName: "app", SSLMode: "require"})
+	if err := WarmUp(ctx, dsn); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.waitHandshakes(1); n != 1 {
+		t.Fatalf("handshakes = %d, want 1", n)
+	}
+}
+
+func TestWarmUpEveryHost(t *testing.T) {
+	srv, pool := newTLSPG(t, true)
+	SetTLSConfig(&tls.Config{RootCAs: pool}, "")
+	defer pgTLS.Store(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Второй хост недоступен: первый всё равно прогрет, ошибка называет второй
+	down := closedPort(t)
+	dsn := fmt.Sprintf("host=127.0.0.1,127.0.0.1 port=%d,%d dbname=app sslmode=require", srv.port(), down)
+	err := WarmUp(ctx, dsn)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf(":%d", down)) {
+		t.Fatalf("err = %v, want the unreachable host", err)
+	}
+	if strings.Contains(err.Error(), fmt.Sprintf(":%d", srv.port())) {
+		t.Fatalf("err = %v names the healthy host", err)
+	}
+	if n := srv.waitHandshakes(1); n != 1 {
+		t.Fatalf("handshakes = %d, want 1", n)
+	}
+}
+
+func TestWarmUpVerifiesCertificate(t *testing.T) {
+	srv, _ := newTLSPG(t, true)
+	SetTLSConfig(&tls.Config{RootCAs: x509.NewCertPool()}, "")
+	defer pgTLS.Store(nil)
+
+	dsn := BuildDSN(DSNOptions{Host: "127.0.0.1", Port: srv.port(), SSLMode: "require"})
+	if err := WarmUp(context.Background(), dsn); err == nil {
+		t.Fatal("warm-up accepted an untrusted certificate")
+	}
+}
+
+func TestWarmUpServerRefusesTLS(t *testing.T) {
+	srv, _ := newTLSPG(t, false)
+
+	dsn := BuildDSN(DSNOptions{Host: "127.0.0.1", Port: srv.port(), SSLMode: "require"})
+	if err := WarmUp(context.Background(), dsn); err == nil || !strings.Contains(err.Error(), "refused TLS") {
+		t.Fatalf("err = %v, want refused TLS", err)
+	}
+}
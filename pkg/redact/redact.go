@@ -0,0 +1,135 @@
+// Package redact маскирует секреты в DSN и URL перед тем, как они попадут
+// в лог или в текст ошибки.
+package redact
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+const mask = "xxxxx"
+
+// DefaultParams — параметры, значения которых маскируются, пока не задано иное.
+// GSS паролей не использует, но DSN и URL собираются и из конфигурации.
+var DefaultParams = []string{"password", "sslpassword", "sslkey", "passfile", "token", "secret"}
+
+var params atomic.Pointer[map[string]bool]
+
+func init() { SetParams(DefaultParams) }
+
+// SetParams задаёт имена параметров (без учёта регистра), значения которых маскируются.
+func SetParams(names []string) {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[strings.ToLower(strings.TrimSpace(n))] = true
+	}
+	params.Store(&m)
+}
+
+func sensitive(name string) bool {
+	return (*params.Load())[strings.ToLower(name)]
+}
+
+// URL прячет пароль из userinfo и значения чувствительных query-параметров.
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return mask
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if sensitive(k) {
+				q.Set(k, mask)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// DSN маскирует чувствительные параметры в строке подключения libpq —
+// как в URL-форме (postgres://), так и в форме "key=value key='value'".
+func DSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return URL(dsn)
+	}
+
+	var b strings.Builder
+	s := dsn
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			break
+		}
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			b.WriteString(s)
+			break
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimLeft(rest, " ")
+		val, tail := splitValue(rest)
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if sensitive(key) {
+			b.WriteString(mask)
+		} else {
+			b.WriteString(val)
+		}
+		s = tail
+	}
+	return b.String()
+}
+
+// splitValue отделяет значение (голое или в одинарных кавычках с \-экранированием).
+func splitValue(s string) (val, tail string) {
+	if !strings.HasPrefix(s, "'") {
+		if i := strings.IndexAny(s, " \t\n"); i >= 0 {
+			return s[:i], s[i:]
+		}
+		return s, ""
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			return s[:i+1], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// Error возвращает ошибку, в тексте которой raw заменён на замаскированную
+// форму, а URL в *url.Error — на URL(...). errors.Is/As по-прежнему работают.
+func Error(err error, raw, masked string) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		msg = strings.ReplaceAll(msg, ue.URL, URL(ue.URL))
+	}
+	if raw != "" && raw != masked {
+		msg = strings.ReplaceAll(msg, raw, masked)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }